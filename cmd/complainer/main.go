@@ -9,11 +9,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cloudflare/complainer/docker"
+	"github.com/cloudflare/complainer/election"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/kubernetes"
+	"github.com/cloudflare/complainer/limit"
+	"github.com/cloudflare/complainer/marathon"
 	"github.com/cloudflare/complainer/matcher"
 	"github.com/cloudflare/complainer/mesos"
+	"github.com/cloudflare/complainer/metronome"
 	"github.com/cloudflare/complainer/monitor"
 	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/shard"
+	"github.com/cloudflare/complainer/store"
 	"github.com/cloudflare/complainer/uploader"
 )
 
@@ -40,28 +48,83 @@ func (a *regexArrayFlags) Set(value string) error {
 	return err
 }
 
+type attributeArrayFlags []matcher.AttributeRegex
+
+func (a *attributeArrayFlags) String() string {
+	var l []string
+	for _, r := range *a {
+		l = append(l, r.Name+"="+r.Regex.String())
+	}
+	return strings.Join(l, ", ")
+}
+
+func (a *attributeArrayFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected attribute=regex, got %q", value)
+	}
+
+	r, err := regexp.Compile(parts[1])
+	if r != nil {
+		*a = append(*a, matcher.AttributeRegex{Name: parts[0], Regex: r})
+	}
+	return err
+}
+
 func main() {
 	name := flags.String("name", "COMPLAINER_NAME", monitor.DefaultName, "complainer name to use (default is implicit)")
 	d := flags.Bool("default", "COMPLAINER_DEFAULT", true, "whether to use implicit default reporters")
 	u := flags.String("uploader", "COMPLAINER_UPLOADER", "", "uploader to use (example: s3aws,s3goamz,noop)")
 	r := flags.String("reporters", "COMPLAINER_REPORTERS", "", "reporters to use (example: sentry,hipchat,slack,file)")
-	masters := flags.String("masters", "COMPLAINER_MASTERS", "", "list of master urls: http://host:port,http://host:port")
+	masters := flags.String("masters", "COMPLAINER_MASTERS", "", "list of master urls: http://host:port,http://host:port or zk://host:port,host:port/path")
+	clusterName := flags.String("cluster", "COMPLAINER_CLUSTER", "default", "name of the cluster set by masters")
+	clusters := flags.String("clusters", "COMPLAINER_CLUSTERS", "", "path to json file with names and configs of several clusters, replaces masters")
 	listen := flags.String("listen", "COMPLAINER_LISTEN", "", "http listen address")
+	states := flags.String("states", "COMPLAINER_STATES", mesos.DefaultStates, "list of task states that are considered failures")
+	pushTokens := flags.String("push-tokens", "COMPLAINER_PUSH_TOKENS", "", "list of tokens to accept pushed failures over http with (example: token1,token2)")
+	pushLogHosts := flags.String("push-log-hosts", "COMPLAINER_PUSH_LOG_HOSTS", "", "list of hosts to fetch logs of pushed failures from, only inline logs are accepted by default (example: logs.example.com,logs.example.com:8080)")
+	deadLettersTokens := flags.String("dead-letters-tokens", "COMPLAINER_DEAD_LETTERS_TOKENS", "", "list of tokens to manage undelivered notifications over http with (example: token1,token2)")
+	workers := flags.Int("workers", "COMPLAINER_WORKERS", 4, "number of failures to upload logs for at once, zero reports failures one by one")
+	queueSize := flags.Int("queue-size", "COMPLAINER_QUEUE_SIZE", 100, "size of the upload queue and of the queue of every reporter instance")
+	retries := flags.Int("retries", "COMPLAINER_RETRIES", 3, "number of retries of failed uploads and reports")
+	retryBackoff := flags.Duration("retry-backoff", "COMPLAINER_RETRY_BACKOFF", time.Second, "delay before the first retry, doubled with every retry")
+	recoverAfter := flags.Duration("recover-after", "COMPLAINER_RECOVER_AFTER", 0, "time replacement tasks of failed apps must keep running to be resolved, zero disables recovery notifications")
+	recoverWithin := flags.Duration("recover-within", "COMPLAINER_RECOVER_WITHIN", time.Hour, "time after which failed apps that did not recover are forgotten")
+	recoverInterval := flags.Duration("recover-interval", "COMPLAINER_RECOVER_INTERVAL", time.Minute, "interval between checks of running tasks of failed apps, every check fetches the state of masters")
+	stream := flags.Bool("stream", "COMPLAINER_STREAM", false, "whether to subscribe to master operator api instead of polling state")
 	var whitelist regexArrayFlags
 	var blacklist regexArrayFlags
 	flag.Var(&whitelist, "framework-whitelist", "list of regexes that if a framework name matches, will be reported")
 	flag.Var(&blacklist, "framework-blacklist", "list of regexes that if a framework name matches, is ignored")
+	var attributeWhitelist attributeArrayFlags
+	var attributeBlacklist attributeArrayFlags
+	flag.Var(&attributeWhitelist, "agent-attribute-whitelist", "list of attribute=regex that if an agent attribute matches, will be reported")
+	flag.Var(&attributeBlacklist, "agent-attribute-blacklist", "list of attribute=regex that if an agent attribute matches, is ignored")
 
+	mesos.RegisterFlags()
+	kubernetes.RegisterFlags()
+	docker.RegisterFlags()
+	metronome.RegisterFlags()
+	marathon.RegisterFlags()
+	store.RegisterFlags()
+	election.RegisterFlags()
+	shard.RegisterFlags()
+	limit.RegisterFlags()
 	uploader.RegisterFlags()
 	reporter.RegisterFlags()
 
 	flag.Parse()
 
-	if *u == "" || *r == "" || *masters == "" {
+	// Pushed failures are enough on their own
+	if *u == "" || *r == "" || (*masters == "" && *clusters == "" && kubernetes.FlagConfig().URL == "" && docker.FlagSource() == nil && !metronome.FlagEnabled() && *pushTokens == "") {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
+	if *pushTokens != "" && *listen == "" && os.Getenv("PORT") == "" {
+		log.Fatalf("Pushed failures require http listen address")
+	}
+
 	um, err := uploader.MakerByName(*u)
 	if err != nil {
 		log.Fatalf("Cannot create uploader by name %q: %s", *u, err)
@@ -78,23 +141,246 @@ func main() {
 		log.Fatalf("Cannot create requested reporters: %s", err)
 	}
 
-	matcher := matcher.RegexMatcher{Whitelist: whitelist, Blacklist: blacklist}
-	cluster := mesos.NewCluster(strings.Split(*masters, ","))
+	regexMatcher := matcher.RegexMatcher{
+		Whitelist:          whitelist,
+		Blacklist:          blacklist,
+		AttributeWhitelist: attributeWhitelist,
+		AttributeBlacklist: attributeBlacklist,
+	}
+
+	failureStates, err := mesos.ParseStates(*states)
+	if err != nil {
+		log.Fatalf("Cannot parse failure states: %s", err)
+	}
+
+	sources, err := makeSources(*clusterName, *masters, *clusters)
+	if err != nil {
+		log.Fatalf("Cannot create sources: %s", err)
+	}
+
+	var failureMatcher matcher.FailureMatcher = &regexMatcher
+
+	metronomeSource, err := metronome.FlagSource(mesosClusters(sources))
+	if err != nil {
+		log.Fatalf("Cannot create metronome source: %s", err)
+	}
+
+	// Job runs are reported instead of failures of their tasks
+	if metronomeSource != nil {
+		sources = append(sources, metronomeSource)
+		failureMatcher = metronomeSource.Matcher(failureMatcher)
+	}
+
+	marathonEnricher, err := marathon.FlagEnricher()
+	if err != nil {
+		log.Fatalf("Cannot create marathon enricher: %s", err)
+	}
+
+	var enricher monitor.Enricher
+	if marathonEnricher != nil {
+		enricher = marathonEnricher
+	}
+
+	m := monitor.NewMonitor(*name, Version, sources, up, reporters, *d, failureMatcher, failureStates, enricher)
+
+	if *workers > 0 {
+		err := m.UsePipeline(monitor.PipelineConfig{
+			Workers:   *workers,
+			QueueSize: *queueSize,
+			Retries:   *retries,
+			Backoff:   *retryBackoff,
+		})
+
+		if err != nil {
+			log.Fatalf("Cannot create report pipeline: %s", err)
+		}
+	}
+
+	for framework, detector := range marathon.FlagQueueDetectors(marathonEnricher) {
+		if err := m.AddDetector(framework+"-queue", detector); err != nil {
+			log.Fatalf("Cannot add marathon queue detector: %s", err)
+		}
+	}
+
+	failureStore, windows, err := store.FlagStore()
+	if err != nil {
+		log.Fatalf("Cannot create store: %s", err)
+	}
+
+	if failureStore != nil {
+		m.UseStore(failureStore, windows)
+	}
+
+	limiter, err := limit.FlagLimiter()
+	if err != nil {
+		log.Fatalf("Cannot create rate limiter: %s", err)
+	}
+
+	if limiter != nil {
+		m.UseLimiter(limiter)
+		go m.RunDigests()
+	}
+
+	if *recoverAfter > 0 {
+		if err := m.UseRecovery(*recoverAfter, *recoverWithin, *recoverInterval); err != nil {
+			log.Fatalf("Cannot enable recovery notifications: %s", err)
+		}
+
+		go m.RunRecovery()
+	}
+
+	deadLetters, err := store.FlagDeadLetters()
+	if err != nil {
+		log.Fatalf("Cannot create dead letters: %s", err)
+	}
+
+	if deadLetters != nil {
+		tokens := []string{}
+		if *deadLettersTokens != "" {
+			tokens = strings.Split(*deadLettersTokens, ",")
+		}
+
+		m.UseDeadLetters(deadLetters, tokens)
+	}
+
+	elector, err := election.FlagElector()
+	if err != nil {
+		log.Fatalf("Cannot create leader elector: %s", err)
+	}
+
+	if elector != nil {
+		// A new leader would report everything within the catch up
+		// window again without failures reported by the previous one
+		if failureStore != nil && !store.FlagShared() {
+			log.Fatalf("Leader election requires the store file to be shared by replicas with store.shared")
+		}
 
-	m := monitor.NewMonitor(*name, Version, cluster, up, reporters, *d, &matcher)
+		m.UseElector(elector)
+		go elector.Run()
+	}
+
+	sharder, err := shard.FlagSharder()
+	if err != nil {
+		log.Fatalf("Cannot create sharder: %s", err)
+	}
+
+	if sharder != nil {
+		m.UseSharder(sharder)
+		go sharder.Run()
+	}
+
+	if *pushTokens != "" {
+		logHosts := []string{}
+		if *pushLogHosts != "" {
+			logHosts = strings.Split(*pushLogHosts, ",")
+		}
+
+		if err := m.EnablePush("push", strings.Split(*pushTokens, ","), logHosts); err != nil {
+			log.Fatalf("Cannot enable pushed failures: %s", err)
+		}
+	}
 
 	serve(m, *listen)
 
+	for _, source := range m.Sources() {
+		run := m.Run
+		if *stream && m.CanStream(source) {
+			run = m.Stream
+		}
+
+		go watch(run, source)
+	}
+
+	for _, detector := range m.Detectors() {
+		go watch(m.Run, detector)
+	}
+
+	select {}
+}
+
+func watch(run func(source string) error, source string) {
 	for {
-		err := m.Run()
+		err := run(source)
 		if err != nil {
-			log.Printf("Error running monitor: %s", err)
+			log.Printf("Error running monitor for source %s: %s", source, err)
 		}
 
 		time.Sleep(time.Second * 5)
 	}
 }
 
+func makeClusters(name, masters, file string) ([]*mesos.Cluster, error) {
+	configs := []mesos.Config{}
+
+	if file != "" {
+		read, err := mesos.ReadConfigs(file)
+		if err != nil {
+			return nil, err
+		}
+
+		configs = read
+	} else {
+		config := mesos.FlagConfig(masters)
+		config.Name = name
+		configs = append(configs, config)
+	}
+
+	clusters := []*mesos.Cluster{}
+	for _, config := range configs {
+		cluster, err := mesos.NewClusterFromConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create cluster %s: %s", config.Name, err)
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+// makeSources returns mesos clusters, kubernetes and docker if they are configured
+func makeSources(name, masters, file string) ([]monitor.Source, error) {
+	sources := []monitor.Source{}
+
+	if masters != "" || file != "" {
+		clusters, err := makeClusters(name, masters, file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create mesos clusters: %s", err)
+		}
+
+		for _, cluster := range clusters {
+			sources = append(sources, cluster)
+		}
+	}
+
+	if config := kubernetes.FlagConfig(); config.URL != "" {
+		source, err := kubernetes.NewSource(config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create kubernetes source: %s", err)
+		}
+
+		sources = append(sources, source)
+	}
+
+	if source := docker.FlagSource(); source != nil {
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// mesosClusters returns mesos clusters among sources
+func mesosClusters(sources []monitor.Source) []*mesos.Cluster {
+	clusters := []*mesos.Cluster{}
+	for _, source := range sources {
+		if cluster, ok := source.(*mesos.Cluster); ok {
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	return clusters
+}
+
 func serve(m *monitor.Monitor, listen string) {
 	if listen != "" || os.Getenv("PORT") != "" {
 		if listen == "" {
@@ -2,22 +2,122 @@ package complainer
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
-// Failure represents a failed Mesos task
+// Failure represents a failed Mesos task, Kubernetes or Docker container,
+// Metronome job run or a failure pushed over http
 type Failure struct {
 	ID        string
 	Name      string
+	Cluster   string
 	Slave     string
+	AgentID   string
+	AgentURL  string
+	AgentIP   string
+	Executor  string
 	Framework string
 	Image     string
 	State     string
+	Message   string
+	Reason    string
+	Source    string
+	ExitCode  *int
+	Signal    string
 	Started   time.Time
 	Finished  time.Time
 	Labels    map[string]string
+	Statuses  []Status
+
+	// Attributes of the Mesos agent the task ran on
+	Attributes map[string]string
+	// Resources allocated to the task
+	Resources Resources
+	// App that launched the task, if known
+	App App
+	// Job run that failed, if the failure is about a job
+	Job Job
+}
+
+// Job represents the failed run of a scheduled job
+type Job struct {
+	ID       string
+	Run      string
+	Schedule string
+	Attempt  int
+	// Task is the id of the last task of the run
+	Task string
+}
+
+// App represents the application that launched the task
+type App struct {
+	ID         string
+	Version    string
+	Deployment string
+	Instances  int
+	Labels     map[string]string
+}
+
+// Resources represents resources allocated to the task
+type Resources struct {
+	CPUs  float64
+	Mem   float64
+	Disk  float64
+	GPUs  float64
+	Ports string
+}
+
+// Status represents a single status update of the task
+type Status struct {
+	State     string
+	Message   string
+	Reason    string
+	Source    string
+	Timestamp time.Time
 }
 
 func (f Failure) String() string {
 	return fmt.Sprintf("%s (%s) from %s", f.Name, f.ID, f.Slave)
 }
+
+// Task represents the running task
+type Task struct {
+	ID        string
+	Name      string
+	Cluster   string
+	Framework string
+	Started   time.Time
+}
+
+// Digest represents failures of the app that were not reported
+// one by one because of rate limits
+type Digest struct {
+	App     string
+	Count   int
+	Agents  int
+	Window  time.Duration
+	Failure Failure
+}
+
+func (d Digest) String() string {
+	// 5m is easier to read than 5m0s
+	window := d.Window.String()
+	if strings.HasSuffix(window, "m0s") {
+		window = strings.TrimSuffix(window, "0s")
+	}
+
+	if strings.HasSuffix(window, "h0m") {
+		window = strings.TrimSuffix(window, "0m")
+	}
+
+	return fmt.Sprintf("%s failed %s on %s in the last %s", d.App, plural(d.Count, "more time"), plural(d.Agents, "agent"), window)
+}
+
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+
+	return fmt.Sprintf("%d %ss", count, noun)
+}
@@ -0,0 +1,407 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+const (
+	// framework name of failures from docker
+	framework = "docker"
+	// timeout for requests to docker that are not event streams
+	timeout = time.Second * 30
+	// docker is reached over the unix socket, the host is ignored
+	baseURL = "http://docker"
+	// how long to remember oom events for containers that did not die yet
+	oomTimeout = time.Minute
+	// StateOOMKilled is the state of containers killed for running out of memory
+	StateOOMKilled = "OOMKilled"
+	// StateOOM is the state of running containers that had a process killed
+	// for running out of memory
+	StateOOM = "OOM"
+	// StateError is the state of containers that exited with non-zero code
+	StateError = "Error"
+)
+
+// errNotFound is returned for containers that are gone
+var errNotFound = errors.New("container not found")
+
+var flagConfig = struct {
+	name   *string
+	socket *string
+}{}
+
+// RegisterFlags registers command line flags for docker source
+func RegisterFlags() {
+	flagConfig.name = flags.String("docker.name", "DOCKER_NAME", "docker", "name of the docker source")
+	flagConfig.socket = flags.String("docker.socket", "DOCKER_SOCKET", "", "path to docker unix socket to watch containers (example: /var/run/docker.sock)")
+}
+
+// FlagSource returns the source configured by command line flags,
+// nil is returned if docker socket is not configured
+func FlagSource() *Source {
+	if *flagConfig.socket == "" {
+		return nil
+	}
+
+	return NewSource(*flagConfig.name, *flagConfig.socket)
+}
+
+// Source watches docker containers that die with non-zero exit codes
+// or run out of memory
+type Source struct {
+	name         string
+	host         string
+	client       http.Client
+	streamClient http.Client
+	// since and oom are only accessed by the goroutine running Subscribe
+	since string
+	oom   map[string]time.Time
+}
+
+// NewSource creates docker source talking to docker over the unix socket
+func NewSource(name, socket string) *Source {
+	transport := &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = name
+	}
+
+	return &Source{
+		name: name,
+		host: host,
+		client: http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		// Event streams are long lived
+		streamClient: http.Client{
+			Transport: transport,
+		},
+		oom: map[string]time.Time{},
+	}
+}
+
+// Name returns the name of the source
+func (s *Source) Name() string {
+	return s.name
+}
+
+// Client returns http client that downloads and demultiplexes container logs
+func (s *Source) Client() *http.Client {
+	return &http.Client{
+		Transport: logsTransport{transport: s.client.Transport},
+	}
+}
+
+// Failures returns failures of exited containers
+func (s *Source) Failures() ([]complainer.Failure, error) {
+	query := url.Values{
+		"all":     {"1"},
+		"filters": {`{"status":["exited"]}`},
+	}
+
+	containers := []struct {
+		ID string `json:"Id"`
+	}{}
+
+	if err := s.get("/containers/json?"+query.Encode(), &containers); err != nil {
+		return nil, fmt.Errorf("cannot list containers: %s", err)
+	}
+
+	failures := []complainer.Failure{}
+	for _, c := range containers {
+		// Containers can be removed between listing and inspecting
+		container, err := s.inspect(c.ID)
+		if err == errNotFound {
+			continue
+		}
+
+		if err != nil {
+			log.Printf("Error inspecting listed container: %s", err)
+			continue
+		}
+
+		if failure, ok := s.failure(container, false); ok {
+			failures = append(failures, failure)
+		}
+	}
+
+	return failures, nil
+}
+
+// Subscribe reads docker events and sends failures of containers as they
+// happen, the subscribed callback is called once events are flowing.
+// Subscribe blocks until the stream is closed, the next call resumes
+// from the last seen event, so that failures are not missed.
+func (s *Source) Subscribe(failures chan<- complainer.Failure, subscribed func()) error {
+	query := url.Values{
+		"filters": {`{"type":["container"],"event":["die","oom"]}`},
+	}
+
+	if s.since != "" {
+		query.Set("since", s.since)
+	}
+
+	resp, err := s.streamClient.Get(baseURL + "/events?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("cannot get events: %s", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot get events: unexpected response status: %s", resp.Status)
+	}
+
+	subscribed()
+
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+		event := event{}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return fmt.Errorf("cannot decode event: %s", err)
+		}
+
+		s.since = fmt.Sprintf("%d.%09d", event.TimeNano/int64(time.Second), event.TimeNano%int64(time.Second))
+
+		if failure, ok := s.handle(event); ok {
+			failures <- failure
+		}
+	}
+}
+
+// handle turns events into failures, oom events of containers
+// that die right after are reported with the die event
+func (s *Source) handle(event event) (complainer.Failure, bool) {
+	for id, ts := range s.oom {
+		if time.Since(ts) > oomTimeout {
+			delete(s.oom, id)
+		}
+	}
+
+	// Containers started with --rm are removed right after they die
+	container, err := s.inspect(event.Actor.ID)
+	if err == errNotFound && event.Action == "die" {
+		container = removedContainer(event)
+	} else if err != nil {
+		log.Printf("Error handling %s event of %s: %s", event.Action, event.Actor.ID, err)
+		return complainer.Failure{}, false
+	}
+
+	switch event.Action {
+	case "oom":
+		if !container.State.Running {
+			s.oom[container.ID] = time.Now()
+			return complainer.Failure{}, false
+		}
+
+		failure := s.failureOf(container, StateOOM)
+		failure.ID = fmt.Sprintf("%s:oom:%d", container.ID, event.TimeNano)
+		failure.Message = "Process of the container was killed for running out of memory"
+		failure.Finished = time.Unix(0, event.TimeNano)
+
+		return failure, true
+	case "die":
+		_, oom := s.oom[container.ID]
+		delete(s.oom, container.ID)
+
+		// Restarted containers do not keep the state of the run that died
+		if code, err := strconv.Atoi(event.Actor.Attributes["exitCode"]); err == nil {
+			container.State.ExitCode = code
+		}
+
+		if container.State.Running {
+			container.State.FinishedAt = time.Unix(0, event.TimeNano)
+		}
+
+		return s.failure(container, oom)
+	}
+
+	return complainer.Failure{}, false
+}
+
+// failure returns the failure of the exited container, containers that
+// exited with zero code are not failures unless they ran out of memory
+func (s *Source) failure(container container, oom bool) (complainer.Failure, bool) {
+	oom = oom || container.State.OOMKilled
+
+	if container.State.ExitCode == 0 && !oom {
+		return complainer.Failure{}, false
+	}
+
+	state := StateError
+	if oom {
+		state = StateOOMKilled
+	}
+
+	failure := s.failureOf(container, state)
+	failure.Message = container.State.Error
+	if failure.Message == "" {
+		failure.Message = fmt.Sprintf("Container exited with code %d", container.State.ExitCode)
+	}
+
+	return failure, true
+}
+
+func (s *Source) failureOf(container container, state string) complainer.Failure {
+	exitCode := container.State.ExitCode
+
+	labels := map[string]string{}
+	for k, v := range container.Config.Labels {
+		labels[k] = v
+	}
+
+	return complainer.Failure{
+		ID:        fmt.Sprintf("%s:%d", container.ID, container.State.FinishedAt.UnixNano()),
+		Name:      strings.TrimPrefix(container.Name, "/"),
+		Cluster:   s.name,
+		Slave:     s.host,
+		Framework: framework,
+		Image:     container.Config.Image,
+		State:     state,
+		ExitCode:  &exitCode,
+		Started:   container.State.StartedAt,
+		Finished:  container.State.FinishedAt,
+		Labels:    labels,
+	}
+}
+
+// Logs returns urls of stdout and stderr of the container run
+func (s *Source) Logs(failure complainer.Failure) (string, string, error) {
+	parts := strings.SplitN(failure.ID, ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("cannot parse failure id %s", failure.ID)
+	}
+
+	query := url.Values{}
+	if !failure.Started.IsZero() && failure.Started.Unix() > 0 {
+		query.Set("since", fmt.Sprintf("%d", failure.Started.Unix()))
+	}
+
+	if !failure.Finished.IsZero() && failure.Finished.Unix() > 0 {
+		query.Set("until", fmt.Sprintf("%d", failure.Finished.Unix()+1))
+	}
+
+	logs := baseURL + "/containers/" + parts[0] + "/logs?"
+
+	stdout := url.Values{"stdout": {"1"}}
+	stderr := url.Values{"stderr": {"1"}}
+	for k, v := range query {
+		stdout[k] = v
+		stderr[k] = v
+	}
+
+	return logs + stdout.Encode(), logs + stderr.Encode(), nil
+}
+
+type event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+type container struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Running    bool      `json:"Running"`
+		OOMKilled  bool      `json:"OOMKilled"`
+		ExitCode   int       `json:"ExitCode"`
+		Error      string    `json:"Error"`
+		StartedAt  time.Time `json:"StartedAt"`
+		FinishedAt time.Time `json:"FinishedAt"`
+	} `json:"State"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// removedContainer returns the container that is gone from the attributes
+// of its die event, docker adds container labels to the attributes
+func removedContainer(event event) container {
+	container := container{ID: event.Actor.ID}
+	container.Name = event.Actor.Attributes["name"]
+	container.Config.Image = event.Actor.Attributes["image"]
+	container.State.FinishedAt = time.Unix(0, event.TimeNano)
+	container.Config.Labels = map[string]string{}
+
+	for k, v := range event.Actor.Attributes {
+		switch k {
+		case "name", "image", "exitCode", "execDuration", "signal":
+			continue
+		}
+
+		container.Config.Labels[k] = v
+	}
+
+	return container
+}
+
+func (s *Source) inspect(id string) (container, error) {
+	container := container{}
+	if err := s.get("/containers/"+id+"/json", &container); err != nil {
+		if err == errNotFound {
+			return container, err
+		}
+
+		return container, fmt.Errorf("cannot inspect container %s: %s", id, err)
+	}
+
+	if container.ID == "" {
+		return container, errors.New("cannot find container id in response")
+	}
+
+	return container, nil
+}
+
+func (s *Source) get(path string, v interface{}) error {
+	resp, err := s.client.Get(baseURL + path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
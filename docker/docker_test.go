@@ -0,0 +1,231 @@
+package docker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+var testContainers = map[string]string{
+	"aaa": `{"Id": "aaa", "Name": "/web", "State": {"ExitCode": 1, "StartedAt": "2016-11-24T15:00:00Z", "FinishedAt": "2016-11-24T15:00:05Z"}, "Config": {"Image": "busybox", "Labels": {"complainer_sentry_dsn": "foo"}}}`,
+	"bbb": `{"Id": "bbb", "Name": "/done", "State": {"ExitCode": 0, "FinishedAt": "2016-11-24T15:00:05Z"}, "Config": {"Image": "busybox"}}`,
+	"ccc": `{"Id": "ccc", "Name": "/hog", "State": {"ExitCode": 137, "FinishedAt": "2016-11-24T15:00:05Z"}, "Config": {"Image": "hog"}}`,
+	"ddd": `{"Id": "ddd", "Name": "/parent", "State": {"Running": true, "StartedAt": "2016-11-24T15:00:00Z"}, "Config": {"Image": "parent"}}`,
+}
+
+const testEvents = `{"Type": "container", "Action": "oom", "Actor": {"ID": "ccc"}, "timeNano": 1480000000000000001}
+{"Type": "container", "Action": "die", "Actor": {"ID": "ccc", "Attributes": {"exitCode": "137"}}, "timeNano": 1480000000000000002}
+{"Type": "container", "Action": "oom", "Actor": {"ID": "ddd"}, "timeNano": 1480000000000000003}
+{"Type": "container", "Action": "die", "Actor": {"ID": "eee", "Attributes": {"exitCode": "1", "name": "cron", "image": "alpine", "complainer_slack_channel": "#cron"}}, "timeNano": 1480000000000000004}
+{"Type": "container", "Action": "die", "Actor": {"ID": "bbb", "Attributes": {"exitCode": "0"}}, "timeNano": 1480000000000000005}
+`
+
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+
+	return append(header, payload...)
+}
+
+// testSource returns the source talking to the fake docker and the function
+// to stop the fake docker
+func testSource(t *testing.T, since *[]string) (*Source, func()) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "docker.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			fmt.Fprint(w, `[{"Id": "aaa"}, {"Id": "zzz"}, {"Id": "bbb"}]`)
+		case "/events":
+			*since = append(*since, r.URL.Query().Get("since"))
+			fmt.Fprint(w, testEvents)
+		case "/containers/aaa/logs":
+			if r.URL.Query().Get("stdout") == "1" {
+				_, _ = w.Write(append(frame(1, "hello "), frame(1, "world\n")...))
+			} else {
+				_, _ = w.Write(frame(2, "oops\n"))
+			}
+		case "/containers/ddd/logs":
+			fmt.Fprint(w, "tty output\n")
+		default:
+			var id string
+			if _, err := fmt.Sscanf(r.URL.Path, "/containers/%3s/json", &id); err == nil && testContainers[id] != "" {
+				fmt.Fprint(w, testContainers[id])
+				return
+			}
+
+			http.NotFound(w, r)
+		}
+	}))
+
+	server.Listener = listener
+	server.Start()
+
+	return NewSource("edge", socket), func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	source, stop := testSource(t, &[]string{})
+	defer stop()
+
+	failures, err := source.Failures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exitCode := 1
+	finished := time.Date(2016, 11, 24, 15, 0, 5, 0, time.UTC)
+
+	expected := []complainer.Failure{
+		{
+			ID:        fmt.Sprintf("aaa:%d", finished.UnixNano()),
+			Name:      "web",
+			Cluster:   "edge",
+			Slave:     source.host,
+			Framework: "docker",
+			Image:     "busybox",
+			State:     StateError,
+			Message:   "Container exited with code 1",
+			ExitCode:  &exitCode,
+			Started:   time.Date(2016, 11, 24, 15, 0, 0, 0, time.UTC),
+			Finished:  finished,
+			Labels:    map[string]string{"complainer_sentry_dsn": "foo"},
+		},
+	}
+
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected %#v, got %#v", expected, failures)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	since := []string{}
+	source, stop := testSource(t, &since)
+	defer stop()
+
+	for i, expectedSince := range []string{"", "1480000000.000000005"} {
+		failures := make(chan complainer.Failure, 10)
+		subscribed := false
+
+		if err := source.Subscribe(failures, func() { subscribed = true }); err != nil {
+			t.Fatal(err)
+		}
+
+		close(failures)
+
+		if !subscribed {
+			t.Errorf("expected subscribed callback to be called")
+		}
+
+		if since[i] != expectedSince {
+			t.Errorf("expected events since %q, got %q", expectedSince, since[i])
+		}
+
+		states := map[string]string{}
+		for failure := range failures {
+			states[failure.Name] = failure.State
+
+			// Removed containers are reported from attributes of die events
+			if failure.Name == "cron" {
+				exitCode := 1
+				expected := complainer.Failure{
+					ID:        "eee:1480000000000000004",
+					Name:      "cron",
+					Cluster:   "edge",
+					Slave:     failure.Slave,
+					Framework: framework,
+					Image:     "alpine",
+					State:     StateError,
+					Message:   "Container exited with code 1",
+					ExitCode:  &exitCode,
+					Finished:  time.Unix(0, 1480000000000000004),
+					Labels:    map[string]string{"complainer_slack_channel": "#cron"},
+				}
+
+				if !reflect.DeepEqual(failure, expected) {
+					t.Errorf("expected %#v, got %#v", expected, failure)
+				}
+			}
+		}
+
+		// Containers that exited with zero code are not reported
+		expected := map[string]string{"hog": StateOOMKilled, "parent": StateOOM, "cron": StateError}
+		if !reflect.DeepEqual(states, expected) {
+			t.Errorf("expected %v, got %v", expected, states)
+		}
+	}
+}
+
+func TestLogs(t *testing.T) {
+	source, stop := testSource(t, &[]string{})
+	defer stop()
+
+	table := []struct {
+		failure complainer.Failure
+		stdout  string
+		stderr  string
+	}{
+		{
+			failure: complainer.Failure{ID: "aaa:1480000005000000000", Finished: time.Unix(1480000005, 0)},
+			stdout:  "hello world\n",
+			stderr:  "oops\n",
+		},
+		{
+			failure: complainer.Failure{ID: "ddd:oom:1480000000000000003"},
+			stdout:  "tty output\n",
+			stderr:  "tty output\n",
+		},
+	}
+
+	for _, tt := range table {
+		stdoutURL, stderrURL, err := source.Logs(tt.failure)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for url, expected := range map[string]string{stdoutURL: tt.stdout, stderrURL: tt.stderr} {
+			resp, err := source.Client().Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(body) != expected {
+				t.Errorf("expected %q from %s, got %q", expected, url, body)
+			}
+		}
+	}
+
+	if _, _, err := source.Logs(complainer.Failure{ID: "aaa"}); err == nil {
+		t.Errorf("expected error for invalid failure id")
+	}
+}
@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// logsTransport demultiplexes container logs, docker prefixes every frame
+// with the stream and the size unless the container has a tty
+type logsTransport struct {
+	transport http.RoundTripper
+}
+
+func (t logsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasSuffix(req.URL.Path, "/logs") {
+		return resp, err
+	}
+
+	resp.Body = newDemuxer(resp.Body)
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+
+	return resp, nil
+}
+
+// demuxer reads payloads of log frames, logs without frames are read as is
+type demuxer struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	framed bool
+	left   uint32
+	header [8]byte
+	init   bool
+}
+
+func newDemuxer(body io.ReadCloser) *demuxer {
+	return &demuxer{body: body, reader: bufio.NewReader(body)}
+}
+
+func (d *demuxer) Read(p []byte) (int, error) {
+	if !d.init {
+		d.init = true
+
+		// Frames start with stream 0, 1 or 2 followed by three zeros
+		header, err := d.reader.Peek(len(d.header))
+		d.framed = err == nil && header[0] <= 2 && header[1] == 0 && header[2] == 0 && header[3] == 0
+	}
+
+	if !d.framed {
+		return d.reader.Read(p)
+	}
+
+	for d.left == 0 {
+		if _, err := io.ReadFull(d.reader, d.header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, io.EOF
+			}
+
+			return 0, err
+		}
+
+		d.left = binary.BigEndian.Uint32(d.header[4:])
+	}
+
+	if uint32(len(p)) > d.left {
+		p = p[:d.left]
+	}
+
+	n, err := d.reader.Read(p)
+	d.left -= uint32(n)
+
+	return n, err
+}
+
+func (d *demuxer) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,165 @@
+package election
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer/flags"
+)
+
+// ErrCanceled is returned when acquiring the lock is canceled
+var ErrCanceled = errors.New("acquiring lock canceled")
+
+// leaderMetric is 1 while this replica is the leader
+var leaderMetric = expvar.NewInt("election.leader")
+
+var flagConfig = struct {
+	lock  *string
+	id    *string
+	retry *time.Duration
+}{}
+
+// RegisterFlags registers command line flags for leader election
+func RegisterFlags() {
+	hostname, _ := os.Hostname()
+
+	flagConfig.lock = flags.String("election.lock", "ELECTION_LOCK", "", "lock to elect the leader with (example: zk://host:port,host:port/complainer or file:///var/lock/complainer)")
+	flagConfig.id = flags.String("election.id", "ELECTION_ID", hostname, "id of this replica in the election")
+	flagConfig.retry = flags.Duration("election.retry", "ELECTION_RETRY", time.Second*5, "how often to retry acquiring the lock")
+}
+
+// FlagElector returns the elector configured by command line flags,
+// nil is returned if the lock is not configured
+func FlagElector() (*Elector, error) {
+	if *flagConfig.lock == "" {
+		return nil, nil
+	}
+
+	lock, err := ParseLock(*flagConfig.lock, *flagConfig.id, *flagConfig.retry)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewElector(*flagConfig.id, lock, *flagConfig.retry), nil
+}
+
+// Lock is held by at most one replica at a time
+type Lock interface {
+	// Lock blocks until the lock is acquired or cancel is closed,
+	// the returned channel is closed when the lock is lost
+	Lock(cancel <-chan struct{}) (<-chan struct{}, error)
+	// Unlock releases the lock
+	Unlock() error
+}
+
+// ParseLock creates the lock from the spec, supported locks are
+// zk://host:port,host:port/path and file:///path
+func ParseLock(spec, id string, retry time.Duration) (Lock, error) {
+	switch {
+	case strings.HasPrefix(spec, "zk://"):
+		return newZookeeperLock(spec, id)
+	case strings.HasPrefix(spec, "file://"):
+		return newFileLock(strings.TrimPrefix(spec, "file://"), id, retry), nil
+	}
+
+	return nil, fmt.Errorf("unknown lock %q", spec)
+}
+
+// Elector keeps trying to become the leader by acquiring the lock
+type Elector struct {
+	id     string
+	lock   Lock
+	retry  time.Duration
+	leader bool
+	stop   chan struct{}
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+// NewElector creates the elector for the replica with the id
+func NewElector(id string, lock Lock, retry time.Duration) *Elector {
+	return &Elector{
+		id:    id,
+		lock:  lock,
+		retry: retry,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// ID returns the id of this replica
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// Leader reports whether this replica is the leader
+func (e *Elector) Leader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	e.leader = leader
+	e.mu.Unlock()
+
+	if leader {
+		log.Printf("Elected %s as the leader", e.id)
+		leaderMetric.Set(1)
+	} else {
+		log.Printf("Replica %s is no longer the leader", e.id)
+		leaderMetric.Set(0)
+	}
+}
+
+// Run takes part in the election until stopped
+func (e *Elector) Run() {
+	defer close(e.done)
+
+	for {
+		lost, err := e.lock.Lock(e.stop)
+		if err == ErrCanceled {
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error acquiring lock for %s: %s", e.id, err)
+
+			select {
+			case <-e.stop:
+				return
+			case <-time.After(e.retry):
+				continue
+			}
+		}
+
+		e.setLeader(true)
+
+		select {
+		case <-lost:
+			e.setLeader(false)
+		case <-e.stop:
+			e.setLeader(false)
+
+			if err := e.lock.Unlock(); err != nil {
+				log.Printf("Error releasing lock for %s: %s", e.id, err)
+			}
+
+			return
+		}
+	}
+}
+
+// Stop gives up leadership and waits for Run to return
+func (e *Elector) Stop() {
+	close(e.stop)
+	<-e.done
+}
@@ -0,0 +1,110 @@
+package election
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitLeader(t *testing.T, e *Elector, leader bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for e.Leader() != leader {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to have leader %t", e.ID(), leader)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestFileElection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := "file://" + filepath.Join(dir, "lock")
+
+	electors := []*Elector{}
+	for _, id := range []string{"first", "second"} {
+		lock, err := ParseLock(path, id, time.Millisecond*10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		electors = append(electors, NewElector(id, lock, time.Millisecond*10))
+	}
+
+	go electors[0].Run()
+	waitLeader(t, electors[0], true)
+
+	go electors[1].Run()
+	time.Sleep(time.Millisecond * 50)
+
+	if electors[1].Leader() {
+		t.Fatalf("expected only one leader")
+	}
+
+	if leaderMetric.Value() != 1 {
+		t.Errorf("expected leader metric to be 1, got %d", leaderMetric.Value())
+	}
+
+	// Stopped leader hands over the lock
+	electors[0].Stop()
+
+	if electors[0].Leader() {
+		t.Errorf("expected stopped elector to give up leadership")
+	}
+
+	waitLeader(t, electors[1], true)
+
+	// Standby replicas can be stopped while waiting for the lock
+	electors[1].Stop()
+}
+
+func TestParseLock(t *testing.T) {
+	table := []struct {
+		spec string
+		err  bool
+	}{
+		{spec: "file:///var/lock/complainer"},
+		{spec: "etcd://host:2379/complainer", err: true},
+		{spec: "zk://host:2181", err: true},
+		{spec: "zk://host:2181/", err: true},
+	}
+
+	for _, tt := range table {
+		_, err := ParseLock(tt.spec, "test", time.Second)
+		if (err != nil) != tt.err {
+			t.Errorf("unexpected error for %s: %v", tt.spec, err)
+		}
+	}
+}
+
+func TestLockNodes(t *testing.T) {
+	children := []string{
+		"_c_8d3f-lock-0000000012",
+		"_c_1a2b-lock-0000000003",
+		"unrelated",
+		"_c_ffff-lock-0000000010",
+	}
+
+	nodes := lockNodes(children)
+	expected := []string{"_c_1a2b-lock-0000000003", "_c_ffff-lock-0000000010", "_c_8d3f-lock-0000000012"}
+
+	if len(nodes) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, nodes)
+	}
+
+	for i := range nodes {
+		if nodes[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, nodes)
+		}
+	}
+}
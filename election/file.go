@@ -0,0 +1,68 @@
+package election
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileLock is the lock on a local file, it is only useful for replicas
+// running on the same host and in tests
+type fileLock struct {
+	path  string
+	id    string
+	retry time.Duration
+	file  *os.File
+}
+
+func newFileLock(path, id string, retry time.Duration) *fileLock {
+	return &fileLock{path: path, id: id, retry: retry}
+}
+
+// Lock polls for the lock until it is acquired, the lock is never lost
+func (l *fileLock) Lock(cancel <-chan struct{}) (<-chan struct{}, error) {
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if err != syscall.EWOULDBLOCK {
+			_ = file.Close()
+			return nil, err
+		}
+
+		select {
+		case <-cancel:
+			_ = file.Close()
+			return nil, ErrCanceled
+		case <-time.After(l.retry):
+		}
+	}
+
+	// The id of the leader is kept in the file for humans
+	if err := file.Truncate(0); err == nil {
+		_, _ = file.WriteAt([]byte(l.id+"\n"), 0)
+	}
+
+	l.file = file
+
+	return make(chan struct{}), nil
+}
+
+// Unlock releases the lock
+func (l *fileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
@@ -0,0 +1,236 @@
+package election
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	// zookeeperTimeout is the session timeout, the lock is lost
+	// when the session cannot be kept alive
+	zookeeperTimeout = time.Second * 10
+	// zookeeperPrefix is the prefix of lock nodes of replicas
+	zookeeperPrefix = "lock-"
+)
+
+// zookeeperLock is held by the replica with the lowest ephemeral node,
+// the lock is lost when the connection to zookeeper is lost
+type zookeeperLock struct {
+	conn *zk.Conn
+	path string
+	id   string
+	node string
+	lost chan struct{}
+	mu   sync.Mutex
+}
+
+// newZookeeperLock creates the lock from zk://host1:port,host2:port/path url
+func newZookeeperLock(zkURL, id string) (*zookeeperLock, error) {
+	hosts := strings.TrimPrefix(zkURL, "zk://")
+
+	i := strings.Index(hosts, "/")
+	if i == -1 || len(hosts) == i+1 {
+		return nil, fmt.Errorf("invalid zookeeper url %q: path expected", zkURL)
+	}
+
+	l := &zookeeperLock{
+		path: strings.TrimSuffix(hosts[i:], "/"),
+		id:   id,
+	}
+
+	conn, _, err := zk.Connect(strings.Split(hosts[:i], ","), zookeeperTimeout, zk.WithEventCallback(l.event))
+	if err != nil {
+		return nil, err
+	}
+
+	l.conn = conn
+
+	return l, nil
+}
+
+// event marks the lock lost when the session is in danger,
+// the node may still exist but another replica can get the lock
+func (l *zookeeperLock) event(event zk.Event) {
+	if event.Type != zk.EventSession || (event.State != zk.StateDisconnected && event.State != zk.StateExpired) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lost != nil {
+		close(l.lost)
+		l.lost = nil
+	}
+
+	if event.State == zk.StateExpired {
+		l.node = ""
+	}
+}
+
+// Lock creates the node and waits for the nodes before it to go away
+func (l *zookeeperLock) Lock(cancel <-chan struct{}) (<-chan struct{}, error) {
+	node, err := l.create()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		children, _, err := l.conn.Children(l.path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list %s in zookeeper: %s", l.path, err)
+		}
+
+		previous := ""
+		found := false
+		for _, child := range lockNodes(children) {
+			if child == node {
+				found = true
+				break
+			}
+
+			previous = child
+		}
+
+		if !found {
+			l.reset(node)
+			return nil, fmt.Errorf("cannot find lock node %s in zookeeper", node)
+		}
+
+		if previous == "" {
+			l.mu.Lock()
+			lost := make(chan struct{})
+			l.lost = lost
+			l.mu.Unlock()
+
+			return lost, nil
+		}
+
+		exists, _, watch, err := l.conn.ExistsW(l.path + "/" + previous)
+		if err != nil {
+			return nil, fmt.Errorf("cannot watch %s in zookeeper: %s", previous, err)
+		}
+
+		if !exists {
+			continue
+		}
+
+		select {
+		case <-cancel:
+			_ = l.Unlock()
+			return nil, ErrCanceled
+		case <-watch:
+		}
+	}
+}
+
+// create makes sure the lock node of this replica exists
+func (l *zookeeperLock) create() (string, error) {
+	l.mu.Lock()
+	node := l.node
+	l.mu.Unlock()
+
+	if node != "" {
+		return node, nil
+	}
+
+	if err := l.createPath(); err != nil {
+		return "", err
+	}
+
+	created, err := l.conn.CreateProtectedEphemeralSequential(l.path+"/"+zookeeperPrefix, []byte(l.id), zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return "", fmt.Errorf("cannot create lock node in zookeeper: %s", err)
+	}
+
+	node = created[strings.LastIndex(created, "/")+1:]
+
+	l.mu.Lock()
+	l.node = node
+	l.mu.Unlock()
+
+	return node, nil
+}
+
+// createPath creates persistent parents of lock nodes
+func (l *zookeeperLock) createPath() error {
+	path := ""
+	for _, part := range strings.Split(strings.TrimPrefix(l.path, "/"), "/") {
+		path += "/" + part
+
+		_, err := l.conn.Create(path, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return fmt.Errorf("cannot create %s in zookeeper: %s", path, err)
+		}
+	}
+
+	return nil
+}
+
+// reset forgets the node if it is still the current one
+func (l *zookeeperLock) reset(node string) {
+	l.mu.Lock()
+	if l.node == node {
+		l.node = ""
+	}
+	l.mu.Unlock()
+}
+
+// Unlock removes the lock node
+func (l *zookeeperLock) Unlock() error {
+	l.mu.Lock()
+	node := l.node
+	l.node = ""
+	l.lost = nil
+	l.mu.Unlock()
+
+	if node == "" {
+		return nil
+	}
+
+	err := l.conn.Delete(l.path+"/"+node, -1)
+	if err != nil && err != zk.ErrNoNode {
+		return fmt.Errorf("cannot delete lock node %s in zookeeper: %s", node, err)
+	}
+
+	return nil
+}
+
+// lockNodes returns lock nodes sorted by their sequence number, protected
+// nodes are named _c_<guid>-lock-<sequence>
+func lockNodes(children []string) []string {
+	nodes := []string{}
+	for _, child := range children {
+		if strings.Contains(child, zookeeperPrefix) {
+			nodes = append(nodes, child)
+		}
+	}
+
+	sort.Sort(byLockSequence(nodes))
+
+	return nodes
+}
+
+// byLockSequence sorts lock nodes by their sequence number
+type byLockSequence []string
+
+func (s byLockSequence) Len() int {
+	return len(s)
+}
+
+func (s byLockSequence) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s byLockSequence) Less(i, j int) bool {
+	return lockSequence(s[i]) < lockSequence(s[j])
+}
+
+func lockSequence(node string) string {
+	return node[strings.LastIndex(node, zookeeperPrefix)+len(zookeeperPrefix):]
+}
@@ -50,3 +50,17 @@ func Duration(name, env string, fallback time.Duration, help string) *time.Durat
 
 	return flag.Duration(name, value, help)
 }
+
+// Int registers a flag and returns the pointer to the resulting integer.
+// The default value is passed as fallback and env sets the env variable
+// that can override the default.
+func Int(name, env string, fallback int, help string) *int {
+	value := fallback
+	if v := os.Getenv(env); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			value = i
+		}
+	}
+
+	return flag.Int(name, value, help)
+}
@@ -0,0 +1,352 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+const (
+	// timeout for requests to the api server that are not watches
+	timeout = time.Second * 30
+	// how long the api server keeps watches open
+	watchTimeout = time.Minute * 5
+)
+
+// Config holds settings needed to talk to the api server
+type Config struct {
+	Name      string
+	URL       string
+	Namespace string
+	TokenFile string
+	CAFile    string
+}
+
+var flagConfig = struct {
+	name      *string
+	url       *string
+	namespace *string
+	tokenFile *string
+	caFile    *string
+}{}
+
+// RegisterFlags registers command line flags for kubernetes source
+func RegisterFlags() {
+	flagConfig.name = flags.String("k8s.name", "K8S_NAME", "kubernetes", "name of the kubernetes source")
+	flagConfig.url = flags.String("k8s.url", "K8S_URL", "", "kubernetes api server url (example: https://kubernetes.default.svc)")
+	flagConfig.namespace = flags.String("k8s.namespace", "K8S_NAMESPACE", "", "namespace to watch pods in (default is all)")
+	flagConfig.tokenFile = flags.String("k8s.token_file", "K8S_TOKEN_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/token", "path to bearer token")
+	flagConfig.caFile = flags.String("k8s.ca_file", "K8S_CA_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt", "path to CA bundle to verify api server")
+}
+
+// FlagConfig returns the config based on command line flags,
+// empty url means that kubernetes source is disabled
+func FlagConfig() Config {
+	return Config{
+		Name:      *flagConfig.name,
+		URL:       *flagConfig.url,
+		Namespace: *flagConfig.namespace,
+		TokenFile: *flagConfig.tokenFile,
+		CAFile:    *flagConfig.caFile,
+	}
+}
+
+// Source watches pods for containers that fail
+type Source struct {
+	name      string
+	url       string
+	namespace string
+	// resourceVersion and expired are only accessed by the goroutine running Subscribe
+	resourceVersion string
+	expired         bool
+	client          http.Client
+	streamClient    http.Client
+}
+
+// NewSource creates kubernetes source from the config
+func NewSource(config Config) (*Source, error) {
+	if config.URL == "" {
+		return nil, errors.New("api server url is required")
+	}
+
+	transport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		name:      config.Name,
+		url:       strings.TrimSuffix(config.URL, "/"),
+		namespace: config.Namespace,
+		client: http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		// Watches are long lived, the api server closes them on its own
+		streamClient: http.Client{
+			Transport: transport,
+		},
+	}, nil
+}
+
+func newTransport(config Config) (http.RoundTripper, error) {
+	tlsConfig := &tls.Config{}
+
+	if config.CAFile != "" && strings.HasPrefix(config.URL, "https://") {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %s", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("cannot find certificates in CA bundle %s", config.CAFile)
+		}
+	}
+
+	return &tokenTransport{
+		tokenFile: config.TokenFile,
+		transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: time.Second * 10,
+		},
+	}, nil
+}
+
+// tokenTransport adds bearer token to requests, the token is read on
+// every request since service account tokens are rotated
+type tokenTransport struct {
+	tokenFile string
+	transport http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.tokenFile == "" {
+		return t.transport.RoundTrip(req)
+	}
+
+	token, err := ioutil.ReadFile(t.tokenFile)
+	if err != nil {
+		// Running outside of the cluster without authentication
+		if os.IsNotExist(err) {
+			return t.transport.RoundTrip(req)
+		}
+
+		return nil, fmt.Errorf("cannot read token: %s", err)
+	}
+
+	// Requests must not be modified by round trippers
+	authorized := new(http.Request)
+	*authorized = *req
+
+	authorized.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		authorized.Header[k] = v
+	}
+
+	authorized.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	return t.transport.RoundTrip(authorized)
+}
+
+// Name returns the name of the source
+func (s *Source) Name() string {
+	return s.name
+}
+
+// Client returns http client that is authorized to download logs
+func (s *Source) Client() *http.Client {
+	return &http.Client{
+		Transport: s.client.Transport,
+	}
+}
+
+// Failures returns failures of containers of the known pods
+func (s *Source) Failures() ([]complainer.Failure, error) {
+	pods, err := s.pods()
+	if err != nil {
+		return nil, err
+	}
+
+	failures := []complainer.Failure{}
+	for _, pod := range pods.Items {
+		failures = append(failures, s.annotate(pod.failures())...)
+	}
+
+	return failures, nil
+}
+
+// Subscribe watches pods and sends failures of containers as they happen,
+// the subscribed callback is called once the watch is established.
+// Subscribe blocks until the watch is closed, the next call resumes
+// from the last seen pod version, so that failures are not missed.
+// Once the version expires, failures of listed pods are sent again,
+// the monitor skips the ones that were already reported.
+func (s *Source) Subscribe(failures chan<- complainer.Failure, subscribed func()) error {
+	// Failures that happened before the first watch are not reported
+	if s.resourceVersion == "" {
+		pods, err := s.pods()
+		if err != nil {
+			return err
+		}
+
+		s.resourceVersion = pods.Metadata.ResourceVersion
+
+		if s.expired {
+			s.expired = false
+
+			for _, pod := range pods.Items {
+				for _, failure := range s.annotate(pod.failures()) {
+					failures <- failure
+				}
+			}
+		}
+	}
+
+	query := url.Values{
+		"watch":           {"true"},
+		"resourceVersion": {s.resourceVersion},
+		"timeoutSeconds":  {fmt.Sprintf("%d", int(watchTimeout.Seconds()))},
+	}
+
+	resp, err := s.get(&s.streamClient, s.podsPath()+"?"+query.Encode())
+	if err != nil {
+		return fmt.Errorf("cannot watch pods: %s", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	subscribed()
+
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+		event := watchEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return fmt.Errorf("cannot decode watch event: %s", err)
+		}
+
+		if event.Type == "ERROR" {
+			// The version is too old, pods have to be listed again
+			s.resourceVersion = ""
+			s.expired = true
+			return errors.New("watch of pods expired")
+		}
+
+		s.resourceVersion = event.Object.Metadata.ResourceVersion
+
+		if event.Type != "ADDED" && event.Type != "MODIFIED" {
+			continue
+		}
+
+		for _, failure := range s.annotate(event.Object.failures()) {
+			failures <- failure
+		}
+	}
+}
+
+// Logs returns the url of container logs, kubernetes does not
+// separate stdout from stderr, so both urls are the same
+func (s *Source) Logs(failure complainer.Failure) (string, string, error) {
+	namespace, name, container, ok := parseFailureID(failure.ID)
+	if !ok {
+		return "", "", fmt.Errorf("cannot parse failure id %s", failure.ID)
+	}
+
+	resp, err := s.get(&s.client, "/api/v1/namespaces/"+namespace+"/pods/"+name)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get pod %s/%s: %s", namespace, name, err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	pod := pod{}
+	if err := json.NewDecoder(resp.Body).Decode(&pod); err != nil {
+		return "", "", err
+	}
+
+	// Logs of restarted containers are kept as previous logs
+	previous := true
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		terminated := status.State.Terminated
+		if status.Name == container && terminated != nil && failureID(namespace, name, container, terminated.ContainerID) == failure.ID {
+			previous = false
+		}
+	}
+
+	query := url.Values{
+		"container": {container},
+		"previous":  {fmt.Sprintf("%t", previous)},
+	}
+
+	logs := s.url + "/api/v1/namespaces/" + namespace + "/pods/" + name + "/log?" + query.Encode()
+
+	return logs, logs, nil
+}
+
+func (s *Source) annotate(failures []complainer.Failure) []complainer.Failure {
+	for i := range failures {
+		failures[i].Cluster = s.name
+	}
+
+	return failures
+}
+
+func (s *Source) podsPath() string {
+	if s.namespace != "" {
+		return "/api/v1/namespaces/" + s.namespace + "/pods"
+	}
+
+	return "/api/v1/pods"
+}
+
+func (s *Source) pods() (*podList, error) {
+	resp, err := s.get(&s.client, s.podsPath())
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pods: %s", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	pods := &podList{}
+
+	return pods, json.NewDecoder(resp.Body).Decode(pods)
+}
+
+// get requests the path, responses with unexpected status are closed
+func (s *Source) get(client *http.Client, path string) (*http.Response, error) {
+	resp, err := client.Get(s.url + path)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,312 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const (
+	testPods = `{
+		"metadata": {"resourceVersion": "100"},
+		"items": [
+			{
+				"metadata": {
+					"name": "web-5d8f-x2x9z",
+					"namespace": "prod",
+					"resourceVersion": "90",
+					"annotations": {"complainer.cloudflare.com/sentry-dsn": "foo", "complainer_slack_channel": "#web", "unrelated": "bar"},
+					"ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d8f"}]
+				},
+				"spec": {"nodeName": "node1"},
+				"status": {
+					"hostIP": "10.0.1.1",
+					"containerStatuses": [
+						{
+							"name": "app",
+							"image": "busybox",
+							"restartCount": 3,
+							"state": {"waiting": {"reason": "CrashLoopBackOff", "message": "back-off 40s restarting failed container"}},
+							"lastState": {"terminated": {"exitCode": 1, "reason": "Error", "startedAt": "2016-11-24T15:00:00Z", "finishedAt": "2016-11-24T15:00:05Z", "containerID": "docker://abc"}}
+						},
+						{
+							"name": "sidecar",
+							"image": "proxy",
+							"state": {"running": {"startedAt": "2016-11-24T15:00:00Z"}}
+						}
+					]
+				}
+			},
+			{
+				"metadata": {"name": "job-1", "namespace": "batch", "resourceVersion": "95"},
+				"spec": {"nodeName": "node2"},
+				"status": {
+					"containerStatuses": [
+						{"name": "ok", "image": "busybox", "state": {"terminated": {"exitCode": 0, "reason": "Completed", "containerID": "docker://def"}}},
+						{"name": "oom", "image": "busybox", "state": {"terminated": {"exitCode": 137, "signal": 9, "reason": "OOMKilled", "containerID": "docker://ghi"}}}
+					]
+				}
+			}
+		]
+	}`
+
+	testWatchEvents = `{"type": "MODIFIED", "object": {"metadata": {"name": "worker", "namespace": "prod", "resourceVersion": "101"}, "status": {"containerStatuses": [{"name": "app", "state": {"terminated": {"exitCode": 2, "containerID": "containerd://jkl"}}}]}}}
+{"type": "DELETED", "object": {"metadata": {"name": "job-1", "namespace": "batch", "resourceVersion": "102"}, "status": {"containerStatuses": [{"name": "oom", "state": {"terminated": {"exitCode": 137, "reason": "OOMKilled", "containerID": "docker://ghi"}}}]}}}
+`
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func testServer(t *testing.T, watches *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/pods" && r.URL.Query().Get("watch") == "true":
+			*watches = append(*watches, r.URL.Query().Get("resourceVersion"))
+			fmt.Fprint(w, testWatchEvents)
+		case r.URL.Path == "/api/v1/pods":
+			fmt.Fprint(w, testPods)
+		case r.URL.Path == "/api/v1/namespaces/prod/pods/web-5d8f-x2x9z":
+			pods := podList{}
+			if err := json.Unmarshal([]byte(testPods), &pods); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := json.NewEncoder(w).Encode(pods.Items[0]); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestFailures(t *testing.T) {
+	server := testServer(t, &[]string{})
+	defer server.Close()
+
+	source, err := NewSource(Config{Name: "k8s", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := source.Failures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []complainer.Failure{
+		{
+			ID:        "prod/web-5d8f-x2x9z/app/abc",
+			Name:      "prod/web-5d8f/app",
+			Cluster:   "k8s",
+			Slave:     "node1",
+			AgentIP:   "10.0.1.1",
+			Framework: "kubernetes",
+			Image:     "busybox",
+			State:     "CrashLoopBackOff",
+			Message:   "back-off 40s restarting failed container",
+			Reason:    "Error",
+			ExitCode:  intPtr(1),
+			Started:   time.Date(2016, 11, 24, 15, 0, 0, 0, time.UTC),
+			Finished:  time.Date(2016, 11, 24, 15, 0, 5, 0, time.UTC),
+			Labels:    map[string]string{"complainer_sentry_dsn": "foo", "complainer_slack_channel": "#web"},
+		},
+		{
+			ID:        "batch/job-1/oom/ghi",
+			Name:      "batch/job-1/oom",
+			Cluster:   "k8s",
+			Slave:     "node2",
+			Framework: "kubernetes",
+			Image:     "busybox",
+			State:     "OOMKilled",
+			Reason:    "OOMKilled",
+			ExitCode:  intPtr(137),
+			Signal:    "killed",
+			Labels:    map[string]string{},
+		},
+	}
+
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected %#v, got %#v", expected, failures)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	watches := []string{}
+
+	server := testServer(t, &watches)
+	defer server.Close()
+
+	source, err := NewSource(Config{Name: "k8s", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, version := range []string{"100", "102"} {
+		failures := make(chan complainer.Failure, 10)
+		subscribed := false
+
+		if err := source.Subscribe(failures, func() { subscribed = true }); err != nil {
+			t.Fatal(err)
+		}
+
+		close(failures)
+
+		if !subscribed {
+			t.Errorf("expected subscribed callback to be called")
+		}
+
+		if watches[i] != version {
+			t.Errorf("expected watch %d from version %s, got %s", i, version, watches[i])
+		}
+
+		ids := []string{}
+		for failure := range failures {
+			ids = append(ids, failure.ID)
+		}
+
+		// Failures from the list and from deleted pods are not sent
+		if !reflect.DeepEqual(ids, []string{"prod/worker/app/jkl"}) {
+			t.Errorf("unexpected failures: %v", ids)
+		}
+	}
+}
+
+func TestSubscribeExpired(t *testing.T) {
+	lists := []string{
+		`{"metadata": {"resourceVersion": "100"}, "items": []}`,
+		`{"metadata": {"resourceVersion": "200"}, "items": [{"metadata": {"name": "worker", "namespace": "prod"}, "status": {"containerStatuses": [{"name": "app", "state": {"terminated": {"exitCode": 2, "containerID": "containerd://jkl"}}}]}}]}`,
+	}
+
+	watches := []string{
+		`{"type": "ERROR", "object": {"kind": "Status", "code": 410, "reason": "Expired"}}`,
+		``,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "true" {
+			fmt.Fprint(w, watches[0])
+			watches = watches[1:]
+			return
+		}
+
+		fmt.Fprint(w, lists[0])
+		lists = lists[1:]
+	}))
+	defer server.Close()
+
+	source, err := NewSource(Config{Name: "k8s", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures := make(chan complainer.Failure, 10)
+
+	if err := source.Subscribe(failures, func() {}); err == nil {
+		t.Errorf("expected error for expired watch")
+	}
+
+	// Failures of pods listed again are sent once the watch expires
+	if err := source.Subscribe(failures, func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	close(failures)
+
+	ids := []string{}
+	for failure := range failures {
+		ids = append(ids, failure.ID)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"prod/worker/app/jkl"}) {
+		t.Errorf("unexpected failures: %v", ids)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	server := testServer(t, &[]string{})
+	defer server.Close()
+
+	source, err := NewSource(Config{Name: "k8s", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := source.Logs(complainer.Failure{ID: "prod/web-5d8f-x2x9z/app/abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := server.URL + "/api/v1/namespaces/prod/pods/web-5d8f-x2x9z/log?container=app&previous=true"
+	if stdout != expected || stderr != expected {
+		t.Errorf("expected %s for both logs, got %s and %s", expected, stdout, stderr)
+	}
+
+	if _, _, err := source.Logs(complainer.Failure{ID: "prod/gone/app/abc"}); err == nil {
+		t.Errorf("expected error for missing pod")
+	}
+}
+
+func TestTokenTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	token := filepath.Join(dir, "token")
+
+	source, err := NewSource(Config{URL: server.URL, TokenFile: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing token means no authentication, rotated token is picked up
+	for _, content := range []string{"", "first", "second\n"} {
+		if content != "" {
+			if err := ioutil.WriteFile(token, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		resp, err := source.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := ""
+		if content != "" {
+			expected = "Bearer " + strings.TrimSpace(content)
+		}
+
+		if string(header) != expected {
+			t.Errorf("expected authorization %q, got %q", expected, header)
+		}
+	}
+}
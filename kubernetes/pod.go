@@ -0,0 +1,208 @@
+package kubernetes
+
+import (
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const (
+	// framework name of failures from kubernetes
+	framework = "kubernetes"
+	// waiting reason of containers that keep crashing
+	crashLoopBackOff = "CrashLoopBackOff"
+	// termination reason of containers killed for running out of memory
+	oomKilled = "OOMKilled"
+	// prefix of annotations that are mapped onto complainer labels:
+	// complainer.cloudflare.com/sentry-dsn becomes complainer_sentry_dsn
+	annotationPrefix = "complainer.cloudflare.com/"
+)
+
+type podList struct {
+	Metadata listMeta `json:"metadata"`
+	Items    []pod    `json:"items"`
+}
+
+type listMeta struct {
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type watchEvent struct {
+	Type   string `json:"type"`
+	Object pod    `json:"object"`
+}
+
+type pod struct {
+	Metadata podMeta   `json:"metadata"`
+	Spec     podSpec   `json:"spec"`
+	Status   podStatus `json:"status"`
+}
+
+type podMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	OwnerReferences []ownerReference  `json:"ownerReferences"`
+}
+
+type ownerReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type podSpec struct {
+	NodeName string `json:"nodeName"`
+}
+
+type podStatus struct {
+	HostIP                string            `json:"hostIP"`
+	InitContainerStatuses []containerStatus `json:"initContainerStatuses"`
+	ContainerStatuses     []containerStatus `json:"containerStatuses"`
+}
+
+type containerStatus struct {
+	Name         string         `json:"name"`
+	Image        string         `json:"image"`
+	RestartCount int            `json:"restartCount"`
+	State        containerState `json:"state"`
+	LastState    containerState `json:"lastState"`
+}
+
+type containerState struct {
+	Waiting    *containerWaiting    `json:"waiting"`
+	Terminated *containerTerminated `json:"terminated"`
+}
+
+type containerWaiting struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+type containerTerminated struct {
+	ExitCode    int       `json:"exitCode"`
+	Signal      int       `json:"signal"`
+	Reason      string    `json:"reason"`
+	Message     string    `json:"message"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	ContainerID string    `json:"containerID"`
+}
+
+// failures returns failures of pod containers that crashed, got killed
+// for running out of memory or exited with non-zero code
+func (p pod) failures() []complainer.Failure {
+	failures := []complainer.Failure{}
+
+	for _, status := range append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...) {
+		if failure, ok := p.failure(status); ok {
+			failures = append(failures, failure)
+		}
+	}
+
+	return failures
+}
+
+func (p pod) failure(status containerStatus) (complainer.Failure, bool) {
+	state := ""
+	terminated := status.State.Terminated
+
+	if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOff {
+		state = crashLoopBackOff
+		terminated = status.LastState.Terminated
+	}
+
+	if terminated == nil || terminated.ContainerID == "" {
+		return complainer.Failure{}, false
+	}
+
+	if state == "" {
+		if terminated.ExitCode == 0 && terminated.Reason != oomKilled {
+			return complainer.Failure{}, false
+		}
+
+		state = terminated.Reason
+		if state == "" {
+			state = "Error"
+		}
+	}
+
+	exitCode := terminated.ExitCode
+
+	failure := complainer.Failure{
+		ID:        failureID(p.Metadata.Namespace, p.Metadata.Name, status.Name, terminated.ContainerID),
+		Name:      p.Metadata.Namespace + "/" + p.owner() + "/" + status.Name,
+		Slave:     p.Spec.NodeName,
+		AgentIP:   p.Status.HostIP,
+		Framework: framework,
+		Image:     status.Image,
+		State:     state,
+		Message:   terminated.Message,
+		Reason:    terminated.Reason,
+		ExitCode:  &exitCode,
+		Started:   terminated.StartedAt,
+		Finished:  terminated.FinishedAt,
+		Labels:    p.labels(),
+	}
+
+	if failure.Message == "" && status.State.Waiting != nil {
+		failure.Message = status.State.Waiting.Message
+	}
+
+	if terminated.Signal != 0 {
+		failure.Signal = syscall.Signal(terminated.Signal).String()
+	}
+
+	return failure, true
+}
+
+// owner returns the name of the pod owner, which is the app for reporting
+func (p pod) owner() string {
+	for _, owner := range p.Metadata.OwnerReferences {
+		if owner.Name != "" {
+			return owner.Name
+		}
+	}
+
+	return p.Metadata.Name
+}
+
+// labels maps pod annotations onto complainer labels, annotations
+// that are named like complainer labels are used as is
+func (p pod) labels() map[string]string {
+	labels := map[string]string{}
+
+	for k, v := range p.Metadata.Annotations {
+		switch {
+		case strings.HasPrefix(k, annotationPrefix):
+			labels["complainer_"+strings.Replace(strings.TrimPrefix(k, annotationPrefix), "-", "_", -1)] = v
+		case strings.HasPrefix(k, "complainer_"):
+			labels[k] = v
+		}
+	}
+
+	return labels
+}
+
+// failureID identifies container termination, container ids are unique
+// for every run of the container
+func failureID(namespace, pod, container, containerID string) string {
+	if i := strings.Index(containerID, "://"); i != -1 {
+		containerID = containerID[i+3:]
+	}
+
+	return strings.Join([]string{namespace, pod, container, containerID}, "/")
+}
+
+// parseFailureID returns namespace, pod and container of the failure
+func parseFailureID(id string) (string, string, string, bool) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 4 {
+		return "", "", "", false
+	}
+
+	return parts[0], parts[1], parts[2], true
+}
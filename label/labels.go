@@ -77,6 +77,25 @@ func (l Labels) InstanceLabel(reporter, instance, name string) string {
 	return ""
 }
 
+// Label returns value of the label for the complainer instance itself
+func (l Labels) Label(name string) string {
+	// complainer_default_states
+	keys := []string{fmt.Sprintf("complainer_%s_%s", l.complainer, name)}
+
+	if l.complainer == DefaultInstance {
+		// complainer_states
+		keys = append(keys, fmt.Sprintf("complainer_%s", name))
+	}
+
+	for _, k := range keys {
+		if l.labels[k] != "" {
+			return l.labels[k]
+		}
+	}
+
+	return ""
+}
+
 func (l Labels) String() string {
 	return fmt.Sprintf("%s (%v)", l.complainer, l.labels)
 }
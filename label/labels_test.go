@@ -168,3 +168,23 @@ func TestTable(t *testing.T) {
 		}
 	}
 }
+
+func TestLabel(t *testing.T) {
+	labels := map[string]string{
+		"complainer_states":         "TASK_FAILED",
+		"complainer_dogfood_states": "TASK_KILLED",
+	}
+
+	table := map[string]string{
+		"default": "TASK_FAILED",
+		"dogfood": "TASK_KILLED",
+		"other":   "",
+	}
+
+	for complainer, expected := range table {
+		l := NewLabels(complainer, labels, true)
+		if got := l.Label("states"); got != expected {
+			t.Errorf("invalid label for %v [label=states]; expected: %q, got: %q", l, expected, got)
+		}
+	}
+}
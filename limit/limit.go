@@ -0,0 +1,329 @@
+package limit
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/label"
+)
+
+var flagConfig = struct {
+	app      *string
+	reporter *string
+	global   *string
+	window   *time.Duration
+}{}
+
+// RegisterFlags registers command line flags for rate limits
+func RegisterFlags() {
+	flagConfig.app = flags.String("limit.app", "LIMIT_APP", "", "how many failures of every app every reporter instance reports (example: 10/5m)")
+	flagConfig.reporter = flags.String("limit.reporter", "LIMIT_REPORTER", "", "how many failures every reporter instance reports (example: 100/5m)")
+	flagConfig.global = flags.String("limit.global", "LIMIT_GLOBAL", "", "how many failures are reported in total by any reporter instance (example: 500/5m)")
+	flagConfig.window = flags.Duration("limit.digest", "LIMIT_DIGEST", time.Minute*5, "how long to collect failures over limits before sending the digest")
+}
+
+// FlagLimiter returns the limiter configured by command line flags,
+// nil is returned if no limits are configured
+func FlagLimiter() (*Limiter, error) {
+	if *flagConfig.app == "" && *flagConfig.reporter == "" && *flagConfig.global == "" {
+		return nil, nil
+	}
+
+	rates := []Rate{}
+	for _, spec := range []string{*flagConfig.app, *flagConfig.reporter, *flagConfig.global} {
+		rate, err := ParseRate(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return NewLimiter(rates[0], rates[1], rates[2], *flagConfig.window), nil
+}
+
+// Rate is the number of events allowed per period, bursts of up to
+// count events are allowed, zero count means no limit
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseRate parses rates in count/period format, empty rate means no limit
+func ParseRate(spec string) (Rate, error) {
+	if spec == "" {
+		return Rate{}, nil
+	}
+
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate %q: count/period expected", spec)
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 0 {
+		return Rate{}, fmt.Errorf("invalid count in rate %q", spec)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("invalid period in rate %q", spec)
+	}
+
+	return Rate{Count: count, Period: period}, nil
+}
+
+func (r Rate) unlimited() bool {
+	return r.Count == 0
+}
+
+// bucket is the token bucket that is refilled at the rate
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (b *bucket) refill(rate Rate, now time.Time) {
+	b.tokens += now.Sub(b.updated).Seconds() * float64(rate.Count) / rate.Period.Seconds()
+	if b.tokens > float64(rate.Count) {
+		b.tokens = float64(rate.Count)
+	}
+
+	b.updated = now
+}
+
+// Digest is the digest of failures that were over limits
+// for the reporter instance
+type Digest struct {
+	complainer.Digest
+
+	Reporter string
+	Instance string
+	started  time.Time
+	agents   map[string]bool
+}
+
+// Limiter limits notifications per app and reporter instance, per reporter
+// instance and globally, failures over limits are collected into digests
+type Limiter struct {
+	app      Rate
+	reporter Rate
+	global   Rate
+	window   time.Duration
+	buckets  map[string]*bucket
+	rates    map[string]Rate
+	digests  map[string]*Digest
+	mu       sync.Mutex
+}
+
+// NewLimiter creates the limiter with default limits, digests are sent
+// once the window passes since the first failure over limits
+func NewLimiter(app, reporter, global Rate, window time.Duration) *Limiter {
+	return &Limiter{
+		app:      app,
+		reporter: reporter,
+		global:   global,
+		window:   window,
+		buckets:  map[string]*bucket{},
+		rates:    map[string]Rate{},
+		digests:  map[string]*Digest{},
+	}
+}
+
+// Window returns how long failures are collected into digests
+func (l *Limiter) Window() time.Duration {
+	return l.window
+}
+
+// Target is the reporter instance to report failures with
+type Target struct {
+	Reporter string
+	Instance string
+}
+
+// Allow returns targets that can report the failure, failures that are not
+// allowed are added to digests of targets. The global limit is charged once
+// for the failure if any target reports it.
+// Labels limit_app and limit_reporter override default limits.
+func (l *Limiter) Allow(failure complainer.Failure, targets []Target, labels label.Labels) []Target {
+	return l.allow(failure, targets, labels, time.Now())
+}
+
+func (l *Limiter) allow(failure complainer.Failure, targets []Target, labels label.Labels, now time.Time) []Target {
+	app := App(failure)
+
+	keys := make([]map[string]Rate, len(targets))
+	for i, t := range targets {
+		keys[i] = map[string]Rate{
+			"app/" + t.Reporter + "/" + t.Instance + "/" + app: l.rate(labels, t.Reporter, t.Instance, "limit_app", l.app),
+			"reporter/" + t.Reporter + "/" + t.Instance:        l.rate(labels, t.Reporter, t.Instance, "limit_reporter", l.reporter),
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	global := map[string]Rate{"global": l.global}
+
+	// Tokens are only taken if every bucket of the target has one
+	allowed := []Target{}
+	for i, t := range targets {
+		if !l.available(global, now) || !l.available(keys[i], now) {
+			l.collect(failure, t, app, now)
+			continue
+		}
+
+		l.take(keys[i])
+		allowed = append(allowed, t)
+	}
+
+	if len(allowed) > 0 {
+		l.take(global)
+	}
+
+	return allowed
+}
+
+// available reports whether every bucket of keys has a token
+func (l *Limiter) available(keys map[string]Rate, now time.Time) bool {
+	available := true
+	for key, rate := range keys {
+		if rate.unlimited() {
+			continue
+		}
+
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(rate.Count), updated: now}
+			l.buckets[key] = b
+		}
+
+		l.rates[key] = rate
+		b.refill(rate, now)
+
+		if b.tokens < 1 {
+			available = false
+		}
+	}
+
+	return available
+}
+
+// take takes a token from every bucket of keys
+func (l *Limiter) take(keys map[string]Rate) {
+	for key, rate := range keys {
+		if !rate.unlimited() {
+			l.buckets[key].tokens--
+		}
+	}
+}
+
+// collect adds the failure to the digest of the target
+func (l *Limiter) collect(failure complainer.Failure, t Target, app string, now time.Time) {
+	key := t.Reporter + "/" + t.Instance + "/" + app
+	digest, ok := l.digests[key]
+	if !ok {
+		digest = &Digest{
+			Digest:   complainer.Digest{App: app, Window: l.window},
+			Reporter: t.Reporter,
+			Instance: t.Instance,
+			started:  now,
+			agents:   map[string]bool{},
+		}
+
+		l.digests[key] = digest
+	}
+
+	digest.Count++
+	digest.Failure = failure
+	if failure.Slave != "" {
+		digest.agents[failure.Slave] = true
+	}
+
+	digest.Agents = len(digest.agents)
+}
+
+// rate returns the rate from the label of the reporter instance or of the
+// complainer instance, the fallback is returned if labels are not set
+func (l *Limiter) rate(labels label.Labels, reporter, instance, name string, fallback Rate) Rate {
+	spec := labels.InstanceLabel(reporter, instance, name)
+	if spec == "" {
+		spec = labels.Label(name)
+	}
+
+	if spec == "" {
+		return fallback
+	}
+
+	rate, err := ParseRate(spec)
+	if err != nil {
+		log.Printf("Error parsing %s label: %s", name, err)
+		return fallback
+	}
+
+	return rate
+}
+
+// Digests returns digests with windows that passed and forgets them
+func (l *Limiter) Digests() []Digest {
+	return l.digestsAt(time.Now())
+}
+
+func (l *Limiter) digestsAt(now time.Time) []Digest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	digests := []Digest{}
+	for key, digest := range l.digests {
+		if now.Sub(digest.started) < l.window {
+			continue
+		}
+
+		digests = append(digests, *digest)
+		delete(l.digests, key)
+	}
+
+	sort.Sort(byStarted(digests))
+
+	// Full buckets are the same as missing ones
+	for key, b := range l.buckets {
+		b.refill(l.rates[key], now)
+		if b.tokens >= float64(l.rates[key].Count) {
+			delete(l.buckets, key)
+			delete(l.rates, key)
+		}
+	}
+
+	return digests
+}
+
+// byStarted sorts digests by the start of their window
+type byStarted []Digest
+
+func (d byStarted) Len() int {
+	return len(d)
+}
+
+func (d byStarted) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+}
+
+func (d byStarted) Less(i, j int) bool {
+	return d[i].started.Before(d[j].started)
+}
+
+// App returns the name of the app the failure belongs to
+func App(failure complainer.Failure) string {
+	if failure.App.ID != "" {
+		return failure.App.ID
+	}
+
+	return failure.Name
+}
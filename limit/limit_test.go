@@ -0,0 +1,133 @@
+package limit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/label"
+)
+
+func TestParseRate(t *testing.T) {
+	table := []struct {
+		spec string
+		rate Rate
+		err  bool
+	}{
+		{spec: "", rate: Rate{}},
+		{spec: "10/5m", rate: Rate{Count: 10, Period: time.Minute * 5}},
+		{spec: "0/1s", rate: Rate{Period: time.Second}},
+		{spec: "10", err: true},
+		{spec: "ten/5m", err: true},
+		{spec: "10/soon", err: true},
+		{spec: "-1/5m", err: true},
+	}
+
+	for _, tt := range table {
+		rate, err := ParseRate(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("unexpected error for %q: %v", tt.spec, err)
+		}
+
+		if rate != tt.rate {
+			t.Errorf("expected %+v for %q, got %+v", tt.rate, tt.spec, rate)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Rate{Count: 2, Period: time.Minute}, Rate{}, Rate{Count: 6, Period: time.Hour}, time.Minute*5)
+
+	now := time.Now()
+	noLabels := label.NewLabels("default", map[string]string{}, true)
+
+	allowed := func(failure complainer.Failure, reporter string, labels label.Labels, at time.Time) bool {
+		return len(l.allow(failure, []Target{{Reporter: reporter, Instance: "default"}}, labels, at)) == 1
+	}
+
+	web := complainer.Failure{Name: "web", Slave: "agent1"}
+	api := complainer.Failure{Name: "api", Slave: "agent1", App: complainer.App{ID: "/prod/api"}}
+
+	// Every app gets its own bucket for every reporter instance
+	results := []bool{
+		allowed(web, "slack", noLabels, now),
+		allowed(web, "slack", noLabels, now),
+		allowed(web, "slack", noLabels, now),
+		allowed(web, "sentry", noLabels, now),
+		allowed(api, "slack", noLabels, now),
+	}
+
+	if !reflect.DeepEqual(results, []bool{true, true, false, true, true}) {
+		t.Errorf("unexpected results: %v", results)
+	}
+
+	// Buckets are refilled over time
+	web.Slave = "agent2"
+	if !allowed(web, "slack", noLabels, now.Add(time.Second*30)) {
+		t.Errorf("expected web to be allowed after refill")
+	}
+
+	// Labels override limits, buckets are refilled at the new rate
+	faster := label.NewLabels("default", map[string]string{"complainer_slack_limit_app": "60/1m"}, true)
+	if !allowed(web, "slack", faster, now.Add(time.Second*31)) {
+		t.Errorf("expected web to be allowed with higher limit")
+	}
+
+	// Global limit applies to all reporters and apps
+	if allowed(api, "sentry", noLabels, now.Add(time.Second*31)) {
+		t.Errorf("expected global limit to apply")
+	}
+
+	if digests := l.digestsAt(now.Add(time.Minute)); len(digests) != 0 {
+		t.Errorf("expected no digests before the window passes, got %+v", digests)
+	}
+
+	digests := l.digestsAt(now.Add(time.Minute * 6))
+	if len(digests) != 2 {
+		t.Fatalf("expected 2 digests, got %+v", digests)
+	}
+
+	expected := []string{
+		"web failed 1 more time on 1 agent in the last 5m",
+		"/prod/api failed 1 more time on 1 agent in the last 5m",
+	}
+
+	for i, digest := range digests {
+		if digest.Instance != "default" || digest.String() != expected[i] {
+			t.Errorf("expected %q, got %+v", expected[i], digest)
+		}
+	}
+
+	if digests[0].Reporter != "slack" || digests[1].Reporter != "sentry" {
+		t.Errorf("unexpected reporters of digests: %s, %s", digests[0].Reporter, digests[1].Reporter)
+	}
+
+	if digests := l.digestsAt(now.Add(time.Minute * 10)); len(digests) != 0 {
+		t.Errorf("expected digests to be sent once, got %+v", digests)
+	}
+}
+
+func TestLimiterGlobal(t *testing.T) {
+	l := NewLimiter(Rate{}, Rate{}, Rate{Count: 2, Period: time.Hour}, time.Minute*5)
+
+	now := time.Now()
+	noLabels := label.NewLabels("default", map[string]string{}, true)
+
+	targets := []Target{{Reporter: "slack", Instance: "default"}, {Reporter: "sentry", Instance: "default"}}
+
+	// Global limit is charged once for every failure reported by any target
+	for _, name := range []string{"web", "api"} {
+		if allowed := l.allow(complainer.Failure{Name: name}, targets, noLabels, now); !reflect.DeepEqual(allowed, targets) {
+			t.Errorf("expected %s to be allowed with %+v, got %+v", name, targets, allowed)
+		}
+	}
+
+	if allowed := l.allow(complainer.Failure{Name: "db"}, targets, noLabels, now); len(allowed) != 0 {
+		t.Errorf("expected global limit to apply, got %+v", allowed)
+	}
+
+	if digests := l.digestsAt(now.Add(time.Minute * 6)); len(digests) != 2 {
+		t.Errorf("expected digests for both targets, got %+v", digests)
+	}
+}
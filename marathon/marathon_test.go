@@ -0,0 +1,104 @@
+package marathon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestAppID(t *testing.T) {
+	table := []struct {
+		taskID string
+		appID  string
+		ok     bool
+	}{
+		{
+			taskID: "web.5b6c7d8e-ace1-11e7-8e38-0242ac110002",
+			appID:  "/web",
+			ok:     true,
+		},
+		{
+			taskID: "group_sub.group_web.5b6c7d8e-ace1-11e7-8e38-0242ac110002",
+			appID:  "/group/sub.group/web",
+			ok:     true,
+		},
+		{
+			taskID: "group_web.instance-5b6c7d8e-ace1-11e7-8e38-0242ac110002._app.1",
+			appID:  "/group/web",
+			ok:     true,
+		},
+		{
+			taskID: "ct:1507599400000:0:nightly:",
+		},
+	}
+
+	for _, tt := range table {
+		appID, ok := AppID(tt.taskID)
+		if ok != tt.ok || appID != tt.appID {
+			t.Errorf("Unexpected app id %q (%v) for %s, expected %q (%v)", appID, ok, tt.taskID, tt.appID, tt.ok)
+		}
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if r.URL.Path != "/v2/apps/group/web" || r.URL.Query().Get("embed") != "app.deployments" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"app": {
+			"id": "/group/web",
+			"version": "2017-10-10T01:02:03.456Z",
+			"instances": 3,
+			"labels": {"team": "web"},
+			"deployments": [{"id": "97c136bf-5a28-4821-9d94-480d9fbb01c8"}]
+		}}`))
+	}))
+
+	defer server.Close()
+
+	enricher, err := NewEnricher("marathon="+server.URL+"/", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		failure, err := enricher.Enrich(complainer.Failure{ID: "group_web.5b6c7d8e-ace1-11e7-8e38-0242ac110002", Framework: "marathon"})
+		if err != nil {
+			t.Fatalf("Error enriching failure: %s", err)
+		}
+
+		expected := complainer.App{
+			ID:         "/group/web",
+			Version:    "2017-10-10T01:02:03.456Z",
+			Deployment: "97c136bf-5a28-4821-9d94-480d9fbb01c8",
+			Instances:  3,
+		}
+
+		app := failure.App
+		if app.ID != expected.ID || app.Version != expected.Version || app.Deployment != expected.Deployment || app.Instances != expected.Instances || app.Labels["team"] != "web" {
+			t.Errorf("Unexpected app %+v, expected %+v", app, expected)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected app to be requested once, requested %d times", requests)
+	}
+
+	failure, err := enricher.Enrich(complainer.Failure{ID: "nightly.5b6c7d8e-ace1-11e7-8e38-0242ac110002", Framework: "chronos"})
+	if err != nil || failure.App.ID != "" {
+		t.Errorf("Expected failure from other frameworks to be left intact, got %+v, %v", failure.App, err)
+	}
+
+	if _, err := enricher.Enrich(complainer.Failure{ID: "db.5b6c7d8e-ace1-11e7-8e38-0242ac110002", Framework: "marathon"}); err == nil {
+		t.Errorf("Expected error enriching failure of unknown app")
+	}
+}
@@ -0,0 +1,161 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const (
+	// StateDelayed is the state of apps in launch backoff
+	StateDelayed = "APP_DELAYED"
+	// StateOverdue is the state of apps with launches overdue
+	StateOverdue = "APP_OVERDUE"
+)
+
+// QueueDetector finds apps that are stuck in the launch queue of marathon,
+// either delayed after failed launches or overdue waiting for offers
+type QueueDetector struct {
+	framework string
+	client    *Client
+	minDelay  time.Duration
+	seen      map[string]bool
+	owns      func(failure complainer.Failure) bool
+	mu        sync.Mutex
+}
+
+// NewQueueDetector creates queue detector for the framework, apps are only
+// reported when they are delayed for at least min delay
+func NewQueueDetector(framework string, client *Client, minDelay time.Duration) *QueueDetector {
+	return &QueueDetector{
+		framework: framework,
+		client:    client,
+		minDelay:  minDelay,
+		seen:      map[string]bool{},
+	}
+}
+
+// QueueDetectors returns queue detectors for all frameworks of the enricher
+func (e *Enricher) QueueDetectors(minDelay time.Duration) map[string]*QueueDetector {
+	detectors := map[string]*QueueDetector{}
+	for framework, client := range e.clients {
+		detectors[framework] = NewQueueDetector(framework, client, minDelay)
+	}
+
+	return detectors
+}
+
+// UseOwner makes the detector return stuck apps that are not owned every
+// time, so that they are returned once their shards move here
+func (d *QueueDetector) UseOwner(owns func(failure complainer.Failure) bool) {
+	d.mu.Lock()
+	d.owns = owns
+	d.mu.Unlock()
+}
+
+// Failures returns failures for apps that got stuck in the queue since the
+// last call, every app is reported once until it leaves the queue
+func (d *QueueDetector) Failures() ([]complainer.Failure, error) {
+	queue, err := d.client.queue()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get queue from marathon: %s", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	seen := map[string]bool{}
+	failures := []complainer.Failure{}
+
+	for _, item := range queue.Queue {
+		state := ""
+		message := ""
+
+		switch {
+		case item.Delay.Overdue:
+			state = StateOverdue
+			message = fmt.Sprintf("Launch of %d instances of %s is overdue since %s", item.Count, item.App.ID, item.Since)
+		case time.Duration(item.Delay.TimeLeftSeconds)*time.Second >= d.minDelay && item.Delay.TimeLeftSeconds > 0:
+			state = StateDelayed
+			message = fmt.Sprintf("Launch of %d instances of %s is delayed for %ds after failures", item.Count, item.App.ID, item.Delay.TimeLeftSeconds)
+		default:
+			continue
+		}
+
+		id := fmt.Sprintf("%s:%s:%s", item.App.ID, item.Since, state)
+
+		failure := complainer.Failure{
+			ID:        id,
+			Name:      item.App.ID,
+			Framework: d.framework,
+			State:     state,
+			Message:   message,
+			Started:   now,
+			Finished:  now,
+			Labels:    item.App.Labels,
+			App: complainer.App{
+				ID:        item.App.ID,
+				Version:   item.App.Version,
+				Instances: item.App.Instances,
+				Labels:    item.App.Labels,
+			},
+		}
+
+		// Apps of other shards are not remembered
+		if d.owns == nil || d.owns(failure) {
+			seen[id] = true
+
+			if d.seen[id] {
+				continue
+			}
+		}
+
+		failures = append(failures, failure)
+	}
+
+	// Apps that left the queue are reported again next time they get stuck
+	d.seen = seen
+
+	return failures, nil
+}
+
+type queueResponse struct {
+	Queue []struct {
+		Count int    `json:"count"`
+		Since string `json:"since"`
+		Delay struct {
+			TimeLeftSeconds int  `json:"timeLeftSeconds"`
+			Overdue         bool `json:"overdue"`
+		} `json:"delay"`
+		App struct {
+			ID        string            `json:"id"`
+			Version   string            `json:"version"`
+			Instances int               `json:"instances"`
+			Labels    map[string]string `json:"labels"`
+		} `json:"app"`
+	} `json:"queue"`
+}
+
+func (c *Client) queue() (*queueResponse, error) {
+	resp, err := c.client.Get(c.url + "/v2/queue")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	queue := &queueResponse{}
+
+	return queue, json.NewDecoder(resp.Body).Decode(queue)
+}
@@ -0,0 +1,125 @@
+package marathon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestQueueDetector(t *testing.T) {
+	queue := `{"queue": []}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/queue" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(queue))
+	}))
+
+	defer server.Close()
+
+	detector := NewQueueDetector("marathon", NewClient(server.URL, time.Minute), time.Minute)
+
+	table := []struct {
+		queue string
+		ids   []string
+	}{
+		{
+			queue: `{"queue": [
+				{"count": 2, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 300, "overdue": false}, "app": {"id": "/web", "instances": 2, "labels": {"complainer_slack_channel": "#web"}}},
+				{"count": 1, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 5, "overdue": false}, "app": {"id": "/flappy"}},
+				{"count": 1, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 0, "overdue": true}, "app": {"id": "/big"}}
+			]}`,
+			ids: []string{
+				"/web:2017-10-10T01:00:00.000Z:APP_DELAYED",
+				"/big:2017-10-10T01:00:00.000Z:APP_OVERDUE",
+			},
+		},
+		{
+			queue: `{"queue": [
+				{"count": 2, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 600, "overdue": false}, "app": {"id": "/web"}}
+			]}`,
+			ids: []string{},
+		},
+		{
+			queue: `{"queue": []}`,
+			ids:   []string{},
+		},
+		{
+			queue: `{"queue": [
+				{"count": 1, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 0, "overdue": true}, "app": {"id": "/big"}}
+			]}`,
+			ids: []string{"/big:2017-10-10T01:00:00.000Z:APP_OVERDUE"},
+		},
+	}
+
+	for i, tt := range table {
+		queue = tt.queue
+
+		failures, err := detector.Failures()
+		if err != nil {
+			t.Fatalf("Error getting failures: %s", err)
+		}
+
+		ids := []string{}
+		for _, failure := range failures {
+			ids = append(ids, failure.ID)
+
+			if failure.Framework != "marathon" || failure.Name != failure.App.ID || failure.Finished.IsZero() {
+				t.Errorf("Unexpected failure: %+v", failure)
+			}
+		}
+
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("Unexpected failures %v on poll %d, expected %v", ids, i, tt.ids)
+		}
+
+		if i == 0 && failures[0].Labels["complainer_slack_channel"] != "#web" {
+			t.Errorf("Expected app labels to be used for routing, got %v", failures[0].Labels)
+		}
+	}
+}
+
+func TestQueueDetectorOwned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"queue": [
+			{"count": 1, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 0, "overdue": true}, "app": {"id": "/web"}},
+			{"count": 1, "since": "2017-10-10T01:00:00.000Z", "delay": {"timeLeftSeconds": 0, "overdue": true}, "app": {"id": "/big"}}
+		]}`))
+	}))
+
+	defer server.Close()
+
+	detector := NewQueueDetector("marathon", NewClient(server.URL, time.Minute), time.Minute)
+	detector.UseOwner(func(failure complainer.Failure) bool {
+		return failure.App.ID == "/web"
+	})
+
+	// Apps of other shards are returned until shards move here
+	expected := [][]string{
+		{"/web:2017-10-10T01:00:00.000Z:APP_OVERDUE", "/big:2017-10-10T01:00:00.000Z:APP_OVERDUE"},
+		{"/big:2017-10-10T01:00:00.000Z:APP_OVERDUE"},
+	}
+
+	for i, ids := range expected {
+		failures, err := detector.Failures()
+		if err != nil {
+			t.Fatalf("Error getting failures: %s", err)
+		}
+
+		got := []string{}
+		for _, failure := range failures {
+			got = append(got, failure.ID)
+		}
+
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("Unexpected failures %v on poll %d, expected %v", got, i, ids)
+		}
+	}
+}
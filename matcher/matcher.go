@@ -2,23 +2,68 @@ package matcher
 
 import (
 	"regexp"
+
+	"github.com/cloudflare/complainer"
 )
 
 // FailureMatcher is responsible for filtering out undesired Failures for reporting
 type FailureMatcher interface {
-	Match(string) bool
+	Match(complainer.Failure) bool
 }
 
 type NoopMatcher struct{}
 
-func (c *NoopMatcher) Match(_ string) bool { return true }
+func (c *NoopMatcher) Match(_ complainer.Failure) bool { return true }
+
+// AttributeRegex matches the value of the named agent attribute
+type AttributeRegex struct {
+	Name  string
+	Regex *regexp.Regexp
+}
+
+func (a AttributeRegex) match(failure complainer.Failure) bool {
+	value, ok := failure.Attributes[a.Name]
+	return ok && a.Regex.MatchString(value)
+}
 
 type RegexMatcher struct {
 	Whitelist []*regexp.Regexp
 	Blacklist []*regexp.Regexp
+
+	AttributeWhitelist []AttributeRegex
+	AttributeBlacklist []AttributeRegex
+}
+
+// Match applies framework filters to every failure and attribute filters
+// only to failures with agent attributes, other sources do not have them
+func (r *RegexMatcher) Match(failure complainer.Failure) bool {
+	if len(failure.Attributes) > 0 && !r.matchAttributes(failure) {
+		return false
+	}
+
+	return r.matchFramework(failure.Framework)
+}
+
+func (r *RegexMatcher) matchAttributes(failure complainer.Failure) bool {
+	for _, attribute := range r.AttributeBlacklist {
+		if attribute.match(failure) {
+			return false
+		}
+	}
+
+	return len(r.AttributeWhitelist) == 0 || r.matchAttributeWhitelist(failure)
+}
+
+func (r *RegexMatcher) matchAttributeWhitelist(failure complainer.Failure) bool {
+	for _, attribute := range r.AttributeWhitelist {
+		if attribute.match(failure) {
+			return true
+		}
+	}
+	return false
 }
 
-func (r *RegexMatcher) Match(name string) bool {
+func (r *RegexMatcher) matchFramework(name string) bool {
 	for _, regex := range r.Blacklist {
 		if regex.MatchString(name) {
 			return false
@@ -0,0 +1,56 @@
+package matcher
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestRegexMatcher(t *testing.T) {
+	m := &RegexMatcher{
+		Blacklist:          []*regexp.Regexp{regexp.MustCompile("^chronos$")},
+		AttributeWhitelist: []AttributeRegex{{Name: "zone", Regex: regexp.MustCompile("^[ab]$")}},
+		AttributeBlacklist: []AttributeRegex{{Name: "rack", Regex: regexp.MustCompile("^r13$")}},
+	}
+
+	table := []struct {
+		failure complainer.Failure
+		match   bool
+	}{
+		{
+			failure: complainer.Failure{Framework: "marathon", Attributes: map[string]string{"zone": "a", "rack": "r1"}},
+			match:   true,
+		},
+		{
+			failure: complainer.Failure{Framework: "chronos", Attributes: map[string]string{"zone": "a", "rack": "r1"}},
+			match:   false,
+		},
+		{
+			failure: complainer.Failure{Framework: "marathon", Attributes: map[string]string{"zone": "b", "rack": "r13"}},
+			match:   false,
+		},
+		{
+			failure: complainer.Failure{Framework: "marathon", Attributes: map[string]string{"zone": "c"}},
+			match:   false,
+		},
+		{
+			failure: complainer.Failure{Framework: "marathon"},
+			match:   true,
+		},
+		{
+			failure: complainer.Failure{Framework: "kubernetes"},
+			match:   true,
+		},
+		{
+			failure: complainer.Failure{Framework: "chronos"},
+			match:   false,
+		},
+	}
+
+	for _, tt := range table {
+		if match := m.Match(tt.failure); match != tt.match {
+			t.Errorf("Match of %s with attributes %v returned %v, expected %v", tt.failure.Framework, tt.failure.Attributes, match, tt.match)
+		}
+	}
+}
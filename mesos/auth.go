@@ -0,0 +1,280 @@
+package mesos
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// lifetime of service account login tokens we sign
+	loginTokenLifetime = time.Minute * 5
+)
+
+// newTransport creates http transport with TLS and authentication from the config
+func newTransport(config Config) (http.RoundTripper, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: time.Second * 10,
+	}
+
+	switch {
+	case config.Principal != "":
+		return &authTransport{
+			transport: transport,
+			authorize: func(req *http.Request) error {
+				req.SetBasicAuth(config.Principal, config.Secret)
+				return nil
+			},
+		}, nil
+	case config.Token != "":
+		return &authTransport{
+			transport: transport,
+			authorize: func(req *http.Request) error {
+				req.Header.Set("Authorization", "token="+config.Token)
+				return nil
+			},
+		}, nil
+	case config.ServiceAccount != "":
+		login, err := newServiceAccountLogin(config, transport)
+		if err != nil {
+			return nil, err
+		}
+
+		return &authTransport{
+			transport: transport,
+			authorize: login.authorize,
+			reject:    login.reset,
+		}, nil
+	}
+
+	return transport, nil
+}
+
+func newTLSConfig(config Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if config.CAFile != "" {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %s", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("cannot find certificates in CA bundle %s", config.CAFile)
+		}
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %s", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// authTransport authorizes every request before passing it on
+type authTransport struct {
+	transport http.RoundTripper
+	authorize func(req *http.Request) error
+	reject    func()
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests must not be modified by round trippers
+	authorized := new(http.Request)
+	*authorized = *req
+
+	authorized.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		authorized.Header[k] = v
+	}
+
+	if err := t.authorize(authorized); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(authorized)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && t.reject != nil {
+		// Credentials are likely expired, get new ones for the next request
+		t.reject()
+	}
+
+	return resp, err
+}
+
+// serviceAccountLogin obtains DC/OS authentication tokens for a service account
+type serviceAccountLogin struct {
+	uid      string
+	key      *rsa.PrivateKey
+	loginURL string
+	client   http.Client
+	token    string
+	mu       sync.Mutex
+}
+
+func newServiceAccountLogin(config Config, transport http.RoundTripper) (*serviceAccountLogin, error) {
+	if config.LoginURL == "" {
+		return nil, errors.New("login url is required for service account authentication")
+	}
+
+	key, err := readPrivateKey(config.ServiceAccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceAccountLogin{
+		uid:      config.ServiceAccount,
+		key:      key,
+		loginURL: config.LoginURL,
+		client: http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}, nil
+}
+
+func readPrivateKey(file string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read service account key: %s", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("cannot find PEM data in service account key %s", file)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse service account key: %s", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+func (l *serviceAccountLogin) authorize(req *http.Request) error {
+	token, err := l.authToken()
+	if err != nil {
+		return fmt.Errorf("cannot login as %s: %s", l.uid, err)
+	}
+
+	req.Header.Set("Authorization", "token="+token)
+
+	return nil
+}
+
+func (l *serviceAccountLogin) reset() {
+	l.mu.Lock()
+	l.token = ""
+	l.mu.Unlock()
+}
+
+// authToken returns the cached authentication token or logs in to get a new one
+func (l *serviceAccountLogin) authToken() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.token != "" {
+		return l.token, nil
+	}
+
+	loginToken, err := signLoginToken(l.uid, l.key, time.Now().Add(loginTokenLifetime))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"uid":   l.uid,
+		"token": loginToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := l.client.Post(l.loginURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	login := struct {
+		Token string `json:"token"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", err
+	}
+
+	if login.Token == "" {
+		return "", errors.New("empty token in login response")
+	}
+
+	l.token = login.Token
+
+	return l.token, nil
+}
+
+// signLoginToken creates RS256 signed JWT that proves service account identity
+func signLoginToken(uid string, key *rsa.PrivateKey, expires time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{"uid": uid, "exp": expires.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(payload))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,163 @@
+package mesos
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "complainer" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	defer server.Close()
+
+	cluster, err := NewClusterFromConfig(Config{Masters: server.URL, Principal: "complainer", Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cluster.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected response status: %s", resp.Status)
+	}
+}
+
+func TestServiceAccountLogin(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile, err := ioutil.TempFile("", "complainer-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.Remove(keyFile.Name())
+	}()
+
+	if err := pem.Encode(keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = keyFile.Close()
+
+	logins := 0
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+
+		login := struct {
+			UID   string `json:"uid"`
+			Token string `json:"token"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			t.Errorf("Error decoding login request: %s", err)
+		}
+
+		if login.UID != "complainer" {
+			t.Errorf("Unexpected uid %q", login.UID)
+		}
+
+		parts := strings.Split(login.Token, ".")
+		if len(parts) != 3 {
+			t.Fatalf("Unexpected login token %q", login.Token)
+		}
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Errorf("Invalid login token signature: %s", err)
+		}
+
+		_, _ = w.Write([]byte(`{"token": "issued"}`))
+	})
+
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token=issued" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cluster, err := NewClusterFromConfig(Config{
+		Masters:           server.URL,
+		ServiceAccount:    "complainer",
+		ServiceAccountKey: keyFile.Name(),
+		LoginURL:          server.URL + "/login",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := cluster.Client().Get(server.URL + "/state")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected response status: %s", resp.Status)
+		}
+	}
+
+	if logins != 1 {
+		t.Errorf("Expected token to be obtained once, logged in %d times", logins)
+	}
+}
+
+func TestSignLoginToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signLoginToken("complainer", key, time.Unix(1507599400, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(claims) != `{"exp":1507599400,"uid":"complainer"}` {
+		t.Errorf("Unexpected claims: %s", claims)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"math"
+	"net"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/complainer"
@@ -18,110 +20,436 @@ var ErrNoMesosMaster = errors.New("mesos master not found")
 
 const (
 	unknownState = "UNKNOWN"
+	// timeout for requests to masters and agents
+	timeout = time.Second * 30
+	// highWaterGrace keeps failures that are older than the ones seen
+	// before, updates can come late or from agents with clocks behind.
+	// Failures that were seen are deduplicated by id in the monitor.
+	highWaterGrace = time.Minute * 5
 )
 
 // Cluster represents Mesos cluster
 type Cluster struct {
-	masters []string
-	client  http.Client
+	name         string
+	labels       map[string]string
+	masters      []string
+	detector     leaderDetector
+	leader       string
+	highWater    float64
+	owns         func(failure complainer.Failure) bool
+	logRules     []logRule
+	mu           sync.Mutex
+	client       http.Client
+	streamClient http.Client
 }
 
 // NewCluster creates a new cluster with the provided list of masters
 func NewCluster(masters []string) *Cluster {
-	var cleanMasters []string
+	masters = cleanMasters(masters)
+	return newCluster(masters, newRedirectDetector(masters, timeout, nil), nil)
+}
+
+// NewClusterFromConfig creates a new cluster with masters, authentication
+// and TLS settings from the config. Masters can be either a list of urls
+// or zookeeper url: zk://host1:port,host2:port/path
+func NewClusterFromConfig(config Config) (*Cluster, error) {
+	transport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	logRules, err := parseLogRules(config.Logs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse log rules: %s", err)
+	}
+
+	var cluster *Cluster
+
+	if strings.HasPrefix(config.Masters, "zk://") {
+		detector, err := newZookeeperDetector(config.Masters, config.Scheme)
+		if err != nil {
+			return nil, err
+		}
+
+		cluster = newCluster(nil, detector, transport)
+	} else {
+		masters := cleanMasters(strings.Split(config.Masters, ","))
+		cluster = newCluster(masters, newRedirectDetector(masters, timeout, transport), transport)
+	}
+
+	cluster.name = config.Name
+	cluster.labels = config.Labels
+	cluster.logRules = logRules
+
+	return cluster, nil
+}
+
+func cleanMasters(masters []string) []string {
+	var clean []string
 	for _, master := range masters {
-		cleanMasters = append(cleanMasters, strings.TrimSuffix(master, "/"))
+		clean = append(clean, strings.TrimSuffix(master, "/"))
 	}
 
+	return clean
+}
+
+func newCluster(masters []string, detector leaderDetector, transport http.RoundTripper) *Cluster {
 	return &Cluster{
-		masters: cleanMasters,
+		masters:  masters,
+		detector: detector,
 		client: http.Client{
-			Timeout: time.Second * 30,
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		// Subscriptions are long lived, heartbeats are used instead of timeouts
+		streamClient: http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
 		},
 	}
 }
 
+// Name returns the name of the cluster
+func (c *Cluster) Name() string {
+	return c.name
+}
+
+// annotate adds cluster name and labels to the failure,
+// labels set on the task take precedence over cluster labels
+func (c *Cluster) annotate(failure complainer.Failure) complainer.Failure {
+	failure.Cluster = c.name
+
+	if len(c.labels) == 0 {
+		return failure
+	}
+
+	labels := map[string]string{}
+	for k, v := range c.labels {
+		labels[k] = v
+	}
+
+	for k, v := range failure.Labels {
+		labels[k] = v
+	}
+
+	failure.Labels = labels
+
+	return failure
+}
+
+// Client returns http client that is authorized to talk to the cluster,
+// it can be used to download logs from the sandbox urls
+func (c *Cluster) Client() *http.Client {
+	return &http.Client{
+		Transport: c.client.Transport,
+	}
+}
+
+// UseOwner makes the cluster keep failures that are not owned regardless
+// of their age, so that they are returned once their shards move here
+func (c *Cluster) UseOwner(owns func(failure complainer.Failure) bool) {
+	c.mu.Lock()
+	c.owns = owns
+	c.mu.Unlock()
+}
+
 // Failures returns the list of known failes tasks
 func (c *Cluster) Failures() ([]complainer.Failure, error) {
-	state := &masterState{}
+	master, err := c.leaderURL()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, master := range c.masters {
-		resp, err := c.client.Get(master + "/master/state")
-		if err != nil {
-			log.Printf("Error fetching state from %s: %s", master, err)
-			continue
-		}
+	c.mu.Lock()
+	since := c.highWater - highWaterGrace.Seconds()
+	owns := c.owns
+	c.mu.Unlock()
 
-		defer func() {
-			_ = resp.Body.Close()
-		}()
+	// Only failures that are not much older than the ones we saw before are kept,
+	// ownership is only known for failures, so the age of owned ones is checked later
+	state, err := c.masterState(master, func(task masterTask) bool {
+		return failedState(task.State) && (owns != nil || lastTimestamp(task) >= since)
+	})
+	if err != nil {
+		c.resetLeader()
+		return nil, fmt.Errorf("cannot get state from %s: %s", master, err)
+	}
 
-		err = json.NewDecoder(resp.Body).Decode(state)
-		if err != nil {
-			log.Printf("Error decoding state from %s: %s", master, err)
-			continue
-		}
+	if state.Pid != state.Leader {
+		c.resetLeader()
+		return nil, fmt.Errorf("master %s is not leading", master)
+	}
 
-		if state.Pid != state.Leader {
+	c.mu.Lock()
+	c.highWater = highWater(state, c.highWater)
+	c.mu.Unlock()
+
+	failures := []complainer.Failure{}
+	for _, failure := range c.failuresFromLeader(state, agentScheme(master)) {
+		failure = c.annotate(failure)
+
+		if owns != nil && owns(failure) && failure.Finished.Unix() < int64(since) {
 			continue
 		}
 
-		return c.failuresFromLeader(state), nil
+		failures = append(failures, failure)
 	}
 
-	return nil, ErrNoMesosMaster
+	return failures, nil
 }
 
-func (c *Cluster) failuresFromLeader(state *masterState) []complainer.Failure {
-	failures := []complainer.Failure{}
+// Task returns the completed task by id as a failure, regardless of its state
+func (c *Cluster) Task(id string) (complainer.Failure, error) {
+	master, err := c.leaderURL()
+	if err != nil {
+		return complainer.Failure{}, err
+	}
+
+	state, err := c.masterState(master, func(task masterTask) bool {
+		return task.ID == id
+	})
+	if err != nil {
+		c.resetLeader()
+		return complainer.Failure{}, fmt.Errorf("cannot get state from %s: %s", master, err)
+	}
 
-	hosts := map[string]string{}
+	slaves := map[string]masterSlave{}
 	for _, slave := range state.Slaves {
-		hosts[slave.ID] = slave.Host
+		slaves[slave.ID] = slave
 	}
 
-	for _, framework := range state.Frameworks {
-		for _, task := range framework.CompletedTasks {
-			if task.State != "TASK_FAILED" && task.State != "TASK_ERROR" && task.State != "TASK_LOST" {
-				continue
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		for _, task := range append(framework.CompletedTasks, framework.UnreachableTasks...) {
+			if task.ID == id {
+				return c.annotate(failureFromTask(task, framework.Name, slaves[task.SlaveID], agentScheme(master))), nil
 			}
+		}
+	}
 
-			labels := map[string]string{}
-			for _, label := range task.Labels {
-				labels[label.Key] = label.Value
-			}
+	return complainer.Failure{}, fmt.Errorf("cannot find task %s", id)
+}
 
-			// The following is to handle the case where mesos tasks don't have any statuses
-			var startedAt int64
-			var finishedAt int64
-			var state = unknownState
+// Running returns running tasks, tasks are started when they first
+// become running
+func (c *Cluster) Running() ([]complainer.Task, error) {
+	master, err := c.leaderURL()
+	if err != nil {
+		return nil, err
+	}
 
-			if len(task.Statuses) > 0 {
-				startedAt = int64(task.Statuses[0].Timestamp)
-				finishedAt = int64(task.Statuses[len(task.Statuses)-1].Timestamp)
-				state = task.Statuses[len(task.Statuses)-1].State
-			}
+	state, err := c.masterState(master, func(task masterTask) bool {
+		return task.State == runningState
+	})
+	if err != nil {
+		c.resetLeader()
+		return nil, fmt.Errorf("cannot get state from %s: %s", master, err)
+	}
 
-			failures = append(failures, complainer.Failure{
+	tasks := []complainer.Task{}
+	for _, framework := range state.Frameworks {
+		for _, task := range framework.Tasks {
+			tasks = append(tasks, complainer.Task{
 				ID:        task.ID,
 				Name:      task.Name,
-				Slave:     hosts[task.SlaveID],
+				Cluster:   c.name,
 				Framework: framework.Name,
-				Image:     task.Container.Docker.Image,
-				State:     state,
-				Started:   time.Unix(startedAt, 0),
-				Finished:  time.Unix(finishedAt, 0),
-				Labels:    labels,
+				Started:   runningSince(task),
 			})
 		}
 	}
 
+	return tasks, nil
+}
+
+// runningSince returns the timestamp of the first running status,
+// health checks keep sending running statuses after that
+func runningSince(task masterTask) time.Time {
+	for _, status := range task.Statuses {
+		if status.State == runningState {
+			return timestamp(status.Timestamp)
+		}
+	}
+
+	return time.Time{}
+}
+
+// highWater returns the latest status timestamp of failed tasks in the state
+func highWater(state *masterState, current float64) float64 {
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		for _, task := range append(framework.CompletedTasks, framework.UnreachableTasks...) {
+			if ts := lastTimestamp(task); ts > current {
+				current = ts
+			}
+		}
+	}
+
+	return current
+}
+
+// lastTimestamp returns the timestamp of the latest task status
+func lastTimestamp(task masterTask) float64 {
+	if len(task.Statuses) == 0 {
+		return 0
+	}
+
+	return task.Statuses[len(task.Statuses)-1].Timestamp
+}
+
+// leaderURL returns the cached leading master url or finds a new one
+func (c *Cluster) leaderURL() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.leader != "" {
+		return c.leader, nil
+	}
+
+	leader, err := c.detector.Leader()
+	if err != nil {
+		return "", err
+	}
+
+	c.leader = leader
+
+	return leader, nil
+}
+
+// resetLeader forgets the cached leader after a failed request
+func (c *Cluster) resetLeader() {
+	c.mu.Lock()
+	c.leader = ""
+	c.mu.Unlock()
+}
+
+func (c *Cluster) masterState(master string, keep func(task masterTask) bool) (*masterState, error) {
+	resp, err := c.client.Get(master + "/master/state")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return decodeMasterState(resp.Body, keep)
+}
+
+// agentScheme returns the scheme to talk to agents, agents are expected
+// to use https when masters do
+func agentScheme(master string) string {
+	if strings.HasPrefix(master, "https://") {
+		return "https"
+	}
+
+	return "http"
+}
+
+func (c *Cluster) failuresFromLeader(state *masterState, scheme string) []complainer.Failure {
+	failures := []complainer.Failure{}
+
+	slaves := map[string]masterSlave{}
+	for _, slave := range state.Slaves {
+		slaves[slave.ID] = slave
+	}
+
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		for _, task := range append(framework.CompletedTasks, framework.UnreachableTasks...) {
+			if !failedState(task.State) {
+				continue
+			}
+
+			failures = append(failures, failureFromTask(task, framework.Name, slaves[task.SlaveID], scheme))
+		}
+	}
+
 	return failures
 }
 
-// Logs returns stdout and stderr urls fot the specified task
+func failureFromTask(task masterTask, framework string, slave masterSlave, scheme string) complainer.Failure {
+	labels := map[string]string{}
+	for _, label := range task.Labels {
+		labels[label.Key] = label.Value
+	}
+
+	failure := complainer.Failure{
+		ID:        task.ID,
+		Name:      task.Name,
+		Slave:     slave.Host,
+		AgentID:   task.SlaveID,
+		AgentURL:  slave.url(scheme),
+		AgentIP:   slave.ip(),
+		Executor:  task.Executor,
+		Framework: framework,
+		Image:     task.Container.Docker.Image,
+		State:     task.State,
+		Started:   time.Unix(0, 0),
+		Finished:  time.Unix(0, 0),
+		Labels:    labels,
+		Statuses:  make([]complainer.Status, 0, len(task.Statuses)),
+
+		Attributes: slave.attributes(),
+		Resources: complainer.Resources{
+			CPUs:  task.Resources.CPUs,
+			Mem:   task.Resources.Mem,
+			Disk:  task.Resources.Disk,
+			GPUs:  task.Resources.GPUs,
+			Ports: task.Resources.Ports,
+		},
+	}
+
+	// The following is to handle the case where mesos tasks don't have any statuses
+	if failure.State == "" {
+		failure.State = unknownState
+	}
+
+	for _, status := range task.Statuses {
+		failure.Statuses = append(failure.Statuses, complainer.Status{
+			State:     status.State,
+			Message:   status.Message,
+			Reason:    status.Reason,
+			Source:    status.Source,
+			Timestamp: timestamp(status.Timestamp),
+		})
+	}
+
+	if len(task.Statuses) > 0 {
+		last := task.Statuses[len(task.Statuses)-1]
+
+		failure.Started = time.Unix(int64(task.Statuses[0].Timestamp), 0)
+		failure.Finished = time.Unix(int64(last.Timestamp), 0)
+		failure.State = last.State
+		failure.Message = last.Message
+		failure.Reason = last.Reason
+		failure.Source = last.Source
+		failure.ExitCode, failure.Signal = parseExit(last.Message)
+	}
+
+	return failure
+}
+
+// timestamp converts fractional unix timestamp into time
+func timestamp(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// Logs returns stdout and stderr urls fot the specified task,
+// logs are found with the locator configured for its framework
 func (c *Cluster) Logs(failure complainer.Failure) (stdoutURL, stderrURL string, err error) {
-	state, err := c.slaveState(failure.Slave)
+	return c.LocateLogs(failure, logLocator(c.logRules, failure.Framework))
+}
+
+// LocateLogs returns stdout and stderr urls for the specified task found with the locator
+func (c *Cluster) LocateLogs(failure complainer.Failure, locator LogLocator) (stdoutURL, stderrURL string, err error) {
+	agent := agentURL(failure)
+
+	state, err := c.slaveState(agent)
 	if err != nil {
 		return "", "", err
 	}
@@ -130,22 +458,34 @@ func (c *Cluster) Logs(failure complainer.Failure) (stdoutURL, stderrURL string,
 		// Tasks are not necessarily promoted to completed immediately,
 		// that's why we need to look at current executors too.
 		for _, executor := range append(framework.Executors, framework.CompletedExecutors...) {
-			if executor.ID == failure.ID {
-				stdoutURL = sandboxURL(failure.Slave, executor.Directory, "stdout")
-				stderrURL = sandboxURL(failure.Slave, executor.Directory, "stderr")
+			if executor.runs(failure) {
+				stdout, stderr, err := locator.Locate(c.browser(agent), executor.sandbox(failure))
+				if err != nil {
+					return "", "", fmt.Errorf("cannot locate logs in sandbox: %s", err)
+				}
 
-				return stdoutURL, stderrURL, nil
+				return sandboxURL(agent, stdout), sandboxURL(agent, stderr), nil
 			}
 		}
 	}
 
-	return "", "", fmt.Errorf("cannot find executor by ID (%s)", failure.ID)
+	return "", "", fmt.Errorf("cannot find executor for task (%s)", failure.ID)
+}
+
+// agentURL returns the agent url of the failure, failures without one
+// are assumed to come from agents on the default port
+func agentURL(failure complainer.Failure) string {
+	if failure.AgentURL != "" {
+		return failure.AgentURL
+	}
+
+	return "http://" + net.JoinHostPort(failure.Slave, strconv.Itoa(defaultAgentPort))
 }
 
-func (c *Cluster) slaveState(host string) (*slaveState, error) {
+func (c *Cluster) slaveState(agent string) (*slaveState, error) {
 	state := &slaveState{}
 
-	resp, err := c.client.Get("http://" + host + ":5051/state")
+	resp, err := c.client.Get(agent + "/state")
 	if err != nil {
 		return state, err
 	}
@@ -157,11 +497,6 @@ func (c *Cluster) slaveState(host string) (*slaveState, error) {
 	return state, json.NewDecoder(resp.Body).Decode(state)
 }
 
-func sandboxURL(host, directory, file string) string {
-	return (&url.URL{
-		Scheme:   "http",
-		Host:     host + ":5051",
-		Path:     "files/download",
-		RawQuery: "path=" + directory + "/" + file,
-	}).String()
+func sandboxURL(agent, file string) string {
+	return agent + "/files/download?path=" + file
 }
@@ -1,8 +1,13 @@
 package mesos
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
 )
 
 func TestNewCluster(t *testing.T) {
@@ -28,3 +33,298 @@ func TestNewCluster(t *testing.T) {
 		t.Errorf("Master list is not equal. Got %+v, expected %+v", cluster.masters, expectedMasters)
 	}
 }
+
+func TestFailuresFromLeader(t *testing.T) {
+	state := &masterState{
+		Slaves: []masterSlave{{ID: "agent-1", Host: "agent1.example.com"}},
+		Frameworks: []masterFramework{
+			{
+				Name: "marathon",
+				CompletedTasks: []masterTask{
+					{ID: "failed.1", State: "TASK_FAILED", SlaveID: "agent-1"},
+					{ID: "finished.1", State: "TASK_FINISHED", SlaveID: "agent-1"},
+					{ID: "killed.1", State: "TASK_KILLED", SlaveID: "agent-1"},
+				},
+				UnreachableTasks: []masterTask{
+					{ID: "unreachable.1", State: "TASK_UNREACHABLE", SlaveID: "agent-1"},
+				},
+			},
+		},
+		CompletedFrameworks: []masterFramework{
+			{
+				Name: "chronos",
+				CompletedTasks: []masterTask{
+					{ID: "gone.1", State: "TASK_GONE", SlaveID: "agent-1"},
+				},
+			},
+		},
+	}
+
+	failures := NewCluster(nil).failuresFromLeader(state, "http")
+
+	ids := []string{}
+	for _, failure := range failures {
+		ids = append(ids, failure.ID)
+
+		if failure.Slave != "agent1.example.com" {
+			t.Errorf("Unexpected slave for %s: %s", failure.ID, failure.Slave)
+		}
+	}
+
+	expected := []string{"failed.1", "killed.1", "unreachable.1", "gone.1"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Unexpected failures %v, expected %v", ids, expected)
+	}
+
+	if failures[3].Framework != "chronos" || failures[3].State != "TASK_GONE" {
+		t.Errorf("Unexpected failure from completed framework: %+v", failures[3])
+	}
+}
+
+func TestFailureFromTask(t *testing.T) {
+	task := masterTask{
+		ID:    "app.1",
+		Name:  "app",
+		State: "TASK_FAILED",
+		Statuses: []masterTaskStatus{
+			{State: "TASK_RUNNING", Timestamp: 1480000000.25},
+			{State: "TASK_FAILED", Timestamp: 1480000060.5, Message: "Container exited with status 137", Reason: "REASON_CONTAINER_LIMITATION_MEMORY", Source: "SOURCE_AGENT"},
+		},
+	}
+
+	failure := failureFromTask(task, "marathon", masterSlave{ID: "agent-1", Host: "agent1.example.com"}, "http")
+
+	if failure.Message != "Container exited with status 137" || failure.Reason != "REASON_CONTAINER_LIMITATION_MEMORY" || failure.Source != "SOURCE_AGENT" {
+		t.Errorf("Unexpected failure status details: %+v", failure)
+	}
+
+	if failure.ExitCode == nil || *failure.ExitCode != 137 {
+		t.Errorf("Unexpected exit code: %v", failure.ExitCode)
+	}
+
+	if len(failure.Statuses) != 2 || failure.Statuses[0].State != "TASK_RUNNING" {
+		t.Fatalf("Unexpected status history: %+v", failure.Statuses)
+	}
+
+	if !failure.Statuses[1].Timestamp.Equal(time.Unix(1480000060, 5e8)) {
+		t.Errorf("Unexpected status timestamp: %s", failure.Statuses[1].Timestamp)
+	}
+}
+
+func TestMasterSlaveURL(t *testing.T) {
+	table := []struct {
+		slave  masterSlave
+		scheme string
+		url    string
+	}{
+		{
+			slave:  masterSlave{Pid: "slave(1)@10.0.1.1:5052", Host: "agent1.example.com", Port: 5052},
+			scheme: "http",
+			url:    "http://10.0.1.1:5052",
+		},
+		{
+			slave:  masterSlave{Host: "agent1.example.com", Port: 5052},
+			scheme: "https",
+			url:    "https://agent1.example.com:5052",
+		},
+		{
+			slave:  masterSlave{Host: "agent1.example.com"},
+			scheme: "http",
+			url:    "http://agent1.example.com:5051",
+		},
+		{
+			slave:  masterSlave{},
+			scheme: "http",
+			url:    "",
+		},
+	}
+
+	for _, tt := range table {
+		if u := tt.slave.url(tt.scheme); u != tt.url {
+			t.Errorf("Unexpected url %q for %+v, expected %q", u, tt.slave, tt.url)
+		}
+	}
+}
+
+func TestLogs(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/state" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{
+			"frameworks": [{
+				"executors": [
+					{"id": "app.1", "type": "COMMAND", "directory": "/sandbox/app.1", "tasks": [{"id": "app.1"}]},
+					{"id": "default-executor", "type": "DEFAULT", "directory": "/sandbox/pod", "tasks": [{"id": "pod.web"}], "queued_tasks": [{"id": "pod.sidecar"}]}
+				],
+				"completed_executors": [
+					{"id": "thermos-job", "type": "CUSTOM", "directory": "/sandbox/job", "completed_tasks": [{"id": "job.0"}]},
+					{"id": "docker.1", "directory": "/sandbox/docker.1"}
+				]
+			}]
+		}`))
+	}))
+
+	defer agent.Close()
+
+	table := []struct {
+		failure complainer.Failure
+		sandbox string
+	}{
+		{
+			failure: complainer.Failure{ID: "app.1"},
+			sandbox: "/sandbox/app.1",
+		},
+		{
+			failure: complainer.Failure{ID: "docker.1"},
+			sandbox: "/sandbox/docker.1",
+		},
+		{
+			failure: complainer.Failure{ID: "job.0"},
+			sandbox: "/sandbox/job",
+		},
+		{
+			failure: complainer.Failure{ID: "pod.web", Executor: "default-executor"},
+			sandbox: "/sandbox/pod/tasks/pod.web",
+		},
+		{
+			failure: complainer.Failure{ID: "pod.sidecar"},
+			sandbox: "/sandbox/pod/tasks/pod.sidecar",
+		},
+		{
+			failure: complainer.Failure{ID: "missing.1"},
+		},
+	}
+
+	cluster := NewCluster(nil)
+
+	for _, tt := range table {
+		tt.failure.AgentURL = agent.URL
+
+		stdoutURL, stderrURL, err := cluster.Logs(tt.failure)
+		if tt.sandbox == "" {
+			if err == nil {
+				t.Errorf("Expected error getting logs for %s", tt.failure.ID)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Error getting logs for %s: %s", tt.failure.ID, err)
+			continue
+		}
+
+		if stdoutURL != agent.URL+"/files/download?path="+tt.sandbox+"/stdout" {
+			t.Errorf("Unexpected stdout url for %s: %s", tt.failure.ID, stdoutURL)
+		}
+
+		if stderrURL != agent.URL+"/files/download?path="+tt.sandbox+"/stderr" {
+			t.Errorf("Unexpected stderr url for %s: %s", tt.failure.ID, stderrURL)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	cluster, err := NewClusterFromConfig(Config{
+		Name:    "eu-west",
+		Masters: "http://master1:5050",
+		Labels: map[string]string{
+			"complainer_slack_channel": "#eu-west",
+			"complainer_sentry_dsn":    "cluster",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := cluster.annotate(complainer.Failure{ID: "app.1", Labels: map[string]string{"complainer_sentry_dsn": "task"}})
+
+	if failure.Cluster != "eu-west" {
+		t.Errorf("Unexpected cluster %q", failure.Cluster)
+	}
+
+	expected := map[string]string{
+		"complainer_slack_channel": "#eu-west",
+		"complainer_sentry_dsn":    "task",
+	}
+
+	if !reflect.DeepEqual(failure.Labels, expected) {
+		t.Errorf("Unexpected labels %v, expected %v", failure.Labels, expected)
+	}
+}
+
+func TestTask(t *testing.T) {
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"slaves": [{"id": "agent-1", "hostname": "agent1.example.com", "port": 5051}],
+			"frameworks": [{
+				"name": "metronome",
+				"completed_tasks": [
+					{"id": "job.1", "name": "job", "state": "TASK_FAILED", "slave_id": "agent-1"},
+					{"id": "job.2", "name": "job", "state": "TASK_FINISHED", "slave_id": "agent-1"}
+				]
+			}]
+		}`))
+	}))
+
+	defer master.Close()
+
+	cluster := NewCluster([]string{master.URL})
+	cluster.name = "test"
+	cluster.leader = master.URL
+
+	task, err := cluster.Task("job.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.ID != "job.2" || task.Framework != "metronome" || task.Cluster != "test" || task.AgentURL != "http://agent1.example.com:5051" {
+		t.Errorf("Unexpected task: %+v", task)
+	}
+
+	if _, err := cluster.Task("missing.1"); err == nil {
+		t.Errorf("Expected error for missing task")
+	}
+}
+
+func TestRunning(t *testing.T) {
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"frameworks": [{
+				"name": "marathon",
+				"tasks": [
+					{"id": "web.2", "name": "web", "state": "TASK_RUNNING", "statuses": [
+						{"state": "TASK_RUNNING", "timestamp": 1480000000},
+						{"state": "TASK_RUNNING", "timestamp": 1480000060}
+					]},
+					{"id": "web.3", "name": "web", "state": "TASK_STAGING"}
+				],
+				"completed_tasks": [
+					{"id": "web.1", "name": "web", "state": "TASK_FAILED"}
+				]
+			}]
+		}`))
+	}))
+
+	defer master.Close()
+
+	cluster := NewCluster([]string{master.URL})
+	cluster.name = "test"
+	cluster.leader = master.URL
+
+	tasks, err := cluster.Running()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []complainer.Task{
+		{ID: "web.2", Name: "web", Cluster: "test", Framework: "marathon", Started: time.Unix(1480000000, 0)},
+	}
+
+	if !reflect.DeepEqual(tasks, expected) {
+		t.Errorf("Unexpected tasks %+v, expected %+v", tasks, expected)
+	}
+}
@@ -0,0 +1,137 @@
+package mesos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/cloudflare/complainer/flags"
+)
+
+// Config holds settings needed to talk to Mesos masters and agents
+type Config struct {
+	// Name of the cluster that is attached to failures
+	Name string `json:"-"`
+
+	// Labels attached to failures from the cluster unless tasks override them
+	Labels map[string]string `json:"labels"`
+
+	// Masters is either a list of master urls or zookeeper url
+	Masters string `json:"masters"`
+
+	// Scheme of masters found in zookeeper, http by default
+	Scheme string `json:"scheme"`
+
+	// HTTP basic authentication
+	Principal string `json:"principal"`
+	Secret    string `json:"secret"`
+
+	// DC/OS authentication token, either static or obtained by a service account login
+	Token             string `json:"token"`
+	ServiceAccount    string `json:"service_account"`
+	ServiceAccountKey string `json:"service_account_key"`
+	LoginURL          string `json:"login_url"`
+
+	// TLS settings
+	CAFile   string `json:"ca_file"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// Log locators for frameworks: <framework regex>=<locator>;...
+	Logs string `json:"logs"`
+}
+
+var flagConfig = struct {
+	scheme            *string
+	principal         *string
+	secret            *string
+	token             *string
+	serviceAccount    *string
+	serviceAccountKey *string
+	loginURL          *string
+	caFile            *string
+	certFile          *string
+	keyFile           *string
+	logs              *string
+}{}
+
+// RegisterFlags registers command line flags for authentication and TLS
+func RegisterFlags() {
+	flagConfig.scheme = flags.String("mesos.scheme", "MESOS_SCHEME", "http", "scheme of masters found in zookeeper (example: https)")
+	flagConfig.principal = flags.String("mesos.principal", "MESOS_PRINCIPAL", "", "principal for http basic auth")
+	flagConfig.secret = flags.String("mesos.secret", "MESOS_SECRET", "", "secret for http basic auth")
+	flagConfig.token = flags.String("mesos.token", "MESOS_TOKEN", "", "DC/OS authentication token")
+	flagConfig.serviceAccount = flags.String("mesos.service_account", "MESOS_SERVICE_ACCOUNT", "", "DC/OS service account uid")
+	flagConfig.serviceAccountKey = flags.String("mesos.service_account_key", "MESOS_SERVICE_ACCOUNT_KEY", "", "path to DC/OS service account private key")
+	flagConfig.loginURL = flags.String("mesos.login_url", "MESOS_LOGIN_URL", "", "DC/OS login url (ex: https://leader.mesos/acs/api/v1/auth/login)")
+	flagConfig.caFile = flags.String("mesos.ca_file", "MESOS_CA_FILE", "", "path to CA bundle to verify masters and agents")
+	flagConfig.certFile = flags.String("mesos.cert_file", "MESOS_CERT_FILE", "", "path to client certificate")
+	flagConfig.keyFile = flags.String("mesos.key_file", "MESOS_KEY_FILE", "", "path to client certificate key")
+	flagConfig.logs = flags.String("mesos.logs", "MESOS_LOGS", "", "log locators for frameworks (example: ^aurora$=thermos;^spark$=glob:logs/*.out,logs/*.err)")
+}
+
+// FlagConfig returns the config for masters based on command line flags
+func FlagConfig(masters string) Config {
+	return Config{
+		Masters:           masters,
+		Scheme:            *flagConfig.scheme,
+		Principal:         *flagConfig.principal,
+		Secret:            *flagConfig.secret,
+		Token:             *flagConfig.token,
+		ServiceAccount:    *flagConfig.serviceAccount,
+		ServiceAccountKey: *flagConfig.serviceAccountKey,
+		LoginURL:          *flagConfig.loginURL,
+		CAFile:            *flagConfig.caFile,
+		CertFile:          *flagConfig.certFile,
+		KeyFile:           *flagConfig.keyFile,
+		Logs:              *flagConfig.logs,
+	}
+}
+
+// ReadConfigs reads configs of several clusters from the json file,
+// that maps cluster names to configs. Configs are sorted by name.
+func ReadConfigs(file string) ([]Config, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	named := map[string]Config{}
+	if err := json.NewDecoder(f).Decode(&named); err != nil {
+		return nil, fmt.Errorf("cannot decode cluster configs: %s", err)
+	}
+
+	configs := []Config{}
+	for name, config := range named {
+		if config.Masters == "" {
+			return nil, fmt.Errorf("no masters for cluster %s", name)
+		}
+
+		config.Name = name
+		configs = append(configs, config)
+	}
+
+	sort.Sort(byName(configs))
+
+	return configs, nil
+}
+
+// byName sorts cluster configs by their names
+type byName []Config
+
+func (c byName) Len() int {
+	return len(c)
+}
+
+func (c byName) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c byName) Less(i, j int) bool {
+	return c[i].Name < c[j].Name
+}
@@ -0,0 +1,53 @@
+package mesos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadConfigs(t *testing.T) {
+	file, err := ioutil.TempFile("", "complainer-clusters")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	_, err = file.WriteString(`{
+		"us-east": {"masters": "zk://zk1:2181/mesos", "principal": "complainer", "secret": "secret"},
+		"eu-west": {"masters": "http://master1:5050", "labels": {"complainer_slack_channel": "#eu-west"}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = file.Close()
+
+	configs, err := ReadConfigs(file.Name())
+	if err != nil {
+		t.Fatalf("Error reading configs: %s", err)
+	}
+
+	if len(configs) != 2 {
+		t.Fatalf("Unexpected configs: %+v", configs)
+	}
+
+	if configs[0].Name != "eu-west" || configs[0].Labels["complainer_slack_channel"] != "#eu-west" {
+		t.Errorf("Unexpected config: %+v", configs[0])
+	}
+
+	if configs[1].Name != "us-east" || configs[1].Masters != "zk://zk1:2181/mesos" || configs[1].Principal != "complainer" {
+		t.Errorf("Unexpected config: %+v", configs[1])
+	}
+
+	if err := ioutil.WriteFile(file.Name(), []byte(`{"us-east": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadConfigs(file.Name()); err == nil {
+		t.Errorf("Expected error reading config without masters")
+	}
+}
@@ -0,0 +1,198 @@
+package mesos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// stateDecoder walks master state without loading it into memory,
+// keeping only the parts needed to find failed tasks.
+type stateDecoder struct {
+	dec  *json.Decoder
+	keep func(task masterTask) bool
+}
+
+// decodeMasterState decodes master state from the reader, only tasks
+// accepted by keep function are retained.
+func decodeMasterState(r io.Reader, keep func(task masterTask) bool) (*masterState, error) {
+	d := &stateDecoder{
+		dec:  json.NewDecoder(r),
+		keep: keep,
+	}
+
+	state := &masterState{}
+
+	err := d.object(func(key string) (err error) {
+		switch key {
+		case "pid":
+			return d.dec.Decode(&state.Pid)
+		case "leader":
+			return d.dec.Decode(&state.Leader)
+		case "slaves":
+			return d.dec.Decode(&state.Slaves)
+		case "frameworks":
+			state.Frameworks, err = d.frameworks()
+			return err
+		case "completed_frameworks":
+			state.CompletedFrameworks, err = d.frameworks()
+			return err
+		default:
+			return d.skip()
+		}
+	})
+
+	return state, err
+}
+
+func (d *stateDecoder) frameworks() ([]masterFramework, error) {
+	frameworks := []masterFramework{}
+
+	err := d.array(func() error {
+		framework := masterFramework{}
+
+		err := d.object(func(key string) (err error) {
+			switch key {
+			case "name":
+				return d.dec.Decode(&framework.Name)
+			case "tasks":
+				framework.Tasks, err = d.tasks()
+				return err
+			case "completed_tasks":
+				framework.CompletedTasks, err = d.tasks()
+				return err
+			case "unreachable_tasks":
+				framework.UnreachableTasks, err = d.tasks()
+				return err
+			default:
+				return d.skip()
+			}
+		})
+
+		frameworks = append(frameworks, framework)
+
+		return err
+	})
+
+	return frameworks, err
+}
+
+func (d *stateDecoder) tasks() ([]masterTask, error) {
+	tasks := []masterTask{}
+
+	err := d.array(func() error {
+		task := masterTask{}
+		if err := d.dec.Decode(&task); err != nil {
+			return err
+		}
+
+		if d.keep(task) {
+			tasks = append(tasks, task)
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+// object calls fn for every key of the object, fn must consume the value
+func (d *stateDecoder) object(fn func(key string) error) error {
+	if ok, err := d.open(json.Delim('{')); !ok {
+		return err
+	}
+
+	for d.dec.More() {
+		token, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key: %v", token)
+		}
+
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.dec.Token()
+	return err
+}
+
+// array calls fn for every element of the array, fn must consume the element
+func (d *stateDecoder) array(fn func() error) error {
+	if ok, err := d.open(json.Delim('[')); !ok {
+		return err
+	}
+
+	for d.dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.dec.Token()
+	return err
+}
+
+// open consumes the opening delimiter, null values are skipped
+func (d *stateDecoder) open(delim json.Delim) (bool, error) {
+	token, err := d.dec.Token()
+	if err != nil {
+		return false, err
+	}
+
+	if token == nil {
+		return false, nil
+	}
+
+	if token != delim {
+		return false, fmt.Errorf("unexpected token %v, expected %v", token, delim)
+	}
+
+	return true, nil
+}
+
+// skip consumes the next value without keeping it in memory,
+// elements of arrays and objects are skipped one by one to keep
+// the decoder buffer small.
+func (d *stateDecoder) skip() error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('['):
+		for d.dec.More() {
+			if err := d.dec.Decode(&ignored{}); err != nil {
+				return err
+			}
+		}
+	case json.Delim('{'):
+		for d.dec.More() {
+			if _, err := d.dec.Token(); err != nil {
+				return err
+			}
+
+			if err := d.dec.Decode(&ignored{}); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	_, err = d.dec.Token()
+	return err
+}
+
+// ignored discards json value without decoding it
+type ignored struct{}
+
+func (i *ignored) UnmarshalJSON([]byte) error {
+	return nil
+}
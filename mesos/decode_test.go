@@ -0,0 +1,316 @@
+package mesos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+const stateFixture = "testdata/master_state.json"
+
+func keepFailed(task masterTask) bool {
+	return failedState(task.State)
+}
+
+func failureIDs(state *masterState) []string {
+	ids := []string{}
+	for _, failure := range NewCluster(nil).failuresFromLeader(state, "http") {
+		ids = append(ids, failure.ID)
+	}
+
+	return ids
+}
+
+func TestDecodeMasterState(t *testing.T) {
+	data, err := ioutil.ReadFile(stateFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := decodeMasterState(bytes.NewReader(data), keepFailed)
+	if err != nil {
+		t.Fatalf("Error decoding state: %s", err)
+	}
+
+	if state.Pid != "master@10.0.0.1:5050" || state.Leader != state.Pid {
+		t.Errorf("Unexpected pid %q and leader %q", state.Pid, state.Leader)
+	}
+
+	if len(state.Slaves) != 2 || state.Slaves[1].Host != "agent2.example.com" {
+		t.Errorf("Unexpected slaves: %+v", state.Slaves)
+	}
+
+	full := &masterState{}
+	if err := json.Unmarshal(data, full); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := failureIDs(full)
+	if got := failureIDs(state); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected failures %v, expected %v", got, expected)
+	}
+
+	failure := failureFromTask(state.Frameworks[0].CompletedTasks[0], "marathon", state.Slaves[0], "http")
+
+	if failure.AgentIP != "10.0.1.1" || failure.Attributes["rack"] != "r1" || failure.Attributes["zone"] != "a" {
+		t.Errorf("Unexpected agent %s with attributes %v", failure.AgentIP, failure.Attributes)
+	}
+
+	if failure.Resources.Mem == 0 || failure.Resources.CPUs == 0 {
+		t.Errorf("Unexpected resources: %+v", failure.Resources)
+	}
+
+	if len(state.Frameworks[0].CompletedTasks) != 1 {
+		t.Errorf("Expected finished task to be dropped, got %+v", state.Frameworks[0].CompletedTasks)
+	}
+}
+
+func TestDecodeMasterStateInvalid(t *testing.T) {
+	for _, data := range []string{`[]`, `{"frameworks": {}}`, `{"frameworks": [{"completed_tasks": [`} {
+		if _, err := decodeMasterState(bytes.NewReader([]byte(data)), keepFailed); err == nil {
+			t.Errorf("Expected error decoding %s", data)
+		}
+	}
+
+	state, err := decodeMasterState(bytes.NewReader([]byte(`{"frameworks": null, "slaves": null}`)), keepFailed)
+	if err != nil || len(state.Frameworks) != 0 {
+		t.Errorf("Unexpected result decoding null values: %+v, %v", state, err)
+	}
+}
+
+func TestFailuresHighWater(t *testing.T) {
+	data, err := ioutil.ReadFile(stateFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+
+	defer leader.Close()
+
+	cluster := newCluster(nil, &countingDetector{leader: leader.URL}, nil)
+
+	expected := [][]string{
+		{"web.5b6c7d8e-ace1-11e7-8e38-0242ac110002", "web.1a2b3c4d-ace1-11e7-8e38-0242ac110002", "nightly.7e8f9a0b"},
+		{"nightly.7e8f9a0b"},
+	}
+
+	for _, ids := range expected {
+		failures, err := cluster.Failures()
+		if err != nil {
+			t.Fatalf("Error getting failures: %s", err)
+		}
+
+		got := []string{}
+		for _, failure := range failures {
+			got = append(got, failure.ID)
+		}
+
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("Unexpected failures %v, expected %v", got, ids)
+		}
+	}
+}
+
+func TestFailuresLate(t *testing.T) {
+	data, err := ioutil.ReadFile(stateFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := map[string]interface{}{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+
+	current := data
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(current)
+	}))
+
+	defer leader.Close()
+
+	cluster := newCluster(nil, &countingDetector{leader: leader.URL}, nil)
+
+	if _, err := cluster.Failures(); err != nil {
+		t.Fatalf("Error getting failures: %s", err)
+	}
+
+	// The agent of the late failure has its clock two minutes behind
+	// the one of the latest failure seen before
+	framework := state["frameworks"].([]interface{})[0].(map[string]interface{})
+	framework["completed_tasks"] = append(framework["completed_tasks"].([]interface{}), map[string]interface{}{
+		"id":       "web.late",
+		"name":     "web",
+		"state":    "TASK_FAILED",
+		"slave_id": "",
+		"statuses": []interface{}{map[string]interface{}{"state": "TASK_FAILED", "timestamp": 1507599400.0 - 120}},
+	})
+
+	current, err = json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := cluster.Failures()
+	if err != nil {
+		t.Fatalf("Error getting failures: %s", err)
+	}
+
+	got := []string{}
+	for _, failure := range failures {
+		got = append(got, failure.ID)
+	}
+
+	if !reflect.DeepEqual(got, []string{"web.late", "nightly.7e8f9a0b"}) {
+		t.Errorf("Unexpected failures %v, expected the late one to be kept", got)
+	}
+}
+
+func TestFailuresOwned(t *testing.T) {
+	data, err := ioutil.ReadFile(stateFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+
+	defer leader.Close()
+
+	cluster := newCluster(nil, &countingDetector{leader: leader.URL}, nil)
+	cluster.UseOwner(func(failure complainer.Failure) bool {
+		return failure.Name != "web"
+	})
+
+	// Old failures of other shards are kept until shards move here
+	for i := 0; i < 2; i++ {
+		failures, err := cluster.Failures()
+		if err != nil {
+			t.Fatalf("Error getting failures: %s", err)
+		}
+
+		got := []string{}
+		for _, failure := range failures {
+			got = append(got, failure.ID)
+		}
+
+		expected := []string{"web.5b6c7d8e-ace1-11e7-8e38-0242ac110002", "web.1a2b3c4d-ace1-11e7-8e38-0242ac110002", "nightly.7e8f9a0b"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Unexpected failures %v on poll %d, expected %v", got, i, expected)
+		}
+	}
+}
+
+// largeState builds a state of a busy cluster from the recorded fixture
+func largeState(b *testing.B, tasks int) []byte {
+	data, err := ioutil.ReadFile(stateFixture)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	state := map[string]interface{}{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		b.Fatal(err)
+	}
+
+	framework := state["frameworks"].([]interface{})[0].(map[string]interface{})
+	running := framework["tasks"].([]interface{})[0].(map[string]interface{})
+	completed := framework["completed_tasks"].([]interface{})
+
+	active := []interface{}{}
+	finished := []interface{}{}
+
+	for i := 0; i < tasks; i++ {
+		task := map[string]interface{}{}
+		for k, v := range running {
+			task[k] = v
+		}
+
+		task["id"] = fmt.Sprintf("web.%d", i)
+		active = append(active, task)
+
+		task = map[string]interface{}{}
+		for k, v := range completed[i%len(completed)].(map[string]interface{}) {
+			task[k] = v
+		}
+
+		task["id"] = fmt.Sprintf("web.completed.%d", i)
+		finished = append(finished, task)
+	}
+
+	framework["tasks"] = active
+	framework["completed_tasks"] = finished
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return data
+}
+
+func BenchmarkDecodeMasterStateFull(b *testing.B) {
+	data := largeState(b, 10000)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		state := &masterState{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(state); err != nil {
+			b.Fatal(err)
+		}
+
+		_ = NewCluster(nil).failuresFromLeader(state, "http")
+	}
+}
+
+func BenchmarkDecodeMasterStateStreaming(b *testing.B) {
+	data := largeState(b, 10000)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		state, err := decodeMasterState(bytes.NewReader(data), keepFailed)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = NewCluster(nil).failuresFromLeader(state, "http")
+	}
+}
+
+func BenchmarkDecodeMasterStateHighWater(b *testing.B) {
+	data := largeState(b, 10000)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// Nothing is newer than the latest failure on subsequent polls
+	for i := 0; i < b.N; i++ {
+		state, err := decodeMasterState(bytes.NewReader(data), func(task masterTask) bool {
+			return failedState(task.State) && lastTimestamp(task) >= 1507599400
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = NewCluster(nil).failuresFromLeader(state, "http")
+	}
+}
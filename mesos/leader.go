@@ -0,0 +1,277 @@
+package mesos
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	// prefix of znodes that hold master info in json format
+	zookeeperInfoPrefix = "json.info_"
+	// default zookeeper port if none is specified
+	zookeeperDefaultPort = "2181"
+	// zookeeper session timeout
+	zookeeperTimeout = time.Second * 10
+)
+
+// leaderDetector finds the url of the leading master
+type leaderDetector interface {
+	Leader() (string, error)
+}
+
+// redirectDetector asks known masters where the leader is
+type redirectDetector struct {
+	masters []string
+	client  http.Client
+}
+
+func newRedirectDetector(masters []string, timeout time.Duration, transport http.RoundTripper) *redirectDetector {
+	return &redirectDetector{
+		masters: masters,
+		client: http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Leader returns the url of the leading master based on /master/redirect
+func (d *redirectDetector) Leader() (string, error) {
+	for _, master := range d.masters {
+		leader, err := d.redirect(master)
+		if err != nil {
+			log.Printf("Error finding leader with %s: %s", master, err)
+			continue
+		}
+
+		return leader, nil
+	}
+
+	return "", ErrNoMesosMaster
+}
+
+func (d *redirectDetector) redirect(master string) (string, error) {
+	resp, err := d.client.Get(master + "/master/redirect")
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	base, err := url.Parse(master)
+	if err != nil {
+		return "", err
+	}
+
+	// Location is protocol relative: //host:port
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+
+	// The leader is the master we asked, keep the path in case it is proxied
+	if location.Host == base.Host {
+		return master, nil
+	}
+
+	return (&url.URL{Scheme: location.Scheme, Host: location.Host}).String(), nil
+}
+
+// zookeeperClient is the subset of zookeeper connection needed to find the leader
+type zookeeperClient interface {
+	Children(path string) ([]string, *zk.Stat, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+}
+
+// zookeeperDetector reads the leading master info from zookeeper,
+// masters are reached with the scheme
+type zookeeperDetector struct {
+	client zookeeperClient
+	path   string
+	scheme string
+}
+
+// newZookeeperDetector creates a detector from zk://host1:port,host2:port/path url,
+// masters are reached with http unless the scheme is set
+func newZookeeperDetector(zkURL, scheme string) (*zookeeperDetector, error) {
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid master scheme %q: http or https expected", scheme)
+	}
+
+	servers, path, err := parseZookeeperURL(zkURL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, _, err := zk.Connect(servers, zookeeperTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zookeeperDetector{
+		client: conn,
+		path:   path,
+		scheme: scheme,
+	}, nil
+}
+
+func parseZookeeperURL(zkURL string) ([]string, string, error) {
+	if !strings.HasPrefix(zkURL, "zk://") {
+		return nil, "", fmt.Errorf("invalid zookeeper url %q: zk:// scheme expected", zkURL)
+	}
+
+	hosts := strings.TrimPrefix(zkURL, "zk://")
+	path := "/mesos"
+
+	if i := strings.Index(hosts, "/"); i != -1 {
+		if len(hosts) > i+1 {
+			path = strings.TrimSuffix(hosts[i:], "/")
+		}
+
+		hosts = hosts[:i]
+	}
+
+	// Credentials are not supported
+	if i := strings.LastIndex(hosts, "@"); i != -1 {
+		hosts = hosts[i+1:]
+	}
+
+	servers := []string{}
+	for _, host := range strings.Split(hosts, ",") {
+		if host == "" {
+			continue
+		}
+
+		if !strings.Contains(host, ":") {
+			host = host + ":" + zookeeperDefaultPort
+		}
+
+		servers = append(servers, host)
+	}
+
+	if len(servers) == 0 {
+		return nil, "", fmt.Errorf("invalid zookeeper url %q: no hosts", zkURL)
+	}
+
+	return servers, path, nil
+}
+
+// Leader returns the url of the master with the lowest sequence number
+func (d *zookeeperDetector) Leader() (string, error) {
+	children, _, err := d.client.Children(d.path)
+	if err != nil {
+		return "", fmt.Errorf("cannot list %s in zookeeper: %s", d.path, err)
+	}
+
+	candidates := []string{}
+	for _, child := range children {
+		if strings.HasPrefix(child, zookeeperInfoPrefix) {
+			candidates = append(candidates, child)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", ErrNoMesosMaster
+	}
+
+	sort.Sort(bySequence(candidates))
+
+	data, _, err := d.client.Get(d.path + "/" + candidates[0])
+	if err != nil {
+		return "", fmt.Errorf("cannot get %s from zookeeper: %s", candidates[0], err)
+	}
+
+	info := masterInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("cannot decode master info: %s", err)
+	}
+
+	return info.url(d.scheme)
+}
+
+// bySequence sorts znodes by their sequence number suffix
+type bySequence []string
+
+func (s bySequence) Len() int {
+	return len(s)
+}
+
+func (s bySequence) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s bySequence) Less(i, j int) bool {
+	return sequence(s[i]) < sequence(s[j])
+}
+
+func sequence(node string) int64 {
+	n, err := strconv.ParseInt(strings.TrimPrefix(node, zookeeperInfoPrefix), 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return n
+}
+
+type masterInfo struct {
+	Hostname string            `json:"hostname"`
+	Port     int               `json:"port"`
+	Pid      string            `json:"pid"`
+	Address  masterInfoAddress `json:"address"`
+}
+
+type masterInfoAddress struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+}
+
+func (i masterInfo) url(scheme string) (string, error) {
+	host := i.Address.Hostname
+	if host == "" {
+		host = i.Hostname
+	}
+
+	if host == "" {
+		host = i.Address.IP
+	}
+
+	port := i.Address.Port
+	if port == 0 {
+		port = i.Port
+	}
+
+	if host == "" || port == 0 {
+		// master@10.0.0.1:5050
+		if at := strings.Index(i.Pid, "@"); at != -1 {
+			return scheme + "://" + i.Pid[at+1:], nil
+		}
+
+		return "", fmt.Errorf("cannot find master address in %+v", i)
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
@@ -0,0 +1,263 @@
+package mesos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// newFollower creates a master that redirects to the leader
+func newFollower(leader string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "//"+strings.TrimPrefix(leader, "http://"))
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	}))
+}
+
+type fakeZookeeper struct {
+	children map[string][]string
+	data     map[string][]byte
+}
+
+func (f *fakeZookeeper) Children(path string) ([]string, *zk.Stat, error) {
+	if children, ok := f.children[path]; ok {
+		return children, &zk.Stat{}, nil
+	}
+
+	return nil, nil, zk.ErrNoNode
+}
+
+func (f *fakeZookeeper) Get(path string) ([]byte, *zk.Stat, error) {
+	if data, ok := f.data[path]; ok {
+		return data, &zk.Stat{}, nil
+	}
+
+	return nil, nil, zk.ErrNoNode
+}
+
+func TestParseZookeeperURL(t *testing.T) {
+	table := []struct {
+		url     string
+		servers []string
+		path    string
+		err     bool
+	}{
+		{
+			url:     "zk://zk1:2181,zk2:2182/mesos",
+			servers: []string{"zk1:2181", "zk2:2182"},
+			path:    "/mesos",
+		},
+		{
+			url:     "zk://user:pass@zk1,zk2/custom/path/",
+			servers: []string{"zk1:2181", "zk2:2181"},
+			path:    "/custom/path",
+		},
+		{
+			url:     "zk://zk1",
+			servers: []string{"zk1:2181"},
+			path:    "/mesos",
+		},
+		{
+			url: "http://zk1/mesos",
+			err: true,
+		},
+		{
+			url: "zk:///mesos",
+			err: true,
+		},
+	}
+
+	for _, tt := range table {
+		servers, path, err := parseZookeeperURL(tt.url)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Expected error parsing %q", tt.url)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Error parsing %q: %s", tt.url, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(servers, tt.servers) || path != tt.path {
+			t.Errorf("Parsing %q returned %v %q, expected %v %q", tt.url, servers, path, tt.servers, tt.path)
+		}
+	}
+}
+
+func TestZookeeperDetector(t *testing.T) {
+	detector := &zookeeperDetector{
+		path:   "/mesos",
+		scheme: "https",
+		client: &fakeZookeeper{
+			children: map[string][]string{
+				"/mesos": {"log_replicas", "json.info_0000000012", "json.info_0000000009", "info_0000000001"},
+			},
+			data: map[string][]byte{
+				"/mesos/json.info_0000000009": []byte(`{"address":{"hostname":"master2","ip":"10.0.0.2","port":5050},"hostname":"master2","pid":"master@10.0.0.2:5050","port":5050}`),
+				"/mesos/json.info_0000000012": []byte(`{"address":{"hostname":"master1","ip":"10.0.0.1","port":5050},"hostname":"master1","pid":"master@10.0.0.1:5050","port":5050}`),
+			},
+		},
+	}
+
+	leader, err := detector.Leader()
+	if err != nil {
+		t.Fatalf("Error detecting leader: %s", err)
+	}
+
+	if leader != "https://master2:5050" {
+		t.Errorf("Unexpected leader %q, expected https://master2:5050", leader)
+	}
+
+	detector.client = &fakeZookeeper{
+		children: map[string][]string{
+			"/mesos": {"log_replicas"},
+		},
+	}
+
+	if _, err := detector.Leader(); err != ErrNoMesosMaster {
+		t.Errorf("Expected %s without masters in zookeeper, got %s", ErrNoMesosMaster, err)
+	}
+}
+
+func TestMasterInfoURL(t *testing.T) {
+	table := []struct {
+		info   masterInfo
+		scheme string
+		url    string
+	}{
+		{
+			info:   masterInfo{Hostname: "master1", Port: 5050},
+			scheme: "http",
+			url:    "http://master1:5050",
+		},
+		{
+			info:   masterInfo{Address: masterInfoAddress{IP: "10.0.0.1", Port: 5051}},
+			scheme: "http",
+			url:    "http://10.0.0.1:5051",
+		},
+		{
+			info:   masterInfo{Pid: "master@10.0.0.3:5050"},
+			scheme: "http",
+			url:    "http://10.0.0.3:5050",
+		},
+		{
+			info:   masterInfo{Hostname: "master1", Port: 5050},
+			scheme: "https",
+			url:    "https://master1:5050",
+		},
+		{
+			info:   masterInfo{Pid: "master@10.0.0.3:5050"},
+			scheme: "https",
+			url:    "https://10.0.0.3:5050",
+		},
+	}
+
+	for _, tt := range table {
+		u, err := tt.info.url(tt.scheme)
+		if err != nil {
+			t.Errorf("Error getting url for %+v: %s", tt.info, err)
+			continue
+		}
+
+		if u != tt.url {
+			t.Errorf("Unexpected url %q for %+v, expected %q", u, tt.info, tt.url)
+		}
+	}
+}
+
+type countingDetector struct {
+	leader string
+	calls  int
+}
+
+func (d *countingDetector) Leader() (string, error) {
+	d.calls++
+
+	if d.leader == "" {
+		return "", errors.New("no leader")
+	}
+
+	return d.leader, nil
+}
+
+func TestFailuresCachesLeader(t *testing.T) {
+	requests := 0
+	leading := true
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		pid := "master@10.0.0.1:5050"
+		if !leading {
+			pid = "master@10.0.0.2:5050"
+		}
+
+		fmt.Fprintf(w, `{"pid": %q, "leader": "master@10.0.0.1:5050", "frameworks": []}`, pid)
+	}))
+
+	defer leader.Close()
+
+	detector := &countingDetector{leader: leader.URL}
+	cluster := newCluster(nil, detector, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cluster.Failures(); err != nil {
+			t.Fatalf("Error getting failures: %s", err)
+		}
+	}
+
+	if detector.calls != 1 {
+		t.Errorf("Expected leader to be detected once, detected %d times", detector.calls)
+	}
+
+	leading = false
+
+	if _, err := cluster.Failures(); err == nil {
+		t.Errorf("Expected an error getting failures from a master that is not leading")
+	}
+
+	if _, err := cluster.Failures(); err == nil {
+		t.Errorf("Expected an error getting failures from a master that is not leading")
+	}
+
+	if detector.calls != 2 {
+		t.Errorf("Expected leader to be detected again after a failure, detected %d times", detector.calls)
+	}
+
+	if requests != 5 {
+		t.Errorf("Expected 5 state requests, got %d", requests)
+	}
+}
+
+func TestRedirectDetector(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "//"+r.Host)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	}))
+
+	defer leader.Close()
+
+	follower := newFollower(leader.URL)
+	defer follower.Close()
+
+	detector := newRedirectDetector([]string{"http://127.0.0.1:1", follower.URL}, timeout, nil)
+
+	detected, err := detector.Leader()
+	if err != nil {
+		t.Fatalf("Error detecting leader: %s", err)
+	}
+
+	if detected != leader.URL {
+		t.Errorf("Unexpected leader %q, expected %q", detected, leader.URL)
+	}
+}
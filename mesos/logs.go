@@ -0,0 +1,257 @@
+package mesos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LogLocator finds stdout and stderr files of the task in its sandbox
+type LogLocator interface {
+	Locate(browse BrowseFunc, sandbox string) (stdout, stderr string, err error)
+}
+
+// BrowseFunc lists files in the directory on the agent
+type BrowseFunc func(dir string) ([]File, error)
+
+// File represents a file on the agent as returned by /files/browse
+type File struct {
+	Path  string  `json:"path"`
+	Mode  string  `json:"mode"`
+	Size  int64   `json:"size"`
+	MTime float64 `json:"mtime"`
+}
+
+func (f File) dir() bool {
+	return strings.HasPrefix(f.Mode, "d")
+}
+
+// ParseLogLocator creates log locator from its spec, supported specs:
+//
+// * sandbox - stdout and stderr in the sandbox root (default)
+// * thermos - logs of the latest failed process of Apache Aurora
+// * glob:<stdout>,<stderr> - latest files matching patterns relative to sandbox
+func ParseLogLocator(spec string) (LogLocator, error) {
+	switch {
+	case spec == "sandbox":
+		return sandboxLocator{}, nil
+	case spec == "thermos":
+		return thermosLocator{}, nil
+	case strings.HasPrefix(spec, "glob:"):
+		patterns := strings.Split(strings.TrimPrefix(spec, "glob:"), ",")
+		if len(patterns) != 2 {
+			return nil, fmt.Errorf("expected stdout and stderr patterns in %q", spec)
+		}
+
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+			}
+		}
+
+		return globLocator{stdout: patterns[0], stderr: patterns[1]}, nil
+	}
+
+	return nil, fmt.Errorf("unknown log locator %q", spec)
+}
+
+// sandboxLocator finds logs written by the executor into the sandbox root
+type sandboxLocator struct{}
+
+func (sandboxLocator) Locate(browse BrowseFunc, sandbox string) (string, string, error) {
+	return sandbox + "/stdout", sandbox + "/stderr", nil
+}
+
+// thermosLocator finds logs of Apache Aurora processes that Thermos
+// keeps in .logs/<process>/<run>/, the latest written stderr wins
+type thermosLocator struct{}
+
+func (thermosLocator) Locate(browse BrowseFunc, sandbox string) (string, string, error) {
+	processes, err := browse(sandbox + "/.logs")
+	if err != nil {
+		return "", "", err
+	}
+
+	latest := File{}
+
+	for _, process := range processes {
+		if !process.dir() {
+			continue
+		}
+
+		runs, err := browse(process.Path)
+		if err != nil {
+			return "", "", err
+		}
+
+		run := lastRun(runs)
+		if run == "" {
+			continue
+		}
+
+		files, err := browse(run)
+		if err != nil {
+			return "", "", err
+		}
+
+		for _, file := range files {
+			if path.Base(file.Path) == "stderr" && file.MTime >= latest.MTime {
+				latest = file
+			}
+		}
+	}
+
+	if latest.Path == "" {
+		return "", "", errors.New("cannot find thermos process logs")
+	}
+
+	dir := path.Dir(latest.Path)
+
+	return dir + "/stdout", dir + "/stderr", nil
+}
+
+// lastRun returns the directory of the latest process run
+func lastRun(runs []File) string {
+	numbers := map[int]string{}
+	keys := []int{}
+
+	for _, run := range runs {
+		n, err := strconv.Atoi(path.Base(run.Path))
+		if err != nil || !run.dir() {
+			continue
+		}
+
+		numbers[n] = run.Path
+		keys = append(keys, n)
+	}
+
+	if len(keys) == 0 {
+		return ""
+	}
+
+	sort.Ints(keys)
+
+	return numbers[keys[len(keys)-1]]
+}
+
+// globLocator finds the latest files matching patterns relative to sandbox,
+// only the last path element of patterns may contain wildcards
+type globLocator struct {
+	stdout string
+	stderr string
+}
+
+func (l globLocator) Locate(browse BrowseFunc, sandbox string) (string, string, error) {
+	stdout, err := latestMatch(browse, sandbox, l.stdout)
+	if err != nil {
+		return "", "", err
+	}
+
+	stderr, err := latestMatch(browse, sandbox, l.stderr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return stdout, stderr, nil
+}
+
+func latestMatch(browse BrowseFunc, sandbox, pattern string) (string, error) {
+	files, err := browse(path.Join(sandbox, path.Dir(pattern)))
+	if err != nil {
+		return "", err
+	}
+
+	latest := File{}
+	for _, file := range files {
+		if file.dir() {
+			continue
+		}
+
+		if ok, _ := path.Match(path.Base(pattern), path.Base(file.Path)); ok && file.MTime >= latest.MTime {
+			latest = file
+		}
+	}
+
+	if latest.Path == "" {
+		return "", fmt.Errorf("cannot find files matching %q", pattern)
+	}
+
+	return latest.Path, nil
+}
+
+// logRule picks the log locator for frameworks matching the regex
+type logRule struct {
+	framework *regexp.Regexp
+	locator   LogLocator
+}
+
+// parseLogRules parses rules in the following format:
+// <framework regex>=<locator spec>;<framework regex>=<locator spec>
+func parseLogRules(spec string) ([]logRule, error) {
+	rules := []logRule{}
+
+	for _, rule := range strings.Split(spec, ";") {
+		if rule == "" {
+			continue
+		}
+
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected <framework regex>=<locator> in %q", rule)
+		}
+
+		framework, err := regexp.Compile(parts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		locator, err := ParseLogLocator(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, logRule{framework: framework, locator: locator})
+	}
+
+	return rules, nil
+}
+
+// logLocator returns the locator for the framework, the first matching rule wins
+func logLocator(rules []logRule, framework string) LogLocator {
+	for _, rule := range rules {
+		if rule.framework.MatchString(framework) {
+			return rule.locator
+		}
+	}
+
+	return sandboxLocator{}
+}
+
+// browser returns function that lists files on the agent
+func (c *Cluster) browser(agent string) BrowseFunc {
+	return func(dir string) ([]File, error) {
+		resp, err := c.client.Get(agent + "/files/browse?path=" + url.QueryEscape(dir))
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("cannot browse %s: unexpected response status: %s", dir, resp.Status)
+		}
+
+		files := []File{}
+
+		return files, json.NewDecoder(resp.Body).Decode(&files)
+	}
+}
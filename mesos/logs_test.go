@@ -0,0 +1,180 @@
+package mesos
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+// fakeBrowse serves directory listings from the map
+func fakeBrowse(dirs map[string][]File) BrowseFunc {
+	return func(dir string) ([]File, error) {
+		if files, ok := dirs[dir]; ok {
+			return files, nil
+		}
+
+		return nil, errors.New("no such directory")
+	}
+}
+
+func TestParseLogLocator(t *testing.T) {
+	table := []struct {
+		spec    string
+		locator LogLocator
+	}{
+		{spec: "sandbox", locator: sandboxLocator{}},
+		{spec: "thermos", locator: thermosLocator{}},
+		{spec: "glob:logs/*.out,logs/*.err", locator: globLocator{stdout: "logs/*.out", stderr: "logs/*.err"}},
+		{spec: "glob:logs/*.out"},
+		{spec: "glob:[,stderr"},
+		{spec: "unknown"},
+	}
+
+	for _, tt := range table {
+		locator, err := ParseLogLocator(tt.spec)
+		if tt.locator == nil {
+			if err == nil {
+				t.Errorf("Expected error parsing %q", tt.spec)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Error parsing %q: %s", tt.spec, err)
+			continue
+		}
+
+		if locator != tt.locator {
+			t.Errorf("Unexpected locator %#v for %q, expected %#v", locator, tt.spec, tt.locator)
+		}
+	}
+}
+
+func TestLogRules(t *testing.T) {
+	rules, err := parseLogRules("^aurora$=thermos;^spark=glob:logs/*.out,logs/*.err")
+	if err != nil {
+		t.Fatalf("Error parsing rules: %s", err)
+	}
+
+	if locator := logLocator(rules, "aurora"); locator != (thermosLocator{}) {
+		t.Errorf("Unexpected locator for aurora: %#v", locator)
+	}
+
+	if locator := logLocator(rules, "spark-jobs"); locator != (globLocator{stdout: "logs/*.out", stderr: "logs/*.err"}) {
+		t.Errorf("Unexpected locator for spark: %#v", locator)
+	}
+
+	if locator := logLocator(rules, "marathon"); locator != (sandboxLocator{}) {
+		t.Errorf("Unexpected locator for marathon: %#v", locator)
+	}
+
+	for _, spec := range []string{"thermos", "[=thermos", "^aurora$=unknown"} {
+		if _, err := parseLogRules(spec); err == nil {
+			t.Errorf("Expected error parsing %q", spec)
+		}
+	}
+}
+
+func TestThermosLocator(t *testing.T) {
+	browse := fakeBrowse(map[string][]File{
+		"/sandbox/.logs": {
+			{Path: "/sandbox/.logs/setup", Mode: "drwxr-xr-x"},
+			{Path: "/sandbox/.logs/server", Mode: "drwxr-xr-x"},
+		},
+		"/sandbox/.logs/setup": {
+			{Path: "/sandbox/.logs/setup/0", Mode: "drwxr-xr-x"},
+		},
+		"/sandbox/.logs/setup/0": {
+			{Path: "/sandbox/.logs/setup/0/stdout", Mode: "-rw-r--r--", MTime: 100},
+			{Path: "/sandbox/.logs/setup/0/stderr", Mode: "-rw-r--r--", MTime: 100},
+		},
+		"/sandbox/.logs/server": {
+			{Path: "/sandbox/.logs/server/0", Mode: "drwxr-xr-x"},
+			{Path: "/sandbox/.logs/server/10", Mode: "drwxr-xr-x"},
+			{Path: "/sandbox/.logs/server/2", Mode: "drwxr-xr-x"},
+		},
+		"/sandbox/.logs/server/10": {
+			{Path: "/sandbox/.logs/server/10/stdout", Mode: "-rw-r--r--", MTime: 200},
+			{Path: "/sandbox/.logs/server/10/stderr", Mode: "-rw-r--r--", MTime: 200},
+		},
+	})
+
+	stdout, stderr, err := thermosLocator{}.Locate(browse, "/sandbox")
+	if err != nil {
+		t.Fatalf("Error locating logs: %s", err)
+	}
+
+	if stdout != "/sandbox/.logs/server/10/stdout" || stderr != "/sandbox/.logs/server/10/stderr" {
+		t.Errorf("Unexpected logs %s and %s", stdout, stderr)
+	}
+
+	if _, _, err := (thermosLocator{}).Locate(fakeBrowse(nil), "/sandbox"); err == nil {
+		t.Errorf("Expected error locating logs without thermos")
+	}
+}
+
+func TestGlobLocator(t *testing.T) {
+	browse := fakeBrowse(map[string][]File{
+		"/sandbox/logs": {
+			{Path: "/sandbox/logs/old.out", Mode: "-rw-r--r--", MTime: 100},
+			{Path: "/sandbox/logs/new.out", Mode: "-rw-r--r--", MTime: 200},
+			{Path: "/sandbox/logs/dir.out", Mode: "drwxr-xr-x", MTime: 300},
+			{Path: "/sandbox/logs/app.err", Mode: "-rw-r--r--", MTime: 150},
+		},
+	})
+
+	stdout, stderr, err := globLocator{stdout: "logs/*.out", stderr: "logs/*.err"}.Locate(browse, "/sandbox")
+	if err != nil {
+		t.Fatalf("Error locating logs: %s", err)
+	}
+
+	if stdout != "/sandbox/logs/new.out" || stderr != "/sandbox/logs/app.err" {
+		t.Errorf("Unexpected logs %s and %s", stdout, stderr)
+	}
+
+	if _, _, err := (globLocator{stdout: "logs/*.log", stderr: "logs/*.err"}).Locate(browse, "/sandbox"); err == nil {
+		t.Errorf("Expected error locating logs without matching files")
+	}
+}
+
+func TestLocateLogs(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/state":
+			_, _ = w.Write([]byte(`{"frameworks": [{"executors": [{"id": "job.0", "directory": "/sandbox/job"}]}]}`))
+		case "/files/browse":
+			if r.URL.Query().Get("path") != "/sandbox/job/logs" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			_, _ = w.Write([]byte(`[{"path": "/sandbox/job/logs/job.out", "mode": "-rw-r--r--", "mtime": 100}, {"path": "/sandbox/job/logs/job.err", "mode": "-rw-r--r--", "mtime": 100}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer agent.Close()
+
+	cluster, err := NewClusterFromConfig(Config{Masters: "http://master1", Logs: "^spark$=glob:logs/*.out,logs/*.err"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutURL, stderrURL, err := cluster.Logs(complainer.Failure{ID: "job.0", Framework: "spark", AgentURL: agent.URL})
+	if err != nil {
+		t.Fatalf("Error getting logs: %s", err)
+	}
+
+	if stdoutURL != agent.URL+"/files/download?path=/sandbox/job/logs/job.out" || stderrURL != agent.URL+"/files/download?path=/sandbox/job/logs/job.err" {
+		t.Errorf("Unexpected log urls %s and %s", stdoutURL, stderrURL)
+	}
+
+	if _, _, err := cluster.LocateLogs(complainer.Failure{ID: "job.0", AgentURL: agent.URL}, thermosLocator{}); err == nil {
+		t.Errorf("Expected error locating thermos logs")
+	}
+}
@@ -0,0 +1,29 @@
+package mesos
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// Command exited with status 1
+	// Container exited with status 137
+	exitCodeRegexp = regexp.MustCompile(`exited with status (-?\d+)`)
+	// Command terminated with signal Killed (pid: 123)
+	signalRegexp = regexp.MustCompile(`terminated with signal ([^(]*[^ (])`)
+)
+
+// parseExit extracts exit code or signal from the executor status message
+func parseExit(message string) (*int, string) {
+	if m := exitCodeRegexp.FindStringSubmatch(message); m != nil {
+		if code, err := strconv.Atoi(m[1]); err == nil {
+			return &code, ""
+		}
+	}
+
+	if m := signalRegexp.FindStringSubmatch(message); m != nil {
+		return nil, m[1]
+	}
+
+	return nil, ""
+}
@@ -0,0 +1,31 @@
+package mesos
+
+import "testing"
+
+func TestParseExit(t *testing.T) {
+	table := []struct {
+		message  string
+		exitCode int
+		exited   bool
+		signal   string
+	}{
+		{message: "Command exited with status 1", exitCode: 1, exited: true},
+		{message: "Container exited with status 137", exitCode: 137, exited: true},
+		{message: "Command terminated with signal Killed", signal: "Killed"},
+		{message: "Command terminated with signal Segmentation fault (pid: 1234)", signal: "Segmentation fault"},
+		{message: "Memory limit exceeded: Requested: 64MB Maximum Used: 64MB"},
+		{message: ""},
+	}
+
+	for _, tt := range table {
+		exitCode, signal := parseExit(tt.message)
+
+		if tt.exited != (exitCode != nil) || (exitCode != nil && *exitCode != tt.exitCode) {
+			t.Errorf("Unexpected exit code for %q: %v", tt.message, exitCode)
+		}
+
+		if signal != tt.signal {
+			t.Errorf("Unexpected signal for %q: %q, expected %q", tt.message, signal, tt.signal)
+		}
+	}
+}
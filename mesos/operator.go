@@ -0,0 +1,263 @@
+package mesos
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Types below mirror the JSON representation of the v1 Operator API:
+// http://mesos.apache.org/documentation/latest/operator-http-api/
+
+const (
+	operatorEventSubscribed     = "SUBSCRIBED"
+	operatorEventTaskAdded      = "TASK_ADDED"
+	operatorEventTaskUpdated    = "TASK_UPDATED"
+	operatorEventAgentAdded     = "AGENT_ADDED"
+	operatorEventFrameworkAdded = "FRAMEWORK_ADDED"
+)
+
+type operatorCall struct {
+	Type string `json:"type"`
+}
+
+type operatorEvent struct {
+	Type           string                  `json:"type"`
+	Subscribed     *operatorSubscribed     `json:"subscribed"`
+	TaskAdded      *operatorTaskAdded      `json:"task_added"`
+	TaskUpdated    *operatorTaskUpdated    `json:"task_updated"`
+	AgentAdded     *operatorAgentAdded     `json:"agent_added"`
+	FrameworkAdded *operatorFrameworkAdded `json:"framework_added"`
+}
+
+type operatorSubscribed struct {
+	GetState                 operatorState `json:"get_state"`
+	HeartbeatIntervalSeconds float64       `json:"heartbeat_interval_seconds"`
+}
+
+type operatorTaskAdded struct {
+	Task operatorTask `json:"task"`
+}
+
+type operatorTaskUpdated struct {
+	FrameworkID operatorID         `json:"framework_id"`
+	Status      operatorTaskStatus `json:"status"`
+	State       string             `json:"state"`
+}
+
+type operatorAgentAdded struct {
+	Agent operatorAgent `json:"agent"`
+}
+
+type operatorFrameworkAdded struct {
+	Framework operatorFramework `json:"framework"`
+}
+
+type operatorState struct {
+	GetTasks      operatorTasks      `json:"get_tasks"`
+	GetFrameworks operatorFrameworks `json:"get_frameworks"`
+	GetAgents     operatorAgents     `json:"get_agents"`
+}
+
+type operatorTasks struct {
+	Tasks            []operatorTask `json:"tasks"`
+	CompletedTasks   []operatorTask `json:"completed_tasks"`
+	UnreachableTasks []operatorTask `json:"unreachable_tasks"`
+}
+
+type operatorFrameworks struct {
+	Frameworks          []operatorFramework `json:"frameworks"`
+	CompletedFrameworks []operatorFramework `json:"completed_frameworks"`
+}
+
+type operatorFramework struct {
+	FrameworkInfo operatorFrameworkInfo `json:"framework_info"`
+}
+
+type operatorFrameworkInfo struct {
+	ID   operatorID `json:"id"`
+	Name string     `json:"name"`
+}
+
+type operatorAgents struct {
+	Agents []operatorAgent `json:"agents"`
+}
+
+type operatorAgent struct {
+	AgentInfo operatorAgentInfo `json:"agent_info"`
+	Pid       string            `json:"pid"`
+}
+
+type operatorAgentInfo struct {
+	ID         operatorID          `json:"id"`
+	Hostname   string              `json:"hostname"`
+	Port       int                 `json:"port"`
+	Attributes []operatorAttribute `json:"attributes"`
+}
+
+type operatorAttribute struct {
+	Name string `json:"name"`
+	operatorValue
+}
+
+type operatorResource struct {
+	Name string `json:"name"`
+	operatorValue
+}
+
+type operatorValue struct {
+	Type   string          `json:"type"`
+	Scalar *operatorScalar `json:"scalar"`
+	Ranges *operatorRanges `json:"ranges"`
+	Set    *operatorSet    `json:"set"`
+	Text   *operatorText   `json:"text"`
+}
+
+type operatorScalar struct {
+	Value float64 `json:"value"`
+}
+
+type operatorRanges struct {
+	Range []operatorRange `json:"range"`
+}
+
+type operatorRange struct {
+	Begin uint64 `json:"begin"`
+	End   uint64 `json:"end"`
+}
+
+type operatorSet struct {
+	Item []string `json:"item"`
+}
+
+type operatorText struct {
+	Value string `json:"value"`
+}
+
+type operatorTask struct {
+	Name        string               `json:"name"`
+	TaskID      operatorID           `json:"task_id"`
+	FrameworkID operatorID           `json:"framework_id"`
+	AgentID     operatorID           `json:"agent_id"`
+	ExecutorID  operatorID           `json:"executor_id"`
+	State       string               `json:"state"`
+	Statuses    []operatorTaskStatus `json:"statuses"`
+	Labels      operatorLabels       `json:"labels"`
+	Container   masterContainer      `json:"container"`
+	Resources   []operatorResource   `json:"resources"`
+}
+
+type operatorTaskStatus struct {
+	TaskID    operatorID `json:"task_id"`
+	AgentID   operatorID `json:"agent_id"`
+	State     string     `json:"state"`
+	Message   string     `json:"message"`
+	Reason    string     `json:"reason"`
+	Source    string     `json:"source"`
+	Timestamp float64    `json:"timestamp"`
+}
+
+type operatorLabels struct {
+	Labels []masterLabel `json:"labels"`
+}
+
+type operatorID struct {
+	Value string `json:"value"`
+}
+
+// masterTask converts the task into the representation used by master state
+func (t operatorTask) masterTask() masterTask {
+	statuses := make([]masterTaskStatus, 0, len(t.Statuses))
+	for _, status := range t.Statuses {
+		statuses = append(statuses, status.masterTaskStatus())
+	}
+
+	return masterTask{
+		ID:        t.TaskID.Value,
+		Name:      t.Name,
+		State:     t.State,
+		SlaveID:   t.AgentID.Value,
+		Executor:  t.ExecutorID.Value,
+		Labels:    t.Labels.Labels,
+		Container: t.Container,
+		Statuses:  statuses,
+		Resources: masterResourcesOf(t.Resources),
+	}
+}
+
+// masterResourcesOf sums resources the same way master state does
+func masterResourcesOf(resources []operatorResource) masterResources {
+	result := masterResources{}
+	ports := []operatorRange{}
+
+	for _, resource := range resources {
+		switch {
+		case resource.Scalar != nil && resource.Name == "cpus":
+			result.CPUs += resource.Scalar.Value
+		case resource.Scalar != nil && resource.Name == "mem":
+			result.Mem += resource.Scalar.Value
+		case resource.Scalar != nil && resource.Name == "disk":
+			result.Disk += resource.Scalar.Value
+		case resource.Scalar != nil && resource.Name == "gpus":
+			result.GPUs += resource.Scalar.Value
+		case resource.Ranges != nil && resource.Name == "ports":
+			ports = append(ports, resource.Ranges.Range...)
+		}
+	}
+
+	if len(ports) > 0 {
+		result.Ports = formatRanges(ports)
+	}
+
+	return result
+}
+
+// value returns the value as represented in master state
+func (v operatorValue) value() interface{} {
+	switch {
+	case v.Scalar != nil:
+		return v.Scalar.Value
+	case v.Ranges != nil:
+		return formatRanges(v.Ranges.Range)
+	case v.Set != nil:
+		return "{" + strings.Join(v.Set.Item, ", ") + "}"
+	case v.Text != nil:
+		return v.Text.Value
+	}
+
+	return ""
+}
+
+func formatRanges(ranges []operatorRange) string {
+	formatted := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		formatted = append(formatted, fmt.Sprintf("%d-%d", r.Begin, r.End))
+	}
+
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
+
+// masterSlave converts the agent into the representation used by master state
+func (a operatorAgent) masterSlave() masterSlave {
+	attributes := map[string]interface{}{}
+	for _, attribute := range a.AgentInfo.Attributes {
+		attributes[attribute.Name] = attribute.value()
+	}
+
+	return masterSlave{
+		ID:         a.AgentInfo.ID.Value,
+		Pid:        a.Pid,
+		Host:       a.AgentInfo.Hostname,
+		Port:       a.AgentInfo.Port,
+		Attributes: attributes,
+	}
+}
+
+func (s operatorTaskStatus) masterTaskStatus() masterTaskStatus {
+	return masterTaskStatus{
+		State:     s.State,
+		Message:   s.Message,
+		Reason:    s.Reason,
+		Source:    s.Source,
+		Timestamp: s.Timestamp,
+	}
+}
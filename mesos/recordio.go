@@ -0,0 +1,41 @@
+package mesos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// recordReader reads RecordIO framed messages used by Mesos streaming APIs:
+// each record is prefixed with its length in bytes and a newline.
+type recordReader struct {
+	reader *bufio.Reader
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{
+		reader: bufio.NewReader(r),
+	}
+}
+
+// ReadRecord returns the next record from the stream
+func (r *recordReader) ReadRecord() ([]byte, error) {
+	header, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := strconv.ParseUint(strings.TrimSpace(header), 10, 31)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record length %q: %s", header, err)
+	}
+
+	record := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
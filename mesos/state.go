@@ -1,15 +1,34 @@
 package mesos
 
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+)
+
+const (
+	// port agents listen on unless configured otherwise
+	defaultAgentPort = 5051
+	// type of the executor that runs task groups
+	defaultExecutorType = "DEFAULT"
+)
+
 type masterState struct {
-	Frameworks []masterFramework `json:"frameworks"`
-	Slaves     []masterSlave     `json:"slaves"`
-	Pid        string            `json:"pid"`
-	Leader     string            `json:"leader"`
+	Frameworks          []masterFramework `json:"frameworks"`
+	CompletedFrameworks []masterFramework `json:"completed_frameworks"`
+	Slaves              []masterSlave     `json:"slaves"`
+	Pid                 string            `json:"pid"`
+	Leader              string            `json:"leader"`
 }
 
 type masterFramework struct {
-	Name           string       `json:"name"`
-	CompletedTasks []masterTask `json:"completed_tasks"`
+	Name             string       `json:"name"`
+	Tasks            []masterTask `json:"tasks"`
+	CompletedTasks   []masterTask `json:"completed_tasks"`
+	UnreachableTasks []masterTask `json:"unreachable_tasks"`
 }
 
 type masterTask struct {
@@ -17,11 +36,21 @@ type masterTask struct {
 	Name      string             `json:"name"`
 	State     string             `json:"state"`
 	SlaveID   string             `json:"slave_id"`
+	Executor  string             `json:"executor_id"`
+	Resources masterResources    `json:"resources"`
 	Labels    []masterLabel      `json:"labels"`
 	Container masterContainer    `json:"container"`
 	Statuses  []masterTaskStatus `json:"statuses"`
 }
 
+type masterResources struct {
+	CPUs  float64 `json:"cpus"`
+	Mem   float64 `json:"mem"`
+	Disk  float64 `json:"disk"`
+	GPUs  float64 `json:"gpus"`
+	Ports string  `json:"ports"`
+}
+
 type masterContainer struct {
 	Type   string       `json:"type"`
 	Docker masterDocker `json:"docker"`
@@ -33,12 +62,71 @@ type masterDocker struct {
 
 type masterTaskStatus struct {
 	State     string  `json:"state"`
+	Message   string  `json:"message"`
+	Reason    string  `json:"reason"`
+	Source    string  `json:"source"`
 	Timestamp float64 `json:"timestamp"`
 }
 
 type masterSlave struct {
-	ID   string `json:"id"`
-	Host string `json:"hostname"`
+	ID         string                 `json:"id"`
+	Pid        string                 `json:"pid"`
+	Host       string                 `json:"hostname"`
+	Port       int                    `json:"port"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// ip returns the ip address the agent advertises in its pid
+func (s masterSlave) ip() string {
+	at := strings.LastIndex(s.Pid, "@")
+	if at == -1 {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(s.Pid[at+1:])
+	if err != nil {
+		return ""
+	}
+
+	return host
+}
+
+// attributes returns agent attributes as strings, scalars
+// are numbers and ranges are strings like "[1-2, 5-6]"
+func (s masterSlave) attributes() map[string]string {
+	attributes := map[string]string{}
+	for k, v := range s.Attributes {
+		if value, ok := v.(float64); ok {
+			attributes[k] = strconv.FormatFloat(value, 'f', -1, 64)
+		} else {
+			attributes[k] = fmt.Sprint(v)
+		}
+	}
+
+	return attributes
+}
+
+// url returns the address of the agent http endpoint, the address from pid
+// is preferred since hostnames of agents that advertise ips may not resolve
+func (s masterSlave) url(scheme string) string {
+	host := ""
+
+	if at := strings.LastIndex(s.Pid, "@"); at != -1 {
+		host = s.Pid[at+1:]
+	} else if s.Host != "" {
+		port := s.Port
+		if port == 0 {
+			port = defaultAgentPort
+		}
+
+		host = net.JoinHostPort(s.Host, strconv.Itoa(port))
+	}
+
+	if host == "" {
+		return ""
+	}
+
+	return scheme + "://" + host
 }
 
 type masterLabel struct {
@@ -57,6 +145,40 @@ type slaveFramework struct {
 }
 
 type slaveExecutor struct {
-	ID        string `json:"id"`
-	Directory string `json:"directory"`
+	ID             string      `json:"id"`
+	Type           string      `json:"type"`
+	Directory      string      `json:"directory"`
+	Tasks          []slaveTask `json:"tasks"`
+	QueuedTasks    []slaveTask `json:"queued_tasks"`
+	CompletedTasks []slaveTask `json:"completed_tasks"`
+}
+
+type slaveTask struct {
+	ID string `json:"id"`
+}
+
+// runs reports whether the executor is responsible for the task
+func (e slaveExecutor) runs(failure complainer.Failure) bool {
+	// Command and docker executors are named after their only task
+	if e.ID == failure.ID || (failure.Executor != "" && e.ID == failure.Executor) {
+		return true
+	}
+
+	for _, task := range append(append(e.Tasks, e.QueuedTasks...), e.CompletedTasks...) {
+		if task.ID == failure.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sandbox returns the sandbox directory of the task run by the executor,
+// tasks of the default executor run in nested containers with their own sandboxes
+func (e slaveExecutor) sandbox(failure complainer.Failure) string {
+	if e.Type == defaultExecutorType && e.ID != failure.ID {
+		return e.Directory + "/tasks/" + failure.ID
+	}
+
+	return e.Directory
 }
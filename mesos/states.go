@@ -0,0 +1,97 @@
+package mesos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultStates is the default list of task states that are considered failures
+const DefaultStates = "TASK_FAILED,TASK_ERROR,TASK_LOST"
+
+// runningState is the state of tasks that are up
+const runningState = "TASK_RUNNING"
+
+// candidateStates are the states that can be considered failures
+var candidateStates = States{
+	"TASK_FAILED":           true,
+	"TASK_KILLED":           true,
+	"TASK_ERROR":            true,
+	"TASK_LOST":             true,
+	"TASK_DROPPED":          true,
+	"TASK_UNREACHABLE":      true,
+	"TASK_GONE":             true,
+	"TASK_GONE_BY_OPERATOR": true,
+	"TASK_UNKNOWN":          true,
+}
+
+// partitionStates replace TASK_LOST for partition-aware frameworks,
+// TASK_UNKNOWN is left out as it is only reported when listed
+var partitionStates = []string{
+	"TASK_DROPPED",
+	"TASK_UNREACHABLE",
+	"TASK_GONE",
+	"TASK_GONE_BY_OPERATOR",
+}
+
+// States is a set of task states that are considered failures
+type States map[string]bool
+
+// ParseStates parses comma separated list of task states, TASK_ prefix
+// is optional. The resulting set is normalized: TASK_LOST and the states
+// that replace it for partition-aware frameworks always go together.
+func ParseStates(list string) (States, error) {
+	states := States{}
+
+	for _, state := range strings.Split(list, ",") {
+		state = strings.ToUpper(strings.TrimSpace(state))
+		if state == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(state, "TASK_") {
+			state = "TASK_" + state
+		}
+
+		if !candidateStates[state] {
+			return nil, fmt.Errorf("unsupported failure state: %s", state)
+		}
+
+		states[state] = true
+	}
+
+	lost := states["TASK_LOST"]
+	for _, state := range partitionStates {
+		lost = lost || states[state]
+	}
+
+	if lost {
+		states["TASK_LOST"] = true
+		for _, state := range partitionStates {
+			states[state] = true
+		}
+	}
+
+	return states, nil
+}
+
+// Contains returns whether the task state is in the set
+func (s States) Contains(state string) bool {
+	return s[state]
+}
+
+func (s States) String() string {
+	list := []string{}
+	for state := range s {
+		list = append(list, state)
+	}
+
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
+
+// failedState returns whether the task state can be considered a failure
+func failedState(state string) bool {
+	return candidateStates[state]
+}
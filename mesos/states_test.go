@@ -0,0 +1,64 @@
+package mesos
+
+import "testing"
+
+func TestParseStates(t *testing.T) {
+	table := []struct {
+		list     string
+		expected string
+		err      bool
+	}{
+		{
+			list:     "TASK_FAILED,TASK_ERROR",
+			expected: "TASK_ERROR,TASK_FAILED",
+		},
+		{
+			list:     "failed, killed",
+			expected: "TASK_FAILED,TASK_KILLED",
+		},
+		{
+			list:     DefaultStates,
+			expected: "TASK_DROPPED,TASK_ERROR,TASK_FAILED,TASK_GONE,TASK_GONE_BY_OPERATOR,TASK_LOST,TASK_UNREACHABLE",
+		},
+		{
+			list:     "TASK_UNREACHABLE",
+			expected: "TASK_DROPPED,TASK_GONE,TASK_GONE_BY_OPERATOR,TASK_LOST,TASK_UNREACHABLE",
+		},
+		{
+			list:     "unknown",
+			expected: "TASK_UNKNOWN",
+		},
+		{
+			list:     "lost,unknown",
+			expected: "TASK_DROPPED,TASK_GONE,TASK_GONE_BY_OPERATOR,TASK_LOST,TASK_UNKNOWN,TASK_UNREACHABLE",
+		},
+		{
+			list: "TASK_FINISHED",
+			err:  true,
+		},
+		{
+			list: "TASK_WAT",
+			err:  true,
+		},
+	}
+
+	for _, tt := range table {
+		states, err := ParseStates(tt.list)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Expected error parsing %q", tt.list)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Error parsing %q: %s", tt.list, err)
+			continue
+		}
+
+		if states.String() != tt.expected {
+			t.Errorf("Parsing %q returned %s, expected %s", tt.list, states, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package mesos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+// ErrMissedHeartbeats indicates that the master stopped sending heartbeats
+var ErrMissedHeartbeats = errors.New("mesos master missed heartbeats")
+
+const (
+	// heartbeat interval to use until the master announces its own
+	defaultHeartbeatInterval = time.Second * 15
+	// number of heartbeats that can be missed before giving up on the master
+	missedHeartbeats = 3
+)
+
+// Subscribe connects to the operator API of the leading master and sends
+// failures to the channel as they happen. The subscribed callback is called
+// once the master accepts the subscription. Subscribe blocks until the
+// connection is interrupted, call it again to reconnect to the new leader.
+func (c *Cluster) Subscribe(failures chan<- complainer.Failure, subscribed func()) error {
+	master, err := c.leaderURL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.subscribe(master)
+	if err != nil {
+		c.resetLeader()
+		return fmt.Errorf("cannot subscribe to %s: %s", master, err)
+	}
+
+	err = c.stream(resp.Body, agentScheme(master), failures, subscribed)
+
+	// The leader is likely gone, look for the new one on reconnect
+	c.resetLeader()
+
+	return err
+}
+
+func (c *Cluster) subscribe(master string) (*http.Response, error) {
+	body, err := json.Marshal(operatorCall{Type: "SUBSCRIBE"})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", master+"/api/v1", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+
+		// Masters that are not leading redirect to the leader
+		if resp.StatusCode == http.StatusTemporaryRedirect {
+			return nil, fmt.Errorf("not a leader, redirected to %s", resp.Header.Get("Location"))
+		}
+
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (c *Cluster) stream(body io.ReadCloser, scheme string, failures chan<- complainer.Failure, subscribed func()) error {
+	defer func() {
+		_ = body.Close()
+	}()
+
+	expired := make(chan struct{})
+	interval := defaultHeartbeatInterval
+
+	// Closing the body unblocks the reader if the master goes silent
+	watchdog := time.AfterFunc(interval*missedHeartbeats, func() {
+		close(expired)
+		_ = body.Close()
+	})
+
+	defer watchdog.Stop()
+
+	reader := newRecordReader(body)
+	sub := newSubscription(scheme)
+
+	for {
+		record, err := reader.ReadRecord()
+		if err != nil {
+			select {
+			case <-expired:
+				return ErrMissedHeartbeats
+			default:
+				return err
+			}
+		}
+
+		event := operatorEvent{}
+		if err := json.Unmarshal(record, &event); err != nil {
+			return fmt.Errorf("cannot decode event: %s", err)
+		}
+
+		if event.Type == operatorEventSubscribed && event.Subscribed != nil {
+			if event.Subscribed.HeartbeatIntervalSeconds > 0 {
+				interval = time.Duration(event.Subscribed.HeartbeatIntervalSeconds * float64(time.Second))
+			}
+
+			subscribed()
+		}
+
+		// Slow consumers should not be mistaken for a silent master
+		if !watchdog.Stop() {
+			return ErrMissedHeartbeats
+		}
+
+		for _, failure := range sub.handle(event) {
+			failures <- c.annotate(failure)
+		}
+
+		watchdog.Reset(interval * missedHeartbeats)
+	}
+}
+
+// subscription keeps track of the cluster state to turn task updates into failures
+type subscription struct {
+	frameworks map[string]string
+	agents     map[string]masterSlave
+	tasks      map[string]operatorTask
+	scheme     string
+}
+
+func newSubscription(scheme string) *subscription {
+	return &subscription{
+		scheme:     scheme,
+		frameworks: map[string]string{},
+		agents:     map[string]masterSlave{},
+		tasks:      map[string]operatorTask{},
+	}
+}
+
+func (s *subscription) handle(event operatorEvent) []complainer.Failure {
+	switch {
+	case event.Type == operatorEventSubscribed && event.Subscribed != nil:
+		return s.handleSubscribed(event.Subscribed.GetState)
+	case event.Type == operatorEventTaskAdded && event.TaskAdded != nil:
+		s.tasks[event.TaskAdded.Task.TaskID.Value] = event.TaskAdded.Task
+	case event.Type == operatorEventTaskUpdated && event.TaskUpdated != nil:
+		return s.handleTaskUpdated(event.TaskUpdated)
+	case event.Type == operatorEventAgentAdded && event.AgentAdded != nil:
+		s.addAgent(event.AgentAdded.Agent)
+	case event.Type == operatorEventFrameworkAdded && event.FrameworkAdded != nil:
+		s.addFramework(event.FrameworkAdded.Framework)
+	}
+
+	return nil
+}
+
+func (s *subscription) handleSubscribed(state operatorState) []complainer.Failure {
+	for _, framework := range state.GetFrameworks.Frameworks {
+		s.addFramework(framework)
+	}
+
+	for _, framework := range state.GetFrameworks.CompletedFrameworks {
+		s.addFramework(framework)
+	}
+
+	for _, agent := range state.GetAgents.Agents {
+		s.addAgent(agent)
+	}
+
+	for _, task := range state.GetTasks.Tasks {
+		s.tasks[task.TaskID.Value] = task
+	}
+
+	// Failures that happened while we were not subscribed,
+	// it is up to the consumer to skip the ones it already saw.
+	failures := []complainer.Failure{}
+	for _, task := range append(state.GetTasks.CompletedTasks, state.GetTasks.UnreachableTasks...) {
+		if failedState(task.State) {
+			failures = append(failures, s.failure(task))
+		}
+	}
+
+	return failures
+}
+
+func (s *subscription) handleTaskUpdated(update *operatorTaskUpdated) []complainer.Failure {
+	id := update.Status.TaskID.Value
+
+	task, ok := s.tasks[id]
+	if !ok {
+		// The task was launched before we could see it,
+		// all we know about it is what the update says.
+		task = operatorTask{
+			TaskID:      update.Status.TaskID,
+			FrameworkID: update.FrameworkID,
+			AgentID:     update.Status.AgentID,
+		}
+	}
+
+	task.State = update.State
+	task.Statuses = append(task.Statuses, update.Status)
+
+	if terminalState(task.State) {
+		delete(s.tasks, id)
+	} else {
+		s.tasks[id] = task
+	}
+
+	if !failedState(task.State) {
+		return nil
+	}
+
+	return []complainer.Failure{s.failure(task)}
+}
+
+func (s *subscription) addFramework(framework operatorFramework) {
+	s.frameworks[framework.FrameworkInfo.ID.Value] = framework.FrameworkInfo.Name
+}
+
+func (s *subscription) addAgent(agent operatorAgent) {
+	s.agents[agent.AgentInfo.ID.Value] = agent.masterSlave()
+}
+
+func (s *subscription) failure(task operatorTask) complainer.Failure {
+	return failureFromTask(task.masterTask(), s.frameworks[task.FrameworkID.Value], s.agents[task.AgentID.Value], s.scheme)
+}
+
+// terminalState returns whether the task can no longer change its state
+func terminalState(state string) bool {
+	switch state {
+	case "TASK_FINISHED", "TASK_FAILED", "TASK_KILLED", "TASK_ERROR", "TASK_LOST", "TASK_DROPPED", "TASK_GONE", "TASK_GONE_BY_OPERATOR":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,219 @@
+package mesos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const (
+	testSubscribedEvent = `{
+		"type": "SUBSCRIBED",
+		"subscribed": {
+			"heartbeat_interval_seconds": 15,
+			"get_state": {
+				"get_frameworks": {"frameworks": [{"framework_info": {"id": {"value": "fw-1"}, "name": "marathon"}}]},
+				"get_agents": {"agents": [{"agent_info": {"id": {"value": "agent-1"}, "hostname": "agent1.example.com", "port": 5051}, "pid": "slave(1)@10.0.1.1:5051"}]},
+				"get_tasks": {
+					"completed_tasks": [
+						{"name": "old", "task_id": {"value": "old.1"}, "framework_id": {"value": "fw-1"}, "agent_id": {"value": "agent-1"}, "state": "TASK_FAILED"},
+						{"name": "done", "task_id": {"value": "done.1"}, "framework_id": {"value": "fw-1"}, "agent_id": {"value": "agent-1"}, "state": "TASK_FINISHED"}
+					]
+				}
+			}
+		}
+	}`
+
+	testTaskAddedEvent = `{
+		"type": "TASK_ADDED",
+		"task_added": {
+			"task": {
+				"name": "app",
+				"task_id": {"value": "app.1"},
+				"framework_id": {"value": "fw-1"},
+				"agent_id": {"value": "agent-1"},
+				"state": "TASK_STAGING",
+				"labels": {"labels": [{"key": "complainer_sentry_dsn", "value": "foo"}]},
+				"container": {"type": "DOCKER", "docker": {"image": "busybox"}}
+			}
+		}
+	}`
+
+	testTaskRunningEvent = `{
+		"type": "TASK_UPDATED",
+		"task_updated": {
+			"framework_id": {"value": "fw-1"},
+			"state": "TASK_RUNNING",
+			"status": {"task_id": {"value": "app.1"}, "agent_id": {"value": "agent-1"}, "state": "TASK_RUNNING", "timestamp": 1480000000}
+		}
+	}`
+
+	testTaskFailedEvent = `{
+		"type": "TASK_UPDATED",
+		"task_updated": {
+			"framework_id": {"value": "fw-1"},
+			"state": "TASK_FAILED",
+			"status": {"task_id": {"value": "app.1"}, "agent_id": {"value": "agent-1"}, "state": "TASK_FAILED", "timestamp": 1480000060}
+		}
+	}`
+)
+
+func recordIO(events ...string) string {
+	buf := bytes.NewBuffer([]byte{})
+	for _, event := range events {
+		fmt.Fprintf(buf, "%d\n%s", len(event), event)
+	}
+
+	return buf.String()
+}
+
+func TestRecordReader(t *testing.T) {
+	reader := newRecordReader(strings.NewReader(recordIO("hello", "", "{\"a\":\n1}")))
+
+	for _, expected := range []string{"hello", "", "{\"a\":\n1}"} {
+		record, err := reader.ReadRecord()
+		if err != nil {
+			t.Fatalf("Error reading record: %s", err)
+		}
+
+		if string(record) != expected {
+			t.Errorf("Unexpected record %q, expected %q", record, expected)
+		}
+	}
+
+	if _, err := reader.ReadRecord(); err == nil {
+		t.Errorf("Expected an error reading past the end of the stream")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, recordIO(testSubscribedEvent, `{"type": "HEARTBEAT"}`, testTaskAddedEvent, testTaskRunningEvent, testTaskFailedEvent))
+	}))
+
+	defer leader.Close()
+
+	follower := newFollower(leader.URL)
+	defer follower.Close()
+
+	cluster := NewCluster([]string{follower.URL, leader.URL})
+
+	failures := make(chan complainer.Failure, 10)
+	subscribed := false
+
+	err := cluster.Subscribe(failures, func() {
+		subscribed = true
+	})
+
+	if err == nil {
+		t.Errorf("Expected an error after the stream is closed")
+	}
+
+	if !subscribed {
+		t.Errorf("Expected subscribed callback to be called")
+	}
+
+	close(failures)
+
+	received := []complainer.Failure{}
+	for failure := range failures {
+		received = append(received, failure)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 failures, got %d: %+v", len(received), received)
+	}
+
+	if received[0].ID != "old.1" {
+		t.Errorf("Expected failure from the state snapshot first, got %s", received[0].ID)
+	}
+
+	failure := received[1]
+	if failure.ID != "app.1" || failure.Name != "app" || failure.Framework != "marathon" || failure.Slave != "agent1.example.com" {
+		t.Errorf("Unexpected failure: %+v", failure)
+	}
+
+	if failure.AgentID != "agent-1" || failure.AgentURL != "http://10.0.1.1:5051" {
+		t.Errorf("Unexpected agent %s at %s", failure.AgentID, failure.AgentURL)
+	}
+
+	if failure.State != "TASK_FAILED" || failure.Image != "busybox" || failure.Labels["complainer_sentry_dsn"] != "foo" {
+		t.Errorf("Unexpected failure: %+v", failure)
+	}
+
+	if !failure.Started.Equal(time.Unix(1480000000, 0)) || !failure.Finished.Equal(time.Unix(1480000060, 0)) {
+		t.Errorf("Unexpected failure timings: %s - %s", failure.Started, failure.Finished)
+	}
+}
+
+func TestSubscribeNoLeader(t *testing.T) {
+	follower := newFollower("http://leader.invalid")
+	defer follower.Close()
+
+	cluster := NewCluster([]string{follower.URL})
+
+	err := cluster.Subscribe(make(chan complainer.Failure), func() {})
+	if err == nil {
+		t.Errorf("Expected an error subscribing without a reachable leader")
+	}
+}
+
+func TestOperatorAgentAndResources(t *testing.T) {
+	agent := operatorAgent{}
+	err := json.Unmarshal([]byte(`{
+		"agent_info": {
+			"id": {"value": "agent-1"},
+			"hostname": "agent1.example.com",
+			"attributes": [
+				{"name": "rack", "type": "TEXT", "text": {"value": "r1"}},
+				{"name": "level", "type": "SCALAR", "scalar": {"value": 3}},
+				{"name": "slots", "type": "RANGES", "ranges": {"range": [{"begin": 1, "end": 2}]}}
+			]
+		},
+		"pid": "slave(1)@10.0.1.1:5051"
+	}`), &agent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slave := agent.masterSlave()
+
+	expected := map[string]string{"rack": "r1", "level": "3", "slots": "[1-2]"}
+	if attributes := slave.attributes(); !reflect.DeepEqual(attributes, expected) {
+		t.Errorf("Unexpected attributes %v, expected %v", attributes, expected)
+	}
+
+	if slave.ip() != "10.0.1.1" {
+		t.Errorf("Unexpected agent ip %q", slave.ip())
+	}
+
+	resources := []operatorResource{}
+	err = json.Unmarshal([]byte(`[
+		{"name": "cpus", "type": "SCALAR", "scalar": {"value": 0.5}, "role": "*"},
+		{"name": "cpus", "type": "SCALAR", "scalar": {"value": 1}, "role": "web"},
+		{"name": "mem", "type": "SCALAR", "scalar": {"value": 256}},
+		{"name": "ports", "type": "RANGES", "ranges": {"range": [{"begin": 31000, "end": 31000}, {"begin": 31005, "end": 31006}]}}
+	]`), &resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := masterResourcesOf(resources)
+	if result != (masterResources{CPUs: 1.5, Mem: 256, Ports: "[31000-31000, 31005-31006]"}) {
+		t.Errorf("Unexpected resources: %+v", result)
+	}
+}
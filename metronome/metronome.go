@@ -0,0 +1,309 @@
+package metronome
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/matcher"
+	"github.com/cloudflare/complainer/mesos"
+)
+
+const (
+	// StateFailed is the state of failed job runs
+	StateFailed = "JOB_FAILED"
+	// timeout for requests to metronome
+	timeout = time.Second * 10
+)
+
+// Metronome uses timestamps like 2016-11-24T03:00:00.000+0000
+var timestampLayouts = []string{"2006-01-02T15:04:05.000-0700", time.RFC3339Nano}
+
+var flagConfig = struct {
+	url       *string
+	name      *string
+	framework *string
+	cluster   *string
+}{}
+
+// RegisterFlags registers command line flags for metronome source
+func RegisterFlags() {
+	flagConfig.url = flags.String("metronome.url", "METRONOME_URL", "", "metronome url to watch job runs (example: http://metronome.mesos:9000)")
+	flagConfig.name = flags.String("metronome.name", "METRONOME_NAME", "metronome", "name of the metronome source")
+	flagConfig.framework = flags.String("metronome.framework", "METRONOME_FRAMEWORK", "metronome", "mesos framework name of metronome, its tasks are reported as job runs")
+	flagConfig.cluster = flags.String("metronome.cluster", "METRONOME_CLUSTER", "", "mesos cluster to find logs of job runs in (default is the first one)")
+}
+
+// FlagEnabled reports whether metronome url is configured by command line flags
+func FlagEnabled() bool {
+	return *flagConfig.url != ""
+}
+
+// FlagSource returns the source configured by command line flags,
+// nil is returned if metronome url is not configured. Logs are looked
+// up in the cluster named by flags or in the first one.
+func FlagSource(clusters []*mesos.Cluster) (*Source, error) {
+	if *flagConfig.url == "" {
+		return nil, nil
+	}
+
+	var tasks Tasks
+	for _, cluster := range clusters {
+		if *flagConfig.cluster == "" || cluster.Name() == *flagConfig.cluster {
+			tasks = cluster
+			break
+		}
+	}
+
+	if tasks == nil && *flagConfig.cluster != "" {
+		return nil, fmt.Errorf("unknown cluster %s", *flagConfig.cluster)
+	}
+
+	if tasks == nil {
+		log.Printf("Reporting metronome job runs without logs, no mesos cluster is configured to find their tasks in")
+	}
+
+	return NewSource(*flagConfig.name, *flagConfig.url, *flagConfig.framework, tasks), nil
+}
+
+// Tasks finds tasks of job runs and their logs, it is implemented by mesos clusters
+type Tasks interface {
+	Task(id string) (complainer.Failure, error)
+	Logs(failure complainer.Failure) (stdoutURL, stderrURL string, err error)
+	Client() *http.Client
+}
+
+// Source reports failed runs of metronome jobs, every run is reported
+// once no matter how many times its task was restarted
+type Source struct {
+	name      string
+	url       string
+	framework string
+	tasks     Tasks
+	client    http.Client
+	highWater time.Time
+	owns      func(failure complainer.Failure) bool
+	mu        sync.Mutex
+}
+
+// NewSource creates metronome source, logs of job runs are found in tasks,
+// which can be nil to report runs without logs
+func NewSource(name, url, framework string, tasks Tasks) *Source {
+	return &Source{
+		name:      name,
+		url:       strings.TrimSuffix(url, "/"),
+		framework: framework,
+		tasks:     tasks,
+		client: http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Name returns the name of the source
+func (s *Source) Name() string {
+	return s.name
+}
+
+// Client returns http client that can download logs of job runs
+func (s *Source) Client() *http.Client {
+	if s.tasks == nil {
+		return http.DefaultClient
+	}
+
+	return s.tasks.Client()
+}
+
+// Matcher wraps the matcher to skip task failures of metronome
+// framework coming from mesos, since job runs are reported instead
+func (s *Source) Matcher(next matcher.FailureMatcher) matcher.FailureMatcher {
+	return &taskMatcher{framework: s.framework, next: next}
+}
+
+type taskMatcher struct {
+	framework string
+	next      matcher.FailureMatcher
+}
+
+func (m *taskMatcher) Match(failure complainer.Failure) bool {
+	if failure.Framework == m.framework && failure.Job.ID == "" {
+		return false
+	}
+
+	return m.next.Match(failure)
+}
+
+// UseOwner makes the source return failed runs that are not owned
+// regardless of their age, so that they are returned once their
+// shards move here
+func (s *Source) UseOwner(owns func(failure complainer.Failure) bool) {
+	s.mu.Lock()
+	s.owns = owns
+	s.mu.Unlock()
+}
+
+// Failures returns failed job runs that finished no earlier than
+// the ones seen before
+func (s *Source) Failures() ([]complainer.Failure, error) {
+	jobs, err := s.jobs()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get jobs from metronome: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.highWater
+	failures := []complainer.Failure{}
+
+	for _, job := range jobs {
+		for _, run := range job.History.FailedFinishedRuns {
+			failure := s.failure(job, run)
+
+			if run.FinishedAt.Before(since) && (s.owns == nil || s.owns(failure)) {
+				continue
+			}
+
+			if run.FinishedAt.After(s.highWater) {
+				s.highWater = run.FinishedAt.Time
+			}
+
+			failures = append(failures, failure)
+		}
+	}
+
+	return failures, nil
+}
+
+// Logs returns logs of the last task of the job run, empty urls are
+// returned when tasks are not configured
+func (s *Source) Logs(failure complainer.Failure) (string, string, error) {
+	if s.tasks == nil || failure.Job.Task == "" {
+		return "", "", nil
+	}
+
+	task, err := s.tasks.Task(failure.Job.Task)
+	if err != nil {
+		return "", "", err
+	}
+
+	return s.tasks.Logs(task)
+}
+
+func (s *Source) failure(job job, run jobRun) complainer.Failure {
+	task := ""
+	if len(run.Tasks) > 0 {
+		task = run.Tasks[len(run.Tasks)-1]
+	}
+
+	return complainer.Failure{
+		ID:        job.ID + ":" + run.ID,
+		Name:      job.ID,
+		Cluster:   s.name,
+		Framework: s.framework,
+		Image:     job.Run.Docker.Image,
+		State:     StateFailed,
+		Message:   fmt.Sprintf("Run %s of job %s failed after %d attempts", run.ID, job.ID, len(run.Tasks)),
+		Started:   run.CreatedAt.Time,
+		Finished:  run.FinishedAt.Time,
+		Labels:    job.Labels,
+		Job: complainer.Job{
+			ID:       job.ID,
+			Run:      run.ID,
+			Schedule: job.schedule(),
+			Attempt:  len(run.Tasks),
+			Task:     task,
+		},
+	}
+}
+
+type job struct {
+	ID        string            `json:"id"`
+	Labels    map[string]string `json:"labels"`
+	Schedules []jobSchedule     `json:"schedules"`
+	Run       struct {
+		Docker struct {
+			Image string `json:"image"`
+		} `json:"docker"`
+	} `json:"run"`
+	History struct {
+		FailedFinishedRuns []jobRun `json:"failedFinishedRuns"`
+	} `json:"history"`
+}
+
+type jobSchedule struct {
+	ID       string `json:"id"`
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+type jobRun struct {
+	ID         string    `json:"id"`
+	CreatedAt  timestamp `json:"createdAt"`
+	FinishedAt timestamp `json:"finishedAt"`
+	Tasks      []string  `json:"tasks"`
+}
+
+// schedule returns cron expressions of enabled schedules of the job
+func (j job) schedule() string {
+	schedules := []string{}
+	for _, schedule := range j.Schedules {
+		if schedule.Enabled != nil && !*schedule.Enabled {
+			continue
+		}
+
+		if schedule.Timezone != "" {
+			schedules = append(schedules, schedule.Cron+" "+schedule.Timezone)
+		} else {
+			schedules = append(schedules, schedule.Cron)
+		}
+	}
+
+	return strings.Join(schedules, ", ")
+}
+
+type timestamp struct {
+	time.Time
+}
+
+func (t *timestamp) UnmarshalJSON(b []byte) error {
+	value := ""
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	var err error
+	for _, layout := range timestampLayouts {
+		if t.Time, err = time.Parse(layout, value); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot parse timestamp %q", value)
+}
+
+func (s *Source) jobs() ([]job, error) {
+	resp, err := s.client.Get(s.url + "/v1/jobs?embed=history&embed=schedules")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	jobs := []job{}
+
+	return jobs, json.NewDecoder(resp.Body).Decode(&jobs)
+}
@@ -0,0 +1,194 @@
+package metronome
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/matcher"
+)
+
+const testJobs = `[
+	{
+		"id": "prod.nightly",
+		"labels": {"complainer_jira_project": "OPS"},
+		"run": {"docker": {"image": "backup:1"}},
+		"schedules": [
+			{"id": "nightly", "cron": "0 3 * * *", "timezone": "UTC", "enabled": true},
+			{"id": "disabled", "cron": "0 4 * * *", "enabled": false}
+		],
+		"history": {
+			"failedFinishedRuns": [
+				{"id": "20161124030000abcde", "createdAt": "2016-11-24T03:00:00.000+0000", "finishedAt": "2016-11-24T03:10:00.000+0000", "tasks": ["prod_nightly.1", "prod_nightly.2", "prod_nightly.3"]}
+			]
+		}
+	},
+	{
+		"id": "prod.adhoc",
+		"history": {
+			"failedFinishedRuns": [
+				{"id": "20161123120000fghij", "createdAt": "2016-11-23T12:00:00.000+0000", "finishedAt": "2016-11-23T12:01:00.000+0000"}
+			]
+		}
+	}
+]`
+
+type testTasks struct{}
+
+func (t testTasks) Task(id string) (complainer.Failure, error) {
+	if id != "prod_nightly.3" {
+		return complainer.Failure{}, errors.New("not found")
+	}
+
+	return complainer.Failure{ID: id, AgentURL: "http://agent1:5051"}, nil
+}
+
+func (t testTasks) Logs(failure complainer.Failure) (string, string, error) {
+	return failure.AgentURL + "/" + failure.ID + "/stdout", failure.AgentURL + "/" + failure.ID + "/stderr", nil
+}
+
+func (t testTasks) Client() *http.Client {
+	return http.DefaultClient
+}
+
+func TestFailures(t *testing.T) {
+	jobs := testJobs
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/jobs" || !reflect.DeepEqual(r.URL.Query()["embed"], []string{"history", "schedules"}) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, jobs)
+	}))
+
+	defer server.Close()
+
+	source := NewSource("jobs", server.URL, "metronome", testTasks{})
+
+	failures, err := source.Failures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []complainer.Failure{
+		{
+			ID:        "prod.nightly:20161124030000abcde",
+			Name:      "prod.nightly",
+			Cluster:   "jobs",
+			Framework: "metronome",
+			Image:     "backup:1",
+			State:     StateFailed,
+			Message:   "Run 20161124030000abcde of job prod.nightly failed after 3 attempts",
+			Started:   time.Date(2016, 11, 24, 3, 0, 0, 0, time.UTC),
+			Finished:  time.Date(2016, 11, 24, 3, 10, 0, 0, time.UTC),
+			Labels:    map[string]string{"complainer_jira_project": "OPS"},
+			Job: complainer.Job{
+				ID:       "prod.nightly",
+				Run:      "20161124030000abcde",
+				Schedule: "0 3 * * * UTC",
+				Attempt:  3,
+				Task:     "prod_nightly.3",
+			},
+		},
+		{
+			ID:        "prod.adhoc:20161123120000fghij",
+			Name:      "prod.adhoc",
+			Cluster:   "jobs",
+			Framework: "metronome",
+			State:     StateFailed,
+			Message:   "Run 20161123120000fghij of job prod.adhoc failed after 0 attempts",
+			Started:   time.Date(2016, 11, 23, 12, 0, 0, 0, time.UTC),
+			Finished:  time.Date(2016, 11, 23, 12, 1, 0, 0, time.UTC),
+			Job: complainer.Job{
+				ID:  "prod.adhoc",
+				Run: "20161123120000fghij",
+			},
+		},
+	}
+
+	for i := range failures {
+		// Times are compared separately because of locations
+		if !failures[i].Started.Equal(expected[i].Started) || !failures[i].Finished.Equal(expected[i].Finished) {
+			t.Errorf("unexpected times of %s: %s - %s", failures[i].ID, failures[i].Started, failures[i].Finished)
+		}
+
+		failures[i].Started, failures[i].Finished = expected[i].Started, expected[i].Finished
+	}
+
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected %#v, got %#v", expected, failures)
+	}
+
+	// Runs that finished before the ones seen are not returned again
+	failures, err = source.Failures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failures) != 1 || failures[0].Job.Run != "20161124030000abcde" {
+		t.Errorf("unexpected failures on second run: %v", failures)
+	}
+
+	stdout, stderr, err := source.Logs(failures[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != "http://agent1:5051/prod_nightly.3/stdout" || stderr != "http://agent1:5051/prod_nightly.3/stderr" {
+		t.Errorf("unexpected logs: %s, %s", stdout, stderr)
+	}
+
+	// Runs of other shards are returned until shards move here
+	source.UseOwner(func(failure complainer.Failure) bool {
+		return failure.Name == "prod.nightly"
+	})
+
+	failures, err = source.Failures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failures) != 2 || failures[1].Job.Run != "20161123120000fghij" {
+		t.Errorf("unexpected failures with other shards: %v", failures)
+	}
+
+	jobs = "not json"
+	if _, err := source.Failures(); err == nil {
+		t.Errorf("expected error for invalid response")
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	match := NewSource("jobs", "", "metronome", nil).Matcher(&matcher.NoopMatcher{})
+
+	table := []struct {
+		failure complainer.Failure
+		match   bool
+	}{
+		{
+			failure: complainer.Failure{Framework: "metronome"},
+			match:   false,
+		},
+		{
+			failure: complainer.Failure{Framework: "metronome", Job: complainer.Job{ID: "prod.nightly"}},
+			match:   true,
+		},
+		{
+			failure: complainer.Failure{Framework: "marathon"},
+			match:   true,
+		},
+	}
+
+	for _, tt := range table {
+		if match.Match(tt.failure) != tt.match {
+			t.Errorf("expected match %t for %+v", tt.match, tt.failure)
+		}
+	}
+}
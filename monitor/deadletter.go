@@ -0,0 +1,282 @@
+package monitor
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/store"
+)
+
+// DeadLettersPath is the path of the endpoint that manages notifications
+// that could not be delivered
+const DeadLettersPath = "/api/v1/dead-letters"
+
+// redacted replaces secrets in notifications served over http
+const redacted = "[redacted]"
+
+// deadLettersDepth is the number of notifications waiting to be replayed
+var deadLettersDepth = expvar.NewInt("deadletters.depth")
+
+// secretLabels are suffixes of labels with credentials of reporters
+var secretLabels = []string{"_dsn", "_hook_url", "_token", "_password", "_secret"}
+
+// UseDeadLetters makes the monitor keep notifications that could not be
+// delivered, callers with one of the tokens can manage them over http.
+// Without tokens notifications are only kept. It must be called before
+// running and serving http.
+func (m *Monitor) UseDeadLetters(letters store.DeadLetters, tokens []string) {
+	m.letters = letters
+	m.lettersTokens = tokens
+	deadLettersDepth.Set(int64(letters.Len()))
+}
+
+// deadLetter keeps the notification that could not be delivered and
+// reports whether it was kept, it only logs the error if dead letters
+// are not used
+func (m *Monitor) deadLetter(name, instance string, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string, err error) bool {
+	log.Printf("Cannot generate report with %s [instance=%s] for task with ID %s: %s", name, instance, failure.ID, err)
+
+	if m.letters == nil {
+		return false
+	}
+
+	payload := ""
+	if renderer, ok := m.reporters[name].(reporter.Renderer); ok {
+		rendered, renderErr := renderer.Render(failure, config, stdoutURL, stderrURL)
+		if renderErr != nil {
+			log.Printf("Error rendering payload of %s with %s [instance=%s]: %s", failure.ID, name, instance, renderErr)
+		}
+
+		payload = rendered
+	}
+
+	letter, addErr := m.letters.Add(store.DeadLetter{
+		Failure:   failure,
+		Reporter:  name,
+		Instance:  instance,
+		Payload:   payload,
+		StdoutURL: stdoutURL,
+		StderrURL: stderrURL,
+		Error:     err.Error(),
+	})
+
+	deadLettersDepth.Set(int64(m.letters.Len()))
+
+	if addErr != nil {
+		log.Printf("Error keeping undelivered report of %s with %s [instance=%s]: %s", failure.ID, name, instance, addErr)
+		return false
+	}
+
+	log.Printf("Kept undelivered report of %s with %s [instance=%s] as %s", failure.ID, name, instance, letter.ID)
+
+	return true
+}
+
+// replay reports the notification again, the notification is taken out
+// while it is replayed, so that concurrent replays do not send it twice,
+// and put back if it cannot be delivered. Reporters that rendered the
+// payload send it as it was rendered.
+func (m *Monitor) replay(id string) (bool, error) {
+	letter, ok, err := m.letters.Take(id)
+	deadLettersDepth.Set(int64(m.letters.Len()))
+
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	err = m.replayLetter(letter)
+	if err == nil {
+		log.Printf("Replayed report of %s with %s [instance=%s] from %s", letter.Failure.ID, letter.Reporter, letter.Instance, letter.ID)
+		return true, nil
+	}
+
+	letter.Error = err.Error()
+
+	if _, addErr := m.letters.Add(letter); addErr != nil {
+		log.Printf("Error putting back undelivered report of %s with %s [instance=%s] as %s: %s", letter.Failure.ID, letter.Reporter, letter.Instance, letter.ID, addErr)
+	}
+
+	deadLettersDepth.Set(int64(m.letters.Len()))
+
+	return true, err
+}
+
+func (m *Monitor) replayLetter(letter store.DeadLetter) error {
+	r, ok := m.reporters[letter.Reporter]
+	if !ok {
+		return fmt.Errorf("unknown reporter %s", letter.Reporter)
+	}
+
+	labels := label.NewLabels(m.name, letter.Failure.Labels, m.defaults)
+	config := reporter.NewConfigProvider(labels, letter.Reporter, letter.Instance)
+
+	if renderer, ok := r.(reporter.Renderer); ok && letter.Payload != "" {
+		return renderer.ReportRendered(letter.Failure, config, letter.StdoutURL, letter.StderrURL, letter.Payload)
+	}
+
+	return r.Report(letter.Failure, config, letter.StdoutURL, letter.StderrURL)
+}
+
+func (m *Monitor) discard(id string) error {
+	err := m.letters.Remove(id)
+	deadLettersDepth.Set(int64(m.letters.Len()))
+
+	return err
+}
+
+// handleDeadLetters serves the list of notifications on DeadLettersPath,
+// single notifications on DeadLettersPath/<id> and their replays
+// on DeadLettersPath/<id>/replay
+func (m *Monitor) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, m.lettersTokens) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, DeadLettersPath), "/")
+
+	if path == "" {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		letters, err := m.letters.List()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot list dead letters: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		for i, letter := range letters {
+			letters[i] = redact(letter)
+		}
+
+		writeJSON(w, letters)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "replay") {
+		http.NotFound(w, r)
+		return
+	}
+
+	letter, ok, err := m.letters.Get(parts[0])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot get dead letter: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		ok, err := m.replay(letter.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot replay %s: %s", letter.ID, err), http.StatusBadGateway)
+			return
+		}
+
+		// Concurrent replays or deletes can take the letter first
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintln(w, "replayed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, redact(letter))
+	case http.MethodDelete:
+		if err := m.discard(letter.ID); err != nil {
+			http.Error(w, fmt.Sprintf("cannot discard %s: %s", letter.ID, err), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintln(w, "discarded")
+	default:
+		allowMethod(w, r, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// redact hides values of labels with credentials, they are also hidden
+// in the payload and the error where reporters could have included them
+func redact(letter store.DeadLetter) store.DeadLetter {
+	secrets := []string{}
+
+	letter.Failure.Labels = redactLabels(letter.Failure.Labels, &secrets)
+	letter.Failure.App.Labels = redactLabels(letter.Failure.App.Labels, &secrets)
+
+	for _, secret := range secrets {
+		letter.Payload = strings.Replace(letter.Payload, secret, redacted, -1)
+		letter.Error = strings.Replace(letter.Error, secret, redacted, -1)
+	}
+
+	return letter
+}
+
+// redactLabels returns the copy of labels with credentials hidden,
+// hidden values are added to secrets
+func redactLabels(labels map[string]string, secrets *[]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	copied := make(map[string]string, len(labels))
+
+	for k, v := range labels {
+		copied[k] = v
+
+		if v == "" || !strings.HasPrefix(k, "complainer_") {
+			continue
+		}
+
+		for _, suffix := range secretLabels {
+			if strings.HasSuffix(k, suffix) {
+				copied[k] = redacted
+				*secrets = append(*secrets, v)
+				break
+			}
+		}
+	}
+
+	return copied
+}
+
+// allowMethod responds with 405 Method Not Allowed to requests
+// with methods other than the allowed ones
+func allowMethod(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	for _, method := range allowed {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %s", err)
+	}
+}
@@ -0,0 +1,196 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/store"
+)
+
+// downReporter fails until it is brought up
+type downReporter struct {
+	up       bool
+	reported []string
+	payloads []string
+}
+
+func (r *downReporter) Report(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	if !r.up {
+		return errors.New("reporter is down")
+	}
+
+	r.reported = append(r.reported, failure.ID)
+
+	return nil
+}
+
+func (r *downReporter) Render(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) (string, error) {
+	return "payload of " + failure.ID + " to " + config("hook_url"), nil
+}
+
+func (r *downReporter) ReportRendered(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL, payload string) error {
+	if err := r.Report(failure, config, stdoutURL, stderrURL); err != nil {
+		return err
+	}
+
+	r.payloads = append(r.payloads, payload)
+
+	return nil
+}
+
+func TestDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	letters, err := store.NewFileDeadLetters(filepath.Join(dir, "dead-letters.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep := &downReporter{}
+
+	m := NewMonitor("test", "1.0", nil, nil, map[string]reporter.Reporter{"down": rep}, true, nil, nil, nil)
+	m.UseDeadLetters(letters, []string{"secret"})
+
+	source := &monitoredSource{source: &testSource{}}
+	labels := map[string]string{"complainer_test_down_hook_url": "https://hooks.example.com/private", "complainer_test_down_channel": "#alerts"}
+	for _, id := range []string{"one", "two"} {
+		if err := m.processFailure(source, complainer.Failure{ID: id, Labels: labels}, func() {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if depth := deadLettersDepth.Value(); depth != 2 {
+		t.Errorf("expected depth of 2, got %d", depth)
+	}
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	request := func(method, path string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+DeadLettersPath+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	resp := request(http.MethodGet, "")
+	list := []store.DeadLetter{}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("expected 2 dead letters, got %+v", list)
+	}
+
+	first := list[0]
+	if first.Reporter != "down" || first.Instance != "default" || first.Payload != "payload of "+first.Failure.ID+" to "+redacted || first.Error != "reporter is down" {
+		t.Errorf("unexpected dead letter: %+v", first)
+	}
+
+	// Credentials are not shown, other labels are
+	if first.Failure.Labels["complainer_test_down_hook_url"] != redacted || first.Failure.Labels["complainer_test_down_channel"] != "#alerts" {
+		t.Errorf("unexpected labels of dead letter: %v", first.Failure.Labels)
+	}
+
+	// Requests without a known token are rejected
+	for _, header := range []string{"", "Bearer wrong"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+DeadLettersPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status %d with authorization %q, got %d", http.StatusUnauthorized, header, resp.StatusCode)
+		}
+	}
+
+	table := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/" + first.ID, status: http.StatusOK},
+		{method: http.MethodGet, path: "/missing", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/" + first.ID + "/replay", status: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/" + first.ID + "/replay", status: http.StatusBadGateway},
+		{method: http.MethodDelete, path: "/" + list[1].ID, status: http.StatusOK},
+	}
+
+	for _, tt := range table {
+		resp := request(tt.method, tt.path)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("expected status %d for %s %s, got %d", tt.status, tt.method, tt.path, resp.StatusCode)
+		}
+	}
+
+	// Replayed letters are forgotten once delivered
+	rep.up = true
+
+	resp = request(http.MethodPost, "/"+first.ID+"/replay")
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected replay to succeed, got %d", resp.StatusCode)
+	}
+
+	if len(rep.reported) != 1 || rep.reported[0] != first.Failure.ID {
+		t.Errorf("expected %s to be reported, got %v", first.Failure.ID, rep.reported)
+	}
+
+	// The payload is sent as it was rendered when the report failed
+	payload := "payload of " + first.Failure.ID + " to https://hooks.example.com/private"
+	if len(rep.payloads) != 1 || rep.payloads[0] != payload {
+		t.Errorf("expected %q to be sent, got %v", payload, rep.payloads)
+	}
+
+	resp = request(http.MethodPost, "/"+first.ID+"/replay")
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected replayed letter to be gone, got %d", resp.StatusCode)
+	}
+
+	if letters.Len() != 0 || deadLettersDepth.Value() != 0 {
+		t.Errorf("expected no dead letters left, got %d", letters.Len())
+	}
+}
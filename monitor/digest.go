@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/limit"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// UseLimiter makes the monitor rate limit notifications, failures over
+// limits are sent in digests by RunDigests. It must be called before running.
+func (m *Monitor) UseLimiter(limiter *limit.Limiter) {
+	m.limiter = limiter
+}
+
+// RunDigests sends digests of failures over rate limits once their
+// windows pass, it never returns
+func (m *Monitor) RunDigests() {
+	for range time.Tick(time.Second) {
+		m.reportDigests(m.limiter.Digests())
+	}
+}
+
+// reportDigests sends digests to reporters that support them,
+// other reporters only get failures that are within limits
+func (m *Monitor) reportDigests(digests []limit.Digest) {
+	for _, digest := range digests {
+		digester, ok := m.reporters[digest.Reporter].(reporter.Digester)
+		if !ok {
+			log.Printf("Skipping digest with %s [instance=%s]: %s", digest.Reporter, digest.Instance, digest)
+			continue
+		}
+
+		labels := label.NewLabels(m.name, digest.Failure.Labels, m.defaults)
+		config := reporter.NewConfigProvider(labels, digest.Reporter, digest.Instance)
+
+		err := m.call(fmt.Sprintf("sending digest of %s with %s [instance=%s]", digest.App, digest.Reporter, digest.Instance), func() error {
+			return digester.Digest(digest.Digest, config)
+		})
+
+		if err != nil {
+			log.Printf("Cannot send digest with %s [instance=%s]: %s: %s", digest.Reporter, digest.Instance, digest, err)
+			continue
+		}
+
+		log.Printf("Sent digest with %s [instance=%s]: %s", digest.Reporter, digest.Instance, digest)
+	}
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/limit"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// digestReporter records reported failures and digests
+type digestReporter struct {
+	testReporter
+	digests []string
+}
+
+func (r *digestReporter) Digest(digest complainer.Digest, config reporter.ConfigProvider) error {
+	r.digests = append(r.digests, digest.String())
+	return nil
+}
+
+func TestLimited(t *testing.T) {
+	rep := &digestReporter{}
+	plain := &testReporter{}
+
+	m := NewMonitor("test", "1.0", nil, nil, map[string]reporter.Reporter{"digest": rep, "plain": plain}, true, nil, nil, nil)
+
+	limiter := limit.NewLimiter(limit.Rate{Count: 1, Period: time.Hour}, limit.Rate{}, limit.Rate{}, time.Millisecond*10)
+	m.UseLimiter(limiter)
+
+	source := &monitoredSource{source: &testSource{}}
+	for i, agent := range []string{"agent1", "agent2", "agent2"} {
+		failure := complainer.Failure{ID: string(rune('a' + i)), Name: "web", Slave: agent}
+		if err := m.processFailure(source, failure, func() {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ids := reportedIDs(&rep.testReporter); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("unexpected reported failures: %v", ids)
+	}
+
+	if ids := reportedIDs(plain); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("unexpected reported failures without digests: %v", ids)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+
+	// Reporters without digests are skipped
+	m.reportDigests(limiter.Digests())
+
+	expected := []string{"web failed 2 more times on 1 agent in the last 10ms"}
+	if !reflect.DeepEqual(rep.digests, expected) {
+		t.Errorf("expected digests %v, got %v", expected, rep.digests)
+	}
+}
+
+// appEnricher adds the app to failures
+type appEnricher struct {
+	app string
+}
+
+func (e appEnricher) Enrich(failure complainer.Failure) (complainer.Failure, error) {
+	failure.App.ID = e.app
+	return failure, nil
+}
+
+func TestLimitedEnriched(t *testing.T) {
+	rep := &testReporter{}
+
+	m := NewMonitor("test", "1.0", nil, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, appEnricher{app: "/web"})
+	m.UseLimiter(limit.NewLimiter(limit.Rate{Count: 1, Period: time.Hour}, limit.Rate{}, limit.Rate{}, time.Hour))
+
+	// Tasks of the same app share limits
+	source := &monitoredSource{source: &testSource{}}
+	for i, name := range []string{"web-1", "web-2"} {
+		failure := complainer.Failure{ID: string(rune('a' + i)), Name: name}
+		if err := m.processFailure(source, failure, func() {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ids := reportedIDs(rep); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("unexpected reported failures: %v", ids)
+	}
+}
@@ -1,18 +1,22 @@
 package monitor
 
 import (
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/pprof"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/limit"
 	"github.com/cloudflare/complainer/matcher"
 	"github.com/cloudflare/complainer/mesos"
 	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/store"
 	"github.com/cloudflare/complainer/uploader"
 )
 
@@ -23,40 +27,177 @@ const (
 	timeout = time.Minute
 )
 
+// Enricher adds details to failures before they are reported
+type Enricher interface {
+	Enrich(failure complainer.Failure) (complainer.Failure, error)
+}
+
+// Elector decides whether this replica is the leader, only the leader
+// reports failures
+type Elector interface {
+	ID() string
+	Leader() bool
+}
+
+// Sharder splits failures between instances, each instance
+// only reports failures it owns
+type Sharder interface {
+	Owns(failure complainer.Failure) bool
+	Status() string
+}
+
 // Monitor is responsible for routing failed tasks to the configured reporters
 type Monitor struct {
-	name      string
-	version   string
-	mesos     *mesos.Cluster
-	uploader  uploader.Uploader
-	matcher   matcher.FailureMatcher
-	reporters map[string]reporter.Reporter
-	defaults  bool
-	recent    map[string]time.Time
-	mu        sync.Mutex
-	err       error
-}
-
-// NewMonitor creates the new monitor with a name, uploader and reporters
-func NewMonitor(name, version string, cluster *mesos.Cluster, up uploader.Uploader, reporters map[string]reporter.Reporter, defaults bool, match matcher.FailureMatcher) *Monitor {
+	name          string
+	version       string
+	sources       map[string]*monitoredSource
+	names         []string
+	detectors     []string
+	uploader      uploader.Uploader
+	matcher       matcher.FailureMatcher
+	reporters     map[string]reporter.Reporter
+	defaults      bool
+	states        mesos.States
+	enricher      Enricher
+	push          *monitoredSource
+	store         store.Store
+	windows       store.Windows
+	elector       Elector
+	sharder       Sharder
+	pipeline      *pipeline
+	letters       store.DeadLetters
+	lettersTokens []string
+	limiter       *limit.Limiter
+	recovery      *recovery
+	standby       bool
+	mu            sync.Mutex
+	process       sync.Mutex
+	pushMu        sync.Mutex
+}
+
+// monitoredSource holds the state of a single source,
+// recent is only accessed by the goroutine running the source
+type monitoredSource struct {
+	source   Source
+	detector bool
+	recent   map[string]time.Time
+	standby  bool
+	err      error
+}
+
+// NewMonitor creates the new monitor with a name, sources, uploader and reporters,
+// sources are identified by their names, enricher is optional
+func NewMonitor(name, version string, sources []Source, up uploader.Uploader, reporters map[string]reporter.Reporter, defaults bool, match matcher.FailureMatcher, states mesos.States, enricher Enricher) *Monitor {
 	if match == nil {
 		match = &matcher.NoopMatcher{}
 	}
 
-	return &Monitor{
+	if states == nil {
+		states, _ = mesos.ParseStates(mesos.DefaultStates)
+	}
+
+	m := &Monitor{
 		name:      name,
 		version:   version,
-		mesos:     cluster,
+		sources:   map[string]*monitoredSource{},
 		uploader:  up,
 		matcher:   match,
 		reporters: reporters,
 		defaults:  defaults,
+		states:    states,
+		enricher:  enricher,
+	}
+
+	for _, source := range sources {
+		m.sources[source.Name()] = &monitoredSource{source: source}
+		m.names = append(m.names, source.Name())
+	}
+
+	return m
+}
+
+// Sources returns names of monitored sources
+func (m *Monitor) Sources() []string {
+	return m.names
+}
+
+// CanStream reports whether the named source can be streamed
+func (m *Monitor) CanStream(name string) bool {
+	source, ok := m.sources[name]
+	if !ok {
+		return false
+	}
+
+	_, ok = source.source.(StreamSource)
+
+	return ok
+}
+
+// AddDetector adds the named detector, it must be called before running
+// the monitor. Detectors are run like sources, but cannot be streamed.
+func (m *Monitor) AddDetector(name string, detector Detector) error {
+	if _, ok := m.sources[name]; ok {
+		return fmt.Errorf("name %s is already taken", name)
+	}
+
+	m.sources[name] = &monitoredSource{source: detectorSource{Detector: detector, name: name}, detector: true}
+	m.detectors = append(m.detectors, name)
+
+	m.useOwner(m.sources[name].source)
+
+	return nil
+}
+
+// Detectors returns names of added detectors
+func (m *Monitor) Detectors() []string {
+	return m.detectors
+}
+
+// UseStore makes the monitor remember reported failures in the store,
+// failures that were missed while not running are reported if they are
+// within windows. It must be called before running.
+func (m *Monitor) UseStore(store store.Store, windows store.Windows) {
+	m.store = store
+	m.windows = windows
+}
+
+// UseElector makes the monitor report failures only while the elector
+// says this replica is the leader. It must be called before running.
+func (m *Monitor) UseElector(elector Elector) {
+	m.elector = elector
+}
+
+// UseSharder makes the monitor report only failures owned by this
+// instance, pushed failures are always reported by the instance that
+// received them. It must be called before running.
+func (m *Monitor) UseSharder(sharder Sharder) {
+	m.sharder = sharder
+
+	for _, source := range m.sources {
+		m.useOwner(source.source)
 	}
 }
 
+// useOwner tells the source which failures are owned by this instance
+func (m *Monitor) useOwner(source Source) {
+	if sharded, ok := source.(ShardedSource); ok && m.sharder != nil {
+		sharded.UseOwner(m.sharder.Owns)
+	}
+}
+
+// leading reports whether this replica should report failures
+func (m *Monitor) leading() bool {
+	return m.elector == nil || m.elector.Leader()
+}
+
 // ListenAndServe launches an http server on the requested address.
-// The server is responsible for health checks
+// The server is responsible for health checks and pushed failures
 func (m *Monitor) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, m.Handler())
+}
+
+// Handler returns http handler that serves health checks and pushed failures
+func (m *Monitor) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// health check
@@ -65,6 +206,20 @@ func (m *Monitor) ListenAndServe(addr string) error {
 	// version
 	mux.HandleFunc("/version", m.handleVersion)
 
+	// metrics
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// pushed failures
+	if m.push != nil {
+		mux.HandleFunc(PushPath, m.handlePush)
+	}
+
+	// undelivered notifications
+	if m.letters != nil && len(m.lettersTokens) > 0 {
+		mux.HandleFunc(DeadLettersPath, m.handleDeadLetters)
+		mux.HandleFunc(DeadLettersPath+"/", m.handleDeadLetters)
+	}
+
 	// pprof
 	mux.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
 	mux.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
@@ -72,7 +227,7 @@ func (m *Monitor) ListenAndServe(addr string) error {
 	mux.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
 	mux.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 
-	return http.ListenAndServe(addr, mux)
+	return mux
 }
 
 func (m *Monitor) handleVersion(w http.ResponseWriter, r *http.Request) {
@@ -81,12 +236,44 @@ func (m *Monitor) handleVersion(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Monitor) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	var err error
+	status := ""
+
 	m.mu.Lock()
-	err := m.err
+	for _, name := range append(m.names, m.detectors...) {
+		source := m.sources[name]
+
+		kind := "source"
+		if source.detector {
+			kind = "detector"
+		}
+
+		if source.err != nil {
+			if err == nil {
+				err = fmt.Errorf("%s %s: %s", kind, name, source.err)
+			}
+
+			status += fmt.Sprintf("%s %s: %s\n", kind, name, source.err)
+		} else {
+			status += fmt.Sprintf("%s %s: ok\n", kind, name)
+		}
+	}
 	m.mu.Unlock()
 
+	if m.elector != nil {
+		if m.elector.Leader() {
+			status += fmt.Sprintf("election %s: leader\n", m.elector.ID())
+		} else {
+			status += fmt.Sprintf("election %s: standby\n", m.elector.ID())
+		}
+	}
+
+	if m.sharder != nil {
+		status += fmt.Sprintf("shard %s\n", m.sharder.Status())
+	}
+
 	if err == nil {
-		if _, err = w.Write([]byte("I am mostly okay, thanks.\n")); err != nil {
+		if _, err = w.Write([]byte("I am mostly okay, thanks.\n" + status)); err != nil {
 			log.Printf("Error responding that we're okay: %s", err)
 		}
 
@@ -94,18 +281,35 @@ func (m *Monitor) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusInternalServerError)
-	if _, err = w.Write([]byte(fmt.Sprintf("Something is fishy: %s\n", err))); err != nil {
+	if _, err = w.Write([]byte(fmt.Sprintf("Something is fishy: %s\n%s", err, status))); err != nil {
 		log.Printf("Error responding that we're not okay: %s", err)
 	}
 }
 
-// Run does one run across failed tasks and reports any new failures
-func (m *Monitor) Run() error {
-	failures, err := m.mesos.Failures()
+// Run does one run across failures of the source and reports any new ones.
+// Sources can be run concurrently, but each source must be run by one goroutine.
+func (m *Monitor) Run(name string) error {
+	source, ok := m.sources[name]
+	if !ok {
+		return fmt.Errorf("unknown source %s", name)
+	}
+
+	// Standby replicas start over when they become the leader
+	if !m.leading() {
+		source.recent = nil
+		source.standby = true
+		m.setStandby()
+		m.setErr(source, nil)
+		return nil
+	}
+
+	m.takeOver()
+
+	started := time.Now()
+
+	failures, err := source.source.Failures()
 	defer func() {
-		m.mu.Lock()
-		m.err = err
-		m.mu.Unlock()
+		m.setErr(source, err)
 	}()
 
 	if err != nil {
@@ -113,44 +317,166 @@ func (m *Monitor) Run() error {
 	}
 
 	first := false
-	if m.recent == nil {
-		m.recent = map[string]time.Time{}
-		first = true
+	if source.recent == nil {
+		source.recent = map[string]time.Time{}
+		// Detectors only return what they have not returned before,
+		// replicas that take over report failures of the handover
+		first = !source.detector && !source.standby
+		source.standby = false
 	}
 
 	for _, failure := range failures {
-		if m.checkFailure(failure, first) {
-			if err := m.processFailure(failure); err != nil {
+		if m.checkFailure(source, failure, first) {
+			if err := m.processFailure(source, failure, func() {}); err != nil {
 				log.Printf("Error reporting failure of %s: %s", failure.ID, err)
 			}
 		}
 	}
 
-	m.cleanupRecent()
+	source.cleanupRecent()
+
+	m.setProcessed(source, started)
 
 	return nil
 }
 
-func (m *Monitor) cleanupRecent() {
-	for n, ts := range m.recent {
+// Stream subscribes to the source and reports failures as they happen.
+// It returns when the subscription is interrupted.
+func (m *Monitor) Stream(name string) error {
+	source, ok := m.sources[name]
+	if !ok {
+		return fmt.Errorf("unknown source %s", name)
+	}
+
+	streamer, ok := source.source.(StreamSource)
+	if !ok {
+		return fmt.Errorf("source %s cannot be streamed", name)
+	}
+
+	if !m.leading() {
+		m.setStandby()
+		m.setErr(source, nil)
+		return nil
+	}
+
+	m.takeOver()
+
+	if source.recent == nil {
+		source.recent = map[string]time.Time{}
+	}
+
+	failures := make(chan complainer.Failure)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- streamer.Subscribe(failures, func() {
+			m.setErr(source, nil)
+			m.setProcessed(source, time.Now())
+		})
+
+		close(failures)
+	}()
+
+	for failure := range failures {
+		// Leadership can be lost while the subscription is open
+		if !m.leading() {
+			continue
+		}
+
+		if m.checkFailure(source, failure, false) {
+			if err := m.processFailure(source, failure, func() {}); err != nil {
+				log.Printf("Error reporting failure of %s: %s", failure.ID, err)
+			}
+		}
+
+		source.cleanupRecent()
+
+		m.setProcessed(source, time.Now())
+	}
+
+	err := <-done
+	m.setErr(source, err)
+
+	return err
+}
+
+// setStandby records that this replica is not the leader
+func (m *Monitor) setStandby() {
+	m.mu.Lock()
+	m.standby = true
+	m.mu.Unlock()
+}
+
+// takeOver reloads the shared store once the replica becomes the leader,
+// so that it continues from failures and processed times of the previous
+// leader instead of catching up on everything
+func (m *Monitor) takeOver() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.standby {
+		return
+	}
+
+	m.standby = false
+
+	reloader, ok := m.store.(store.Reloader)
+	if !ok {
+		return
+	}
+
+	if err := reloader.Reload(); err != nil {
+		log.Printf("Error reloading store after becoming the leader: %s", err)
+	}
+}
+
+func (m *Monitor) setErr(source *monitoredSource, err error) {
+	m.mu.Lock()
+	source.err = err
+	m.mu.Unlock()
+}
+
+func (s *monitoredSource) cleanupRecent() {
+	for n, ts := range s.recent {
 		if time.Since(ts) > timeout {
-			delete(m.recent, n)
+			delete(s.recent, n)
 		}
 	}
 }
 
-func (m *Monitor) checkFailure(failure complainer.Failure, first bool) bool {
-	if !m.matcher.Match(failure.Framework) {
+func (m *Monitor) checkFailure(source *monitoredSource, failure complainer.Failure, first bool) bool {
+	if !m.matcher.Match(failure) {
 		return false
 	}
 
-	if !m.recent[failure.ID].IsZero() {
+	// Task states only make sense for Mesos, other sources decide on their own
+	if _, ok := source.source.(MesosSource); ok && !m.failureStates(failure).Contains(failure.State) {
 		return false
 	}
 
-	m.recent[failure.ID] = failure.Finished
+	// Failures of other shards are not remembered, so that they are
+	// picked up once their shards move here
+	if m.sharder != nil && source != m.push && !m.sharder.Owns(failure) {
+		return false
+	}
 
-	if time.Since(failure.Finished) > timeout/2 {
+	if !source.recent[failure.ID].IsZero() {
+		return false
+	}
+
+	// Pushed failures can finish long before they are pushed, they are
+	// remembered since the push and checked for age by the handler
+	if source == m.push {
+		source.recent[failure.ID] = time.Now()
+	} else {
+		source.recent[failure.ID] = failure.Finished
+	}
+
+	if m.store != nil {
+		return m.checkStored(source, failure)
+	}
+
+	if source != m.push && time.Since(failure.Finished) > timeout/2 {
 		return false
 	}
 
@@ -161,41 +487,262 @@ func (m *Monitor) checkFailure(failure complainer.Failure, first bool) bool {
 	return true
 }
 
-func (m *Monitor) processFailure(failure complainer.Failure) error {
-	labels := label.NewLabels(m.name, failure.Labels, m.defaults)
-
-	skip := true
-	for n := range m.reporters {
-		for range labels.Instances(n) {
-			skip = false
+// checkStored reports whether the failure is new to the store and recent
+// enough to be reported, failures are added to the store once delivered.
+// Failures that finished more than the grace window before the source was
+// last processed were already seen, failures older than the catch up
+// window are not reported either. Failures of other shards are not seen
+// when sources are processed, so sharded monitors catch up on the whole
+// window once shards move here.
+func (m *Monitor) checkStored(source *monitoredSource, failure complainer.Failure) bool {
+	name := source.source.Name()
+
+	cutoff := time.Now().Add(-m.windows.CatchUp)
+
+	if m.sharder == nil || source == m.push {
+		processed, err := m.store.LastProcessed(name)
+		if err != nil {
+			log.Printf("Error getting last processed time of %s from store: %s", name, err)
+		} else if processed.Add(-m.windows.Grace).After(cutoff) {
+			cutoff = processed.Add(-m.windows.Grace)
 		}
 	}
 
-	if skip {
+	if failure.Finished.Before(cutoff) {
+		return false
+	}
+
+	seen, err := m.store.Seen(name, failure.ID)
+	if err != nil {
+		// Reporting twice is better than not reporting at all
+		log.Printf("Error checking %s in store: %s", failure.ID, err)
+	}
+
+	return !seen
+}
+
+// setProcessed records in the store when the source was processed
+func (m *Monitor) setProcessed(source *monitoredSource, processed time.Time) {
+	if m.store == nil {
+		return
+	}
+
+	if err := m.store.SetLastProcessed(source.source.Name(), processed); err != nil {
+		log.Printf("Error saving last processed time of %s to store: %s", source.source.Name(), err)
+	}
+}
+
+// logs returns stdout and stderr urls of the task, log locator
+// of Mesos sources can be overridden with the logs label
+func (m *Monitor) logs(source Source, failure complainer.Failure, labels label.Labels) (string, string, error) {
+	spec := labels.Label("logs")
+
+	mesosSource, ok := source.(MesosSource)
+	if !ok || spec == "" {
+		return source.Logs(failure)
+	}
+
+	locator, err := mesos.ParseLogLocator(spec)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot parse logs label: %s", err)
+	}
+
+	return mesosSource.LocateLogs(failure, locator)
+}
+
+// failureStates returns states considered failures for the task,
+// they can be overridden with the states label
+func (m *Monitor) failureStates(failure complainer.Failure) mesos.States {
+	list := label.NewLabels(m.name, failure.Labels, m.defaults).Label("states")
+	if list == "" {
+		return m.states
+	}
+
+	states, err := mesos.ParseStates(list)
+	if err != nil {
+		log.Printf("Error parsing states label of %s: %s", failure.ID, err)
+		return m.states
+	}
+
+	return states
+}
+
+// processFailure uploads logs and reports the failure, done is called
+// once logs of the failure are no longer needed. Failures are reported
+// without logs if they cannot be uploaded. With the pipeline the failure
+// is only queued and errors of reporters are logged later.
+func (m *Monitor) processFailure(source *monitoredSource, failure complainer.Failure, done func()) error {
+	// Limits of apps need failures with their apps
+	failure = m.enrich(failure)
+
+	labels := label.NewLabels(m.name, failure.Labels, m.defaults)
+
+	targets := m.targets(failure, labels)
+	if len(targets) == 0 {
+		done()
+		m.remember(source, failure)
 		log.Printf("Skipping %s", failure)
 		return nil
 	}
 
 	log.Printf("Reporting %s", failure)
 
-	stdoutURL, stderrURL, err := m.mesos.Logs(failure)
-	if err != nil {
-		return fmt.Errorf("cannot get stdout and stderr urls from mesos: %s", err)
+	delivery := m.newDelivery(source, failure, len(targets))
+
+	if m.pipeline != nil {
+		m.pipeline.enqueueUpload(m, uploadJob{source: source, failure: failure, labels: labels, targets: targets, done: done, delivery: delivery})
+		return nil
 	}
 
-	stdoutURL, stderrURL, err = m.uploader.Upload(failure, stdoutURL, stderrURL)
+	m.process.Lock()
+	defer m.process.Unlock()
+
+	stdoutURL, stderrURL, err := m.upload(source, failure, labels)
+	done()
+
 	if err != nil {
-		return fmt.Errorf("cannot get stdout and stderr urls from uploader: %s", err)
+		log.Printf("Error uploading logs of %s, reporting without them: %s", failure.ID, err)
 	}
 
-	for n, r := range m.reporters {
-		for _, i := range labels.Instances(n) {
-			config := reporter.NewConfigProvider(labels, n, i)
-			if err := r.Report(failure, config, stdoutURL, stderrURL); err != nil {
-				log.Printf("Cannot generate report with %s [instance=%s] for task with ID %s: %s", n, i, failure.ID, err)
-			}
+	for _, t := range targets {
+		config := reporter.NewConfigProvider(labels, t.reporter, t.instance)
+		if err := m.reporters[t.reporter].Report(failure, config, stdoutURL, stderrURL); err != nil {
+			delivery.done(m.deadLetter(t.reporter, t.instance, failure, config, stdoutURL, stderrURL, err))
+			continue
 		}
+
+		delivery.delivered(t)
 	}
 
 	return nil
 }
+
+// delivery counts reporter instances that still have to get the failure,
+// the failure is added to the store once every instance delivered it or
+// kept it as undelivered, so that restarts do not lose queued failures
+type delivery struct {
+	monitor   *Monitor
+	source    *monitoredSource
+	failure   complainer.Failure
+	remaining int32
+	lost      int32
+}
+
+func (m *Monitor) newDelivery(source *monitoredSource, failure complainer.Failure, targets int) *delivery {
+	return &delivery{monitor: m, source: source, failure: failure, remaining: int32(targets)}
+}
+
+// done records whether the notification for one instance was delivered
+// or kept, failures with lost notifications are reported again after restart
+func (d *delivery) done(kept bool) {
+	if !kept {
+		atomic.StoreInt32(&d.lost, 1)
+	}
+
+	if atomic.AddInt32(&d.remaining, -1) > 0 || atomic.LoadInt32(&d.lost) != 0 {
+		return
+	}
+
+	d.monitor.remember(d.source, d.failure)
+}
+
+// delivered records that the instance got the notification, only such
+// instances are told when the app recovers
+func (d *delivery) delivered(t target) {
+	d.monitor.track(d.source, d.failure, t)
+	d.done(true)
+}
+
+// remember adds the failure to the store, so that it is not reported again
+func (m *Monitor) remember(source *monitoredSource, failure complainer.Failure) {
+	if m.store == nil {
+		return
+	}
+
+	if err := m.store.Add(source.source.Name(), failure.ID, failure.Finished); err != nil {
+		log.Printf("Error adding %s to store: %s", failure.ID, err)
+	}
+}
+
+// target is the reporter instance to report the failure with
+type target struct {
+	reporter string
+	instance string
+}
+
+// targets returns reporter instances configured for the failure,
+// instances that are over rate limits are left out
+func (m *Monitor) targets(failure complainer.Failure, labels label.Labels) []target {
+	configured := []limit.Target{}
+
+	for n := range m.reporters {
+		for _, i := range labels.Instances(n) {
+			configured = append(configured, limit.Target{Reporter: n, Instance: i})
+		}
+	}
+
+	allowed := configured
+	if m.limiter != nil {
+		allowed = m.limiter.Allow(failure, configured, labels)
+	}
+
+	targets := []target{}
+	for _, t := range allowed {
+		targets = append(targets, target{reporter: t.Reporter, instance: t.Instance})
+	}
+
+	if len(targets) < len(configured) {
+		log.Printf("Limiting %s with %d of %d reporter instances", failure, len(configured)-len(targets), len(configured))
+	}
+
+	return targets
+}
+
+// enrich adds details to the failure with the enricher
+func (m *Monitor) enrich(failure complainer.Failure) complainer.Failure {
+	if m.enricher == nil {
+		return failure
+	}
+
+	enriched, err := m.enricher.Enrich(failure)
+	if err != nil {
+		log.Printf("Error enriching failure of %s: %s", failure.ID, err)
+	}
+
+	return enriched
+}
+
+// upload uploads logs of the failure, calls are retried with the pipeline
+func (m *Monitor) upload(source *monitoredSource, failure complainer.Failure, labels label.Labels) (string, string, error) {
+	stdoutURL, stderrURL, err := m.logs(source.source, failure, labels)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get stdout and stderr urls from %s: %s", source.source.Name(), err)
+	}
+
+	if stdoutURL == "" && stderrURL == "" {
+		return "", "", nil
+	}
+
+	if m.pipeline == nil {
+		stdoutURL, stderrURL, err = m.uploader.Upload(failure, source.source.Client(), stdoutURL, stderrURL)
+		if err != nil {
+			return "", "", fmt.Errorf("cannot get stdout and stderr urls from uploader: %s", err)
+		}
+
+		return stdoutURL, stderrURL, nil
+	}
+
+	uploadedStdoutURL, uploadedStderrURL := "", ""
+
+	err = m.pipeline.retry(fmt.Sprintf("uploading logs of %s", failure.ID), func() error {
+		var err error
+		uploadedStdoutURL, uploadedStderrURL, err = m.uploader.Upload(failure, source.source.Client(), stdoutURL, stderrURL)
+		return err
+	})
+
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get stdout and stderr urls from uploader: %s", err)
+	}
+
+	return uploadedStdoutURL, uploadedStderrURL, nil
+}
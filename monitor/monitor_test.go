@@ -0,0 +1,417 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/store"
+)
+
+type testSource struct {
+	failures []complainer.Failure
+}
+
+func (s *testSource) Name() string {
+	return "test"
+}
+
+func (s *testSource) Failures() ([]complainer.Failure, error) {
+	return s.failures, nil
+}
+
+func (s *testSource) Logs(failure complainer.Failure) (string, string, error) {
+	return "", "", nil
+}
+
+func (s *testSource) Client() *http.Client {
+	return http.DefaultClient
+}
+
+func reportedIDs(r *testReporter) []string {
+	ids := []string{}
+	for _, failure := range r.failures {
+		ids = append(ids, failure.ID)
+	}
+
+	return ids
+}
+
+func TestRunWithoutStore(t *testing.T) {
+	source := &testSource{failures: []complainer.Failure{{ID: "old", Finished: time.Now()}}}
+	rep := &testReporter{}
+
+	m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	source.failures = append(source.failures, complainer.Failure{ID: "new", Finished: time.Now()})
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures from the first run are only marked as seen
+	if ids := reportedIDs(rep); !reflect.DeepEqual(ids, []string{"new"}) {
+		t.Errorf("unexpected reported failures: %v", ids)
+	}
+}
+
+func TestRunWithStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "store.json")
+	now := time.Now()
+
+	source := &testSource{
+		failures: []complainer.Failure{
+			{ID: "reported", Finished: now.Add(-time.Minute * 20)},
+			{ID: "ancient", Finished: now.Add(-time.Hour * 2)},
+		},
+	}
+
+	run := func() []string {
+		s, err := store.NewFileStore(path, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rep := &testReporter{}
+
+		m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+		m.UseStore(s, store.Windows{CatchUp: time.Hour, Grace: time.Minute})
+
+		if err := m.Run("test"); err != nil {
+			t.Fatal(err)
+		}
+
+		return reportedIDs(rep)
+	}
+
+	// Failures within the catch up window are reported on the first run
+	if ids := run(); !reflect.DeepEqual(ids, []string{"reported"}) {
+		t.Errorf("unexpected reported failures on first start: %v", ids)
+	}
+
+	// Failures that happened while not running are caught up, the
+	// ones reported before the restart are not reported again
+	source.failures = append(source.failures, complainer.Failure{ID: "missed", Finished: now.Add(-time.Second)})
+
+	if ids := run(); !reflect.DeepEqual(ids, []string{"missed"}) {
+		t.Errorf("unexpected reported failures after restart: %v", ids)
+	}
+
+	// Failures that finished well before the last run were seen by it,
+	// they were not reported for a reason
+	source.failures = append(source.failures, complainer.Failure{ID: "filtered", Finished: now.Add(-time.Minute * 10)})
+
+	if ids := run(); len(ids) != 0 {
+		t.Errorf("unexpected reported failures after second restart: %v", ids)
+	}
+}
+
+func TestRunWithStoreUndelivered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "store.json")
+	source := &testSource{}
+	rep := &downReporter{}
+
+	run := func() {
+		s, err := store.NewFileStore(path, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"down": rep}, true, nil, nil, nil)
+		m.UseStore(s, store.Windows{CatchUp: time.Hour, Grace: time.Minute})
+
+		if err := m.Run("test"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run()
+
+	// Failures that were not delivered or kept are not remembered
+	source.failures = []complainer.Failure{{ID: "lost", Finished: time.Now()}}
+	run()
+
+	rep.up = true
+	run()
+	run()
+
+	if !reflect.DeepEqual(rep.reported, []string{"lost"}) {
+		t.Errorf("expected undelivered failure to be reported once after restart, got %v", rep.reported)
+	}
+}
+
+type testElector struct {
+	leader bool
+}
+
+func (e *testElector) ID() string {
+	return "replica"
+}
+
+func (e *testElector) Leader() bool {
+	return e.leader
+}
+
+func TestRunStandby(t *testing.T) {
+	source := &testSource{}
+	rep := &testReporter{}
+	elector := &testElector{}
+
+	m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+	m.UseElector(elector)
+
+	run := func(id string) {
+		source.failures = append(source.failures, complainer.Failure{ID: id, Finished: time.Now()})
+
+		if err := m.Run("test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Standby does not report, the leader that takes over reports
+	// failures that happened during the handover
+	run("standby")
+	elector.leader = true
+	run("first")
+	run("leader")
+
+	if ids := reportedIDs(rep); !reflect.DeepEqual(ids, []string{"standby", "first", "leader"}) {
+		t.Errorf("unexpected reported failures: %v", ids)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	m.handleHealthCheck(recorder, req)
+
+	if !strings.Contains(recorder.Body.String(), "election replica: leader") {
+		t.Errorf("expected leadership in health check, got %q", recorder.Body.String())
+	}
+}
+
+func TestRunFailover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "store.json")
+	now := time.Now()
+
+	source := &testSource{
+		failures: []complainer.Failure{{ID: "old", Finished: now.Add(-time.Minute * 20)}},
+	}
+
+	replica := func(leader bool) (*Monitor, *testElector, *testReporter) {
+		s, err := store.NewFileStore(path, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rep := &testReporter{}
+		elector := &testElector{leader: leader}
+
+		m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+		m.UseStore(s, store.Windows{CatchUp: time.Hour, Grace: time.Minute})
+		m.UseElector(elector)
+
+		return m, elector, rep
+	}
+
+	one, oneElector, oneReporter := replica(true)
+	two, twoElector, twoReporter := replica(false)
+
+	run := func(id string) {
+		if id != "" {
+			source.failures = append(source.failures, complainer.Failure{ID: id, Finished: time.Now()})
+		}
+
+		for _, m := range []*Monitor{one, two} {
+			if err := m.Run("test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	run("first")
+
+	// The new leader continues after the previous one
+	oneElector.leader, twoElector.leader = false, true
+	run("")
+	run("second")
+
+	// Failures reported by the other replica are not reported after failing back
+	oneElector.leader, twoElector.leader = true, false
+	run("third")
+
+	if ids := reportedIDs(oneReporter); !reflect.DeepEqual(ids, []string{"old", "first", "third"}) {
+		t.Errorf("unexpected failures reported by the first replica: %v", ids)
+	}
+
+	if ids := reportedIDs(twoReporter); !reflect.DeepEqual(ids, []string{"second"}) {
+		t.Errorf("unexpected failures reported by the second replica: %v", ids)
+	}
+}
+
+type testSharder struct {
+	owned map[string]bool
+}
+
+func (s *testSharder) Owns(failure complainer.Failure) bool {
+	return s.owned[failure.Framework]
+}
+
+func (s *testSharder) Status() string {
+	return "replica by framework"
+}
+
+func TestRunSharded(t *testing.T) {
+	source := &testSource{}
+	rep := &testReporter{}
+	sharder := &testSharder{owned: map[string]bool{"mine": true}}
+
+	m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+	m.UseSharder(sharder)
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	source.failures = []complainer.Failure{
+		{ID: "mine", Framework: "mine", Finished: time.Now()},
+		{ID: "theirs", Framework: "theirs", Finished: time.Now()},
+	}
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other shard moves here once its owner is gone
+	sharder.owned["theirs"] = true
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := reportedIDs(rep); !reflect.DeepEqual(ids, []string{"mine", "theirs"}) {
+		t.Errorf("unexpected reported failures: %v", ids)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	m.handleHealthCheck(recorder, req)
+
+	if !strings.Contains(recorder.Body.String(), "shard replica by framework") {
+		t.Errorf("expected shard ownership in health check, got %q", recorder.Body.String())
+	}
+}
+
+// shardedSource records the owner it was given
+type shardedSource struct {
+	testSource
+	owns func(failure complainer.Failure) bool
+}
+
+func (s *shardedSource) UseOwner(owns func(failure complainer.Failure) bool) {
+	s.owns = owns
+}
+
+func TestRunShardedWithStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := store.NewFileStore(filepath.Join(dir, "store.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	source := &shardedSource{}
+	rep := &testReporter{}
+	sharder := &testSharder{owned: map[string]bool{"mine": true}}
+
+	m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+	m.UseStore(s, store.Windows{CatchUp: time.Hour, Grace: time.Minute})
+	m.UseSharder(sharder)
+
+	if source.owns == nil || !source.owns(complainer.Failure{Framework: "mine"}) {
+		t.Fatalf("expected the source to get the owner")
+	}
+
+	source.failures = []complainer.Failure{
+		{ID: "mine", Framework: "mine", Finished: now},
+		{ID: "theirs", Framework: "theirs", Finished: now.Add(-time.Minute * 10)},
+	}
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen, err := s.Seen("test", "theirs"); err != nil || seen {
+		t.Errorf("expected failure of other shard not to be seen, got %v (%v)", seen, err)
+	}
+
+	// Failures of other shards are caught up on even if they finished
+	// well before the source was last processed
+	sharder.owned["theirs"] = true
+
+	if err := m.Run("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := reportedIDs(rep); !reflect.DeepEqual(ids, []string{"mine", "theirs"}) {
+		t.Errorf("unexpected reported failures: %v", ids)
+	}
+}
@@ -0,0 +1,203 @@
+package monitor
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// pipelineMetrics counts queued, retried and dropped uploads and reports
+var pipelineMetrics = expvar.NewMap("pipeline")
+
+// PipelineConfig configures concurrent uploading and reporting of failures
+type PipelineConfig struct {
+	// Workers is the number of failures that have their logs uploaded at once
+	Workers int
+	// QueueSize is the size of the upload queue and of every reporter queue
+	QueueSize int
+	// Retries is the number of retries of failed uploads and reports
+	Retries int
+	// Backoff is the delay before the first retry, doubled with every retry
+	Backoff time.Duration
+}
+
+// uploadJob is the failure waiting for its logs to be uploaded,
+// done is called once logs are no longer needed
+type uploadJob struct {
+	source   *monitoredSource
+	failure  complainer.Failure
+	labels   label.Labels
+	targets  []target
+	done     func()
+	delivery *delivery
+}
+
+// reportJob is the failure with uploaded logs waiting to be reported
+type reportJob struct {
+	failure   complainer.Failure
+	config    reporter.ConfigProvider
+	stdoutURL string
+	stderrURL string
+	delivery  *delivery
+}
+
+// pipeline uploads logs with a pool of workers and reports failures
+// from a queue per reporter instance, so that slow reporters only
+// delay their own reports
+type pipeline struct {
+	config  PipelineConfig
+	uploads chan uploadJob
+	reports map[string]chan reportJob
+	mu      sync.Mutex
+}
+
+// UsePipeline makes the monitor upload and report failures concurrently
+// with retries, failures are queued instead of being reported before the
+// next one is checked. It must be called before running.
+func (m *Monitor) UsePipeline(config PipelineConfig) error {
+	if config.Workers < 1 || config.QueueSize < 1 {
+		return errors.New("at least one worker and queue size of one are required")
+	}
+
+	m.pipeline = &pipeline{
+		config:  config,
+		uploads: make(chan uploadJob, config.QueueSize),
+		reports: map[string]chan reportJob{},
+	}
+
+	for i := 0; i < config.Workers; i++ {
+		go m.uploadWorker()
+	}
+
+	return nil
+}
+
+func (m *Monitor) uploadWorker() {
+	for job := range m.pipeline.uploads {
+		pipelineMetrics.Add("uploads.queued", -1)
+
+		stdoutURL, stderrURL, err := m.upload(job.source, job.failure, job.labels)
+		job.done()
+
+		// Failures are better reported without logs than not at all
+		if err != nil {
+			pipelineMetrics.Add("uploads.failed", 1)
+			log.Printf("Error uploading logs of %s, reporting without them: %s", job.failure.ID, err)
+		}
+
+		for _, t := range job.targets {
+			m.pipeline.enqueueReport(m, t.reporter, t.instance, reportJob{
+				failure:   job.failure,
+				config:    reporter.NewConfigProvider(job.labels, t.reporter, t.instance),
+				stdoutURL: stdoutURL,
+				stderrURL: stderrURL,
+				delivery:  job.delivery,
+			})
+		}
+	}
+}
+
+// enqueueUpload queues the failure, notifications of failures that do
+// not fit into the full queue are kept as undelivered for every target
+func (p *pipeline) enqueueUpload(m *Monitor, job uploadJob) {
+	select {
+	case p.uploads <- job:
+		pipelineMetrics.Add("uploads.queued", 1)
+	default:
+		pipelineMetrics.Add("uploads.dropped", 1)
+		job.done()
+
+		err := fmt.Errorf("upload queue is full with %d failures", cap(p.uploads))
+		for _, t := range job.targets {
+			config := reporter.NewConfigProvider(job.labels, t.reporter, t.instance)
+			job.delivery.done(m.deadLetter(t.reporter, t.instance, job.failure, config, "", "", err))
+		}
+	}
+}
+
+// enqueueReport queues the report for the reporter instance, the queue
+// and its worker are created on first use
+func (p *pipeline) enqueueReport(m *Monitor, name, instance string, job reportJob) {
+	key := name + "/" + instance
+
+	p.mu.Lock()
+	queue, ok := p.reports[key]
+	if !ok {
+		queue = make(chan reportJob, p.config.QueueSize)
+		p.reports[key] = queue
+
+		go m.reportWorker(name, instance, queue)
+	}
+	p.mu.Unlock()
+
+	select {
+	case queue <- job:
+		pipelineMetrics.Add("reports.queued", 1)
+	default:
+		pipelineMetrics.Add("reports.dropped", 1)
+		job.delivery.done(m.deadLetter(name, instance, job.failure, job.config, job.stdoutURL, job.stderrURL, errors.New("queue is full")))
+	}
+}
+
+func (m *Monitor) reportWorker(name, instance string, queue <-chan reportJob) {
+	r := m.reporters[name]
+
+	for job := range queue {
+		pipelineMetrics.Add("reports.queued", -1)
+
+		err := m.pipeline.retry(fmt.Sprintf("reporting %s with %s [instance=%s]", job.failure.ID, name, instance), func() error {
+			return r.Report(job.failure, job.config, job.stdoutURL, job.stderrURL)
+		})
+
+		if err != nil {
+			pipelineMetrics.Add("reports.failed", 1)
+			job.delivery.done(m.deadLetter(name, instance, job.failure, job.config, job.stdoutURL, job.stderrURL, err))
+			continue
+		}
+
+		job.delivery.delivered(target{reporter: name, instance: instance})
+	}
+}
+
+// retry calls until the call succeeds or retries are exhausted, delays
+// between attempts grow exponentially unless the remote side asks for
+// a specific delay. Calls are limited by timeouts of uploaders and
+// reporters, the next attempt starts only after the previous one ended.
+func (p *pipeline) retry(what string, call func() error) error {
+	backoff := p.config.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= p.config.Retries {
+			return err
+		}
+
+		delay := backoff
+		if after, ok := reporter.RetryAfter(err); ok && after > 0 {
+			delay = after
+		}
+
+		pipelineMetrics.Add("retries", 1)
+		log.Printf("Error %s, retrying in %s: %s", what, delay, err)
+
+		time.Sleep(delay)
+		backoff *= 2
+	}
+}
+
+// call calls with retries of the pipeline,
+// without the pipeline it is called once
+func (m *Monitor) call(what string, call func() error) error {
+	if m.pipeline == nil {
+		return call()
+	}
+
+	return m.pipeline.retry(what, call)
+}
@@ -0,0 +1,237 @@
+package monitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/store"
+)
+
+// flakyReporter asks to retry later on the first attempt of every failure
+type flakyReporter struct {
+	attempts map[string]int
+	reported chan string
+}
+
+func (r *flakyReporter) Report(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.attempts[failure.ID]++
+	if r.attempts[failure.ID] == 1 {
+		return &reporter.RetryAfterError{After: time.Millisecond * 10, Err: errors.New("too many requests")}
+	}
+
+	r.reported <- failure.ID
+
+	return nil
+}
+
+// slowReporter fails every report after it is released,
+// it counts reports running at the same time
+type slowReporter struct {
+	calls   chan string
+	release chan struct{}
+	running int32
+	overlap int32
+}
+
+func (r *slowReporter) Report(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	if atomic.AddInt32(&r.running, 1) > 1 {
+		atomic.StoreInt32(&r.overlap, 1)
+	}
+
+	defer atomic.AddInt32(&r.running, -1)
+
+	r.calls <- failure.ID
+	<-r.release
+
+	return errors.New("timed out")
+}
+
+func TestPipeline(t *testing.T) {
+	flaky := &flakyReporter{attempts: map[string]int{}, reported: make(chan string, 10)}
+	slow := &slowReporter{calls: make(chan string, 10), release: make(chan struct{})}
+
+	m := NewMonitor("test", "1.0", nil, nil, map[string]reporter.Reporter{"flaky": flaky, "slow": slow}, true, nil, nil, nil)
+
+	if err := m.UsePipeline(PipelineConfig{}); err == nil {
+		t.Errorf("expected error for pipeline without workers")
+	}
+
+	err := m.UsePipeline(PipelineConfig{
+		Workers:   2,
+		QueueSize: 10,
+		Retries:   1,
+		Backoff:   time.Millisecond * 10,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &monitoredSource{source: &testSource{}}
+	done := make(chan string, 10)
+
+	for _, id := range []string{"one", "two"} {
+		id := id
+		if err := m.processFailure(source, complainer.Failure{ID: id}, func() { done <- id }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Slow reporter does not delay others
+	reported := []string{}
+	for len(reported) < 2 {
+		select {
+		case id := <-flaky.reported:
+			reported = append(reported, id)
+		case <-time.After(time.Second):
+			t.Fatalf("expected failures to be reported, got %v", reported)
+		}
+	}
+
+	if !reflect.DeepEqual(reported, []string{"one", "two"}) {
+		t.Errorf("unexpected reported failures: %v", reported)
+	}
+
+	if len(done) != 2 {
+		t.Errorf("expected done to be called for both failures, got %d", len(done))
+	}
+
+	// Slow calls are not retried while they are still running
+	select {
+	case id := <-slow.calls:
+		if id != "one" {
+			t.Errorf("unexpected first call of slow reporter: %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected slow reporter to be called")
+	}
+
+	select {
+	case id := <-slow.calls:
+		t.Fatalf("unexpected call of slow reporter while the previous one is running: %s", id)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(slow.release)
+
+	calls := []string{"one"}
+	for len(calls) < 4 {
+		select {
+		case id := <-slow.calls:
+			calls = append(calls, id)
+		case <-time.After(time.Second):
+			t.Fatalf("expected slow calls to be retried, got %v", calls)
+		}
+	}
+
+	if !reflect.DeepEqual(calls, []string{"one", "one", "two", "two"}) {
+		t.Errorf("unexpected calls of slow reporter: %v", calls)
+	}
+
+	if atomic.LoadInt32(&slow.overlap) != 0 {
+		t.Errorf("expected calls of slow reporter not to overlap")
+	}
+}
+
+// logsSource has logs for every failure
+type logsSource struct {
+	testSource
+}
+
+func (s *logsSource) Logs(failure complainer.Failure) (string, string, error) {
+	return "http://agent/stdout", "http://agent/stderr", nil
+}
+
+// blockedUploader slowly fails every upload after it is released
+type blockedUploader struct {
+	release chan struct{}
+}
+
+func (u *blockedUploader) Upload(failure complainer.Failure, client *http.Client, stdoutURL, stderrURL string) (string, string, error) {
+	<-u.release
+	time.Sleep(time.Millisecond * 10)
+	return "", "", errors.New("storage is down")
+}
+
+// channelReporter sends reported failures with their logs to the channel
+type channelReporter struct {
+	reported chan string
+}
+
+func (r *channelReporter) Report(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.reported <- failure.ID + " " + stdoutURL + " " + stderrURL
+	return nil
+}
+
+func TestPipelineUploadFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	letters, err := store.NewFileDeadLetters(filepath.Join(dir, "dead-letters.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := &blockedUploader{release: make(chan struct{})}
+	rep := &channelReporter{reported: make(chan string, 10)}
+
+	m := NewMonitor("test", "1.0", nil, up, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+	m.UseDeadLetters(letters, nil)
+
+	if err := m.UsePipeline(PipelineConfig{Workers: 1, QueueSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &monitoredSource{source: &logsSource{}}
+
+	// The first failure blocks the worker, the next two wait in the
+	// queue and the last one does not fit
+	for _, id := range []string{"one", "two", "three", "four"} {
+		if err := m.processFailure(source, complainer.Failure{ID: id}, func() {}); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	list, err := letters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Failure.ID != "four" {
+		t.Errorf("expected failure that did not fit into the queue to be kept, got %+v", list)
+	}
+
+	// Failures with logs that cannot be uploaded are reported without them
+	close(up.release)
+
+	reported := []string{}
+	for len(reported) < 3 {
+		select {
+		case r := <-rep.reported:
+			reported = append(reported, r)
+		case <-time.After(time.Second):
+			t.Fatalf("expected failures to be reported without logs, got %v", reported)
+		}
+	}
+
+	if !reflect.DeepEqual(reported, []string{"one  ", "two  ", "three  "}) {
+		t.Errorf("unexpected reported failures: %q", reported)
+	}
+}
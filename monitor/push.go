@@ -0,0 +1,326 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const (
+	// PushPath is the path of the endpoint that accepts pushed failures
+	PushPath = "/api/v1/failures"
+	// maximum size of pushed failure with inline logs
+	maxPushSize = 10 << 20
+	// scheme of urls of inline logs, they never leave the process
+	inlineScheme = "inline"
+)
+
+// PushedFailure is the failure pushed over http, logs are either
+// fetched from urls or given inline, missing logs are empty
+type PushedFailure struct {
+	complainer.Failure
+
+	StdoutURL string `json:"stdout_url"`
+	StderrURL string `json:"stderr_url"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+}
+
+// pushSource holds logs of failures that are being pushed,
+// remote logs are only fetched from allowed hosts
+type pushSource struct {
+	name     string
+	tokens   []string
+	logHosts []string
+	logs     map[string]PushedFailure
+	mu       sync.Mutex
+}
+
+func (p *pushSource) Name() string {
+	return p.name
+}
+
+// Failures is never called, pushed failures are processed as they come
+func (p *pushSource) Failures() ([]complainer.Failure, error) {
+	return nil, nil
+}
+
+func (p *pushSource) Logs(failure complainer.Failure) (string, string, error) {
+	p.mu.Lock()
+	pushed, ok := p.logs[failure.ID]
+	p.mu.Unlock()
+
+	if !ok || (pushed.StdoutURL == "" && pushed.StderrURL == "" && pushed.Stdout == "" && pushed.Stderr == "") {
+		return "", "", nil
+	}
+
+	stdoutURL := pushed.StdoutURL
+	if stdoutURL == "" {
+		stdoutURL = inlineURL(failure.ID, "stdout")
+	}
+
+	stderrURL := pushed.StderrURL
+	if stderrURL == "" {
+		stderrURL = inlineURL(failure.ID, "stderr")
+	}
+
+	return stdoutURL, stderrURL, nil
+}
+
+// Client returns http client that serves inline logs from memory
+func (p *pushSource) Client() *http.Client {
+	return &http.Client{
+		Transport: p,
+		Timeout:   time.Minute,
+	}
+}
+
+func (p *pushSource) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != inlineScheme {
+		// Redirects are checked here as well
+		if !p.allowedLogURL(req.URL) {
+			return nil, fmt.Errorf("fetching logs from %s is not allowed", req.URL.Host)
+		}
+
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, "/")
+
+	p.mu.Lock()
+	pushed, ok := p.logs[id]
+	p.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("cannot find logs of %s", id)
+	}
+
+	body := pushed.Stdout
+	if req.URL.Host == "stderr" {
+		body = pushed.Stderr
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// allowedLogURL reports whether logs can be fetched from the url,
+// only http and https urls of allowed hosts are fetched
+func (p *pushSource) allowedLogURL(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	hostname := strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]")
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		hostname = h
+	}
+
+	for _, host := range p.logHosts {
+		if u.Host == host || hostname == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkLogURLs checks that remote logs of the pushed failure
+// can be fetched, empty urls are fine
+func (p *pushSource) checkLogURLs(pushed PushedFailure) error {
+	for _, raw := range []string{pushed.StdoutURL, pushed.StderrURL} {
+		if raw == "" {
+			continue
+		}
+
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("cannot parse log url: %s", err)
+		}
+
+		if !p.allowedLogURL(u) {
+			return fmt.Errorf("fetching logs from %s is not allowed, logs can be given inline", u.Host)
+		}
+	}
+
+	return nil
+}
+
+// authorized checks the bearer token of the request
+func (p *pushSource) authorized(r *http.Request) bool {
+	return authorized(r, p.tokens)
+}
+
+// authorized checks that the request has one of the tokens as bearer token
+func authorized(r *http.Request, tokens []string) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+
+	for _, allowed := range tokens {
+		if subtle.ConstantTimeCompare(token, []byte(allowed)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func inlineURL(id, stream string) string {
+	u := url.URL{Scheme: inlineScheme, Host: stream, Path: "/" + id}
+	return u.String()
+}
+
+// EnablePush enables the endpoint for failures pushed by the callers that
+// have one of the tokens, logs that are not inline are only fetched from
+// http and https urls of log hosts. It must be called before serving http.
+func (m *Monitor) EnablePush(name string, tokens, logHosts []string) error {
+	if len(tokens) == 0 {
+		return errors.New("at least one token is required")
+	}
+
+	if _, ok := m.sources[name]; ok {
+		return fmt.Errorf("name %s is already taken", name)
+	}
+
+	m.push = &monitoredSource{
+		source: &pushSource{
+			name:     name,
+			tokens:   tokens,
+			logHosts: logHosts,
+			logs:     map[string]PushedFailure{},
+		},
+		recent: map[string]time.Time{},
+	}
+
+	return nil
+}
+
+func (m *Monitor) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Callers are expected to retry with other replicas
+	if !m.leading() {
+		http.Error(w, "not the leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	push := m.push.source.(*pushSource)
+
+	if !push.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pushed := PushedFailure{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSize)).Decode(&pushed); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode failure: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	failure, err := pushedFailure(push.name, pushed.Failure)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := push.checkLogURLs(pushed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The store forgets failures older than the catch up window,
+	// so they cannot be deduplicated
+	if m.store != nil && time.Since(failure.Finished) > m.windows.CatchUp {
+		http.Error(w, fmt.Sprintf("failure finished more than %s ago", m.windows.CatchUp), http.StatusBadRequest)
+		return
+	}
+
+	m.pushMu.Lock()
+	report := m.checkFailure(m.push, failure, false)
+	m.push.cleanupRecent()
+	m.pushMu.Unlock()
+
+	if !report {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "skipped")
+		return
+	}
+
+	push.mu.Lock()
+	push.logs[failure.ID] = pushed
+	push.mu.Unlock()
+
+	done := func() {
+		push.mu.Lock()
+		delete(push.logs, failure.ID)
+		push.mu.Unlock()
+	}
+
+	if err := m.processFailure(m.push, failure, done); err != nil {
+		// Callers are expected to retry failures that were not accepted
+		m.pushMu.Lock()
+		delete(m.push.recent, failure.ID)
+		m.pushMu.Unlock()
+
+		log.Printf("Error reporting pushed failure of %s: %s", failure.ID, err)
+		http.Error(w, fmt.Sprintf("cannot report failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "reported")
+}
+
+// pushedFailure validates the failure and fills in the defaults
+func pushedFailure(name string, failure complainer.Failure) (complainer.Failure, error) {
+	if failure.ID == "" || failure.Name == "" {
+		return failure, errors.New("failure id and name are required")
+	}
+
+	if failure.Cluster == "" {
+		failure.Cluster = name
+	}
+
+	if failure.Finished.IsZero() {
+		failure.Finished = time.Now()
+	}
+
+	if failure.Started.IsZero() {
+		failure.Started = failure.Finished
+	}
+
+	if failure.Labels == nil {
+		failure.Labels = map[string]string{}
+	}
+
+	return failure, nil
+}
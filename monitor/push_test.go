@@ -0,0 +1,244 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/store"
+)
+
+type testUploader struct {
+	logs map[string]string
+}
+
+func (u *testUploader) Upload(failure complainer.Failure, client *http.Client, stdoutURL, stderrURL string) (string, string, error) {
+	for _, url := range []string{stdoutURL, stderrURL} {
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", "", err
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return "", "", err
+		}
+
+		u.logs[url] = string(body)
+	}
+
+	return "uploaded-stdout", "uploaded-stderr", nil
+}
+
+type testReporter struct {
+	failures []complainer.Failure
+	logs     []string
+}
+
+func (r *testReporter) Report(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.failures = append(r.failures, failure)
+	r.logs = append(r.logs, stdoutURL, stderrURL)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("remote " + r.URL.Path))
+	}))
+
+	defer logs.Close()
+
+	up := &testUploader{logs: map[string]string{}}
+	rep := &testReporter{}
+
+	m := NewMonitor("test", "1.0", nil, up, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+	if err := m.EnablePush("push", []string{"secret", "other"}, []string{strings.TrimPrefix(logs.URL, "http://")}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	table := []struct {
+		token  string
+		method string
+		body   string
+		status int
+	}{
+		{
+			token:  "wrong",
+			method: http.MethodPost,
+			body:   `{"id": "job.1", "name": "job"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			token:  "secret",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			token:  "secret",
+			method: http.MethodPost,
+			body:   `{"id": "job.1"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			token:  "secret",
+			method: http.MethodPost,
+			body:   `{"id": "job.1", "name": "job", "stdout_url": "http://169.254.169.254/latest/meta-data"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			token:  "secret",
+			method: http.MethodPost,
+			body:   `{"id": "job.1", "name": "job", "stdout_url": "file:///etc/passwd"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			token:  "secret",
+			method: http.MethodPost,
+			body:   `{"id": "job.1", "name": "job", "labels": {"complainer_foo": "bar"}, "stdout": "inline stdout", "stderr_url": "` + logs.URL + `/stderr"}`,
+			status: http.StatusAccepted,
+		},
+		{
+			token:  "other",
+			method: http.MethodPost,
+			body:   `{"id": "job.1", "name": "job"}`,
+			status: http.StatusOK,
+		},
+		{
+			token:  "other",
+			method: http.MethodPost,
+			body:   `{"id": "job.2", "name": "job", "cluster": "batch"}`,
+			status: http.StatusAccepted,
+		},
+		{
+			token:  "secret",
+			method: http.MethodPost,
+			body:   `{"id": "job.3", "name": "job", "finished": "2016-11-24T15:00:00Z"}`,
+			status: http.StatusAccepted,
+		},
+		{
+			token:  "secret",
+			method: http.MethodPost,
+			body:   `{"id": "job.3", "name": "job", "finished": "2016-11-24T15:00:00Z"}`,
+			status: http.StatusOK,
+		},
+	}
+
+	for i, tt := range table {
+		req, err := http.NewRequest(tt.method, server.URL+PushPath, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("expected status %d for request %d, got %d", tt.status, i, resp.StatusCode)
+		}
+	}
+
+	if len(rep.failures) != 3 {
+		t.Fatalf("expected 3 reported failures, got %d", len(rep.failures))
+	}
+
+	first := rep.failures[0]
+	if first.ID != "job.1" || first.Cluster != "push" || first.Labels["complainer_foo"] != "bar" || first.Finished.IsZero() {
+		t.Errorf("unexpected first failure: %+v", first)
+	}
+
+	if rep.logs[0] != "uploaded-stdout" || rep.logs[1] != "uploaded-stderr" {
+		t.Errorf("expected uploaded logs for first failure, got %v", rep.logs[:2])
+	}
+
+	if up.logs[inlineURL("job.1", "stdout")] != "inline stdout" || up.logs[logs.URL+"/stderr"] != "remote /stderr" {
+		t.Errorf("unexpected uploaded logs: %v", up.logs)
+	}
+
+	// Failures without logs are reported without uploading
+	if rep.failures[1].Cluster != "batch" || rep.logs[2] != "" || rep.logs[3] != "" {
+		t.Errorf("unexpected second failure: %+v with logs %v", rep.failures[1], rep.logs[2:])
+	}
+
+	if len(up.logs) != 2 {
+		t.Errorf("expected 2 uploaded logs, got %v", up.logs)
+	}
+}
+
+func TestPushWithStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := store.NewFileStore(filepath.Join(dir, "store.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep := &testReporter{}
+
+	m := NewMonitor("test", "1.0", nil, nil, map[string]reporter.Reporter{"test": rep}, true, nil, nil, nil)
+	m.UseStore(s, store.Windows{CatchUp: time.Hour, Grace: time.Minute})
+	if err := m.EnablePush("push", []string{"secret"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	table := []struct {
+		finished time.Time
+		status   int
+	}{
+		{finished: time.Now().Add(-time.Minute * 30), status: http.StatusAccepted},
+		{finished: time.Now().Add(-time.Hour * 2), status: http.StatusBadRequest},
+	}
+
+	for i, tt := range table {
+		body := fmt.Sprintf(`{"id": "job.%d", "name": "job", "finished": %q}`, i, tt.finished.Format(time.RFC3339))
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+PushPath, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("expected status %d for request %d, got %d", tt.status, i, resp.StatusCode)
+		}
+	}
+
+	if len(rep.failures) != 1 {
+		t.Errorf("expected 1 reported failure, got %d", len(rep.failures))
+	}
+}
@@ -0,0 +1,183 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// recovery tracks apps with reported failures until they recover
+type recovery struct {
+	stable   time.Duration
+	timeout  time.Duration
+	interval time.Duration
+	failed   map[string]map[string]*failedApp
+	mu       sync.Mutex
+}
+
+// failedApp is the app with the last reported failure
+// and reporter instances it was reported with
+type failedApp struct {
+	failure complainer.Failure
+	targets map[target]bool
+}
+
+// UseRecovery makes the monitor tell reporters when apps with reported
+// failures recover: their replacement tasks keep running for the stable
+// duration. Apps that do not recover within the timeout are forgotten,
+// running tasks are listed every interval. It must be called before running.
+func (m *Monitor) UseRecovery(stable, timeout, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("recovery check interval must be positive")
+	}
+
+	m.recovery = &recovery{
+		stable:   stable,
+		timeout:  timeout,
+		interval: interval,
+		failed:   map[string]map[string]*failedApp{},
+	}
+
+	return nil
+}
+
+// track remembers the app of the failure delivered to the reporter
+// instance if the source can tell when it recovers
+func (m *Monitor) track(source *monitoredSource, failure complainer.Failure, t target) {
+	if m.recovery == nil {
+		return
+	}
+
+	if _, ok := source.source.(RecoverySource); !ok {
+		return
+	}
+
+	m.recovery.mu.Lock()
+	defer m.recovery.mu.Unlock()
+
+	name := source.source.Name()
+	if m.recovery.failed[name] == nil {
+		m.recovery.failed[name] = map[string]*failedApp{}
+	}
+
+	key := failure.Framework + "/" + failure.Name
+
+	app, ok := m.recovery.failed[name][key]
+	if !ok {
+		app = &failedApp{targets: map[target]bool{}}
+		m.recovery.failed[name][key] = app
+	}
+
+	app.failure = failure
+	app.targets[t] = true
+}
+
+// RunRecovery checks running tasks of apps with reported failures
+// and resolves recovered ones, it never returns
+func (m *Monitor) RunRecovery() {
+	for range time.Tick(m.recovery.interval) {
+		for _, name := range m.names {
+			if err := m.checkRecovery(name); err != nil {
+				log.Printf("Error checking recovery of %s: %s", name, err)
+			}
+		}
+	}
+}
+
+// checkRecovery resolves apps of the source that recovered
+func (m *Monitor) checkRecovery(name string) error {
+	source, ok := m.sources[name].source.(RecoverySource)
+	if !ok || !m.leading() {
+		return nil
+	}
+
+	m.recovery.mu.Lock()
+	failed := map[string]failedApp{}
+	for key, app := range m.recovery.failed[name] {
+		failed[key] = *app
+	}
+	m.recovery.mu.Unlock()
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	tasks, err := source.Running()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for key, app := range failed {
+		if now.Sub(app.failure.Finished) > m.recovery.timeout {
+			m.forget(name, key, app.failure)
+			continue
+		}
+
+		for _, task := range tasks {
+			// Tasks that started before the failure are not replacements
+			if task.Framework != app.failure.Framework || task.Name != app.failure.Name || !task.Started.After(app.failure.Finished) {
+				continue
+			}
+
+			if now.Sub(task.Started) < m.recovery.stable {
+				continue
+			}
+
+			// Apps that failed again while being checked are kept
+			if m.forget(name, key, app.failure) {
+				m.resolve(app)
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
+// forget stops tracking the app unless it has failed again
+func (m *Monitor) forget(name, key string, failure complainer.Failure) bool {
+	m.recovery.mu.Lock()
+	defer m.recovery.mu.Unlock()
+
+	app, ok := m.recovery.failed[name][key]
+	if !ok || app.failure.ID != failure.ID {
+		return false
+	}
+
+	delete(m.recovery.failed[name], key)
+
+	return true
+}
+
+// resolve tells reporters that support it that the app recovered
+func (m *Monitor) resolve(app failedApp) {
+	log.Printf("Resolving %s", app.failure)
+
+	labels := label.NewLabels(m.name, app.failure.Labels, m.defaults)
+
+	for t := range app.targets {
+		resolver, ok := m.reporters[t.reporter].(reporter.Resolver)
+		if !ok {
+			continue
+		}
+
+		config := reporter.NewConfigProvider(labels, t.reporter, t.instance)
+
+		err := m.call(fmt.Sprintf("resolving %s with %s [instance=%s]", app.failure.ID, t.reporter, t.instance), func() error {
+			return resolver.Resolve(app.failure, config)
+		})
+
+		if err != nil {
+			log.Printf("Cannot resolve %s with %s [instance=%s]: %s", app.failure.ID, t.reporter, t.instance, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// runningSource is the test source that also lists running tasks
+type runningSource struct {
+	testSource
+	tasks []complainer.Task
+}
+
+func (s *runningSource) Running() ([]complainer.Task, error) {
+	return s.tasks, nil
+}
+
+// resolveReporter records reported and resolved failures
+type resolveReporter struct {
+	testReporter
+	resolved []string
+}
+
+func (r *resolveReporter) Resolve(failure complainer.Failure, config reporter.ConfigProvider) error {
+	r.resolved = append(r.resolved, failure.ID)
+	return nil
+}
+
+func TestRecovery(t *testing.T) {
+	source := &runningSource{}
+	rep := &resolveReporter{}
+	plain := &testReporter{}
+
+	m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"resolve": rep, "plain": plain}, true, nil, nil, nil)
+	if err := m.UseRecovery(time.Minute, time.Hour, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	failures := []complainer.Failure{
+		{ID: "web.1", Name: "web", Framework: "marathon", Finished: now.Add(-time.Minute * 10)},
+		{ID: "web.2", Name: "web", Framework: "marathon", Finished: now.Add(-time.Minute * 5)},
+		{ID: "api.1", Name: "api", Framework: "marathon", Finished: now.Add(-time.Minute * 5)},
+		{ID: "old.1", Name: "old", Framework: "marathon", Finished: now.Add(-time.Hour * 2)},
+	}
+
+	for _, failure := range failures {
+		if err := m.processFailure(m.sources["test"], failure, func() {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(tasks []complainer.Task, expected []string) {
+		source.tasks = tasks
+		rep.resolved = nil
+
+		if err := m.checkRecovery("test"); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(rep.resolved, expected) {
+			t.Errorf("unexpected resolved failures: %v, expected %v", rep.resolved, expected)
+		}
+	}
+
+	// Tasks started before the last failure, tasks that have not been up
+	// for long enough and tasks of other frameworks are not replacements
+	check([]complainer.Task{
+		{ID: "web.0", Name: "web", Framework: "marathon", Started: now.Add(-time.Minute * 7)},
+		{ID: "api.2", Name: "api", Framework: "marathon", Started: now.Add(-time.Second * 10)},
+		{ID: "api.3", Name: "api", Framework: "other", Started: now.Add(-time.Minute * 4)},
+	}, nil)
+
+	// Apps are resolved once with the last failure
+	check([]complainer.Task{
+		{ID: "web.3", Name: "web", Framework: "marathon", Started: now.Add(-time.Minute * 4)},
+		{ID: "web.4", Name: "web", Framework: "marathon", Started: now.Add(-time.Minute * 3)},
+	}, []string{"web.2"})
+
+	check([]complainer.Task{
+		{ID: "web.3", Name: "web", Framework: "marathon", Started: now.Add(-time.Minute * 4)},
+	}, nil)
+
+	// Apps that did not recover in time are forgotten
+	check([]complainer.Task{
+		{ID: "old.2", Name: "old", Framework: "marathon", Started: now.Add(-time.Minute * 4)},
+	}, nil)
+
+	if _, ok := m.recovery.failed["test"]["marathon/old"]; ok {
+		t.Errorf("expected app that did not recover in time to be forgotten")
+	}
+
+	if _, ok := m.recovery.failed["test"]["marathon/api"]; !ok {
+		t.Errorf("expected app that did not recover yet to be tracked")
+	}
+}
+
+// downResolveReporter fails to report but could resolve
+type downResolveReporter struct {
+	downReporter
+	resolved []string
+}
+
+func (r *downResolveReporter) Resolve(failure complainer.Failure, config reporter.ConfigProvider) error {
+	r.resolved = append(r.resolved, failure.ID)
+	return nil
+}
+
+func TestRecoveryUndelivered(t *testing.T) {
+	source := &runningSource{}
+	rep := &resolveReporter{}
+	down := &downResolveReporter{}
+
+	m := NewMonitor("test", "1.0", []Source{source}, nil, map[string]reporter.Reporter{"resolve": rep, "down": down}, true, nil, nil, nil)
+	if err := m.UseRecovery(time.Minute, time.Hour, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Finished: now.Add(-time.Minute * 10)}
+	if err := m.processFailure(m.sources["test"], failure, func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	source.tasks = []complainer.Task{{ID: "web.2", Name: "web", Framework: "marathon", Started: now.Add(-time.Minute * 5)}}
+
+	if err := m.checkRecovery("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Instances that never got the failure are not told about recovery
+	if !reflect.DeepEqual(rep.resolved, []string{"web.1"}) || len(down.resolved) != 0 {
+		t.Errorf("unexpected resolved failures: %v and %v, expected only web.1 with the working reporter", rep.resolved, down.resolved)
+	}
+}
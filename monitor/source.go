@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"net/http"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/mesos"
+)
+
+// Source produces failures and provides urls of their logs
+type Source interface {
+	// Name identifies the source, it is used in health checks
+	Name() string
+	// Failures returns the list of known failures
+	Failures() ([]complainer.Failure, error)
+	// Logs returns stdout and stderr urls of the failure,
+	// empty urls mean that there is nothing to upload
+	Logs(failure complainer.Failure) (stdoutURL, stderrURL string, err error)
+	// Client returns http client that can download logs from the urls
+	Client() *http.Client
+}
+
+// StreamSource is implemented by sources that can send failures as they happen
+type StreamSource interface {
+	Source
+	Subscribe(failures chan<- complainer.Failure, subscribed func()) error
+}
+
+// MesosSource is implemented by sources of Mesos tasks, their failures are
+// filtered by task states and their logs can be located with the logs label
+type MesosSource interface {
+	Source
+	LocateLogs(failure complainer.Failure, locator mesos.LogLocator) (stdoutURL, stderrURL string, err error)
+}
+
+// RecoverySource is implemented by sources that can list running tasks,
+// apps with reported failures are resolved once replacement tasks keep running
+type RecoverySource interface {
+	Source
+	Running() ([]complainer.Task, error)
+}
+
+// ShardedSource is implemented by sources and detectors that skip failures
+// they returned before, sharded monitors tell them which failures are owned
+// here, so that failures of other shards are returned until shards move here
+type ShardedSource interface {
+	UseOwner(owns func(failure complainer.Failure) bool)
+}
+
+// Detector finds failures that are not tied to tasks,
+// they are reported without logs
+type Detector interface {
+	Failures() ([]complainer.Failure, error)
+}
+
+// detectorSource turns detector into a source without logs
+type detectorSource struct {
+	Detector
+	name string
+}
+
+func (d detectorSource) Name() string {
+	return d.name
+}
+
+func (d detectorSource) Logs(failure complainer.Failure) (string, string, error) {
+	return "", "", nil
+}
+
+func (d detectorSource) Client() *http.Client {
+	return http.DefaultClient
+}
+
+func (d detectorSource) UseOwner(owns func(failure complainer.Failure) bool) {
+	if sharded, ok := d.Detector.(ShardedSource); ok {
+		sharded.UseOwner(owns)
+	}
+}
@@ -9,36 +9,40 @@ import (
 
 func init() {
 	var (
-		file   *string
-		format *string
+		file     *string
+		format   *string
+		resolved *string
 	)
 
 	registerMaker("file", Maker{
 		RegisterFlags: func() {
 			file = flags.String("file.name", "FILE_NAME", "/dev/stderr", "file to log failures")
 			format = flags.String("file.format", "FILE_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}:{{ .nl }}  * {{ .stdoutURL }}{{ .nl }}  * {{ .stderrURL }}{{ .nl }}", "log format")
+			resolved = flags.String("file.resolved_format", "FILE_RESOLVED_FORMAT", "Task {{ .failure.Name }} recovered after dying with status {{ .failure.State }}{{ .nl }}", "format of messages about recovered tasks")
 		},
 
 		Make: func() (Reporter, error) {
-			return newFileReporter(*file, *format)
+			return newFileReporter(*file, *format, *resolved)
 		},
 	})
 }
 
 type fileReporter struct {
-	file   *os.File
-	format string
+	file     *os.File
+	format   string
+	resolved string
 }
 
-func newFileReporter(file, format string) (*fileReporter, error) {
+func newFileReporter(file, format, resolved string) (*fileReporter, error) {
 	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
 		return nil, err
 	}
 
 	return &fileReporter{
-		file:   f,
-		format: format,
+		file:     f,
+		format:   format,
+		resolved: resolved,
 	}, nil
 }
 
@@ -51,3 +55,31 @@ func (f *fileReporter) Report(failure complainer.Failure, config ConfigProvider,
 	_, err = f.file.WriteString(s)
 	return err
 }
+
+// Render returns the text that is written to the file
+func (f *fileReporter) Render(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillTemplate(failure, config, stdoutURL, stderrURL, f.format)
+}
+
+// ReportRendered writes the text rendered earlier to the file
+func (f *fileReporter) ReportRendered(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string, payload string) error {
+	_, err := f.file.WriteString(payload)
+	return err
+}
+
+// Digest writes the digest to the file
+func (f *fileReporter) Digest(digest complainer.Digest, config ConfigProvider) error {
+	_, err := f.file.WriteString(digest.String() + "\n")
+	return err
+}
+
+// Resolve writes the message about the recovered task to the file
+func (f *fileReporter) Resolve(failure complainer.Failure, config ConfigProvider) error {
+	s, err := fillTemplate(failure, config, "", "", f.resolved)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.file.WriteString(s)
+	return err
+}
@@ -2,7 +2,9 @@ package reporter
 
 import (
 	"errors"
+	"html"
 	"net/url"
+	"sync"
 
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
@@ -11,10 +13,11 @@ import (
 
 func init() {
 	var (
-		baseURL *string
-		token   *string
-		room    *string
-		format  *string
+		baseURL  *string
+		token    *string
+		room     *string
+		format   *string
+		resolved *string
 	)
 
 	registerMaker("hipchat", Maker{
@@ -23,10 +26,11 @@ func init() {
 			token = flags.String("hipchat.token", "HIPCHAT_TOKEN", "", "default hipchat token")
 			room = flags.String("hipchat.room", "HIPCHAT_ROOM", "", "default hipchat room")
 			format = flags.String("hipchat.format", "HIPCHAT_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }} [<a href=\"{{ .stdoutURL }}\">stdout</a>, <a href=\"{{ .stderrURL }}\">stderr</a>]", "log format")
+			resolved = flags.String("hipchat.resolved_format", "HIPCHAT_RESOLVED_FORMAT", "Task {{ .failure.Name }} recovered after dying with status {{ .failure.State }}", "format of messages about recovered tasks")
 		},
 
 		Make: func() (Reporter, error) {
-			return newHipchatReporter(*baseURL, *token, *room, *format), nil
+			return newHipchatReporter(*baseURL, *token, *room, *format, *resolved), nil
 		},
 	})
 }
@@ -36,17 +40,20 @@ type hipchatReporter struct {
 	room     string
 	clients  map[hipchatClientIdentity]*hipchat.Client
 	format   string
+	resolved string
+	mu       sync.Mutex
 }
 
-func newHipchatReporter(baseURL, token, room, format string) *hipchatReporter {
+func newHipchatReporter(baseURL, token, room, format, resolved string) *hipchatReporter {
 	return &hipchatReporter{
 		identity: hipchatClientIdentity{
 			baseURL: baseURL,
 			token:   token,
 		},
-		room:    room,
-		clients: map[hipchatClientIdentity]*hipchat.Client{},
-		format:  format,
+		room:     room,
+		clients:  map[hipchatClientIdentity]*hipchat.Client{},
+		format:   format,
+		resolved: resolved,
 	}
 }
 
@@ -60,11 +67,15 @@ func (h *hipchatReporter) client(baseURL, token string) (*hipchat.Client, error)
 		token:   token,
 	}
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	if client, ok := h.clients[identity]; ok {
 		return client, nil
 	}
 
 	client := hipchat.NewClient(token)
+	client.SetHTTPClient(httpClient())
 	parsedURL, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, err
@@ -78,6 +89,30 @@ func (h *hipchatReporter) client(baseURL, token string) (*hipchat.Client, error)
 }
 
 func (h *hipchatReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	message, err := fillTemplate(failure, config, stdoutURL, stderrURL, h.format)
+	if err != nil {
+		return err
+	}
+
+	return h.notify(config, message, hipchat.ColorRed)
+}
+
+// Digest sends the digest to the room
+func (h *hipchatReporter) Digest(digest complainer.Digest, config ConfigProvider) error {
+	return h.notify(config, html.EscapeString(digest.String()), hipchat.ColorYellow)
+}
+
+// Resolve sends the message about the recovered task to the room
+func (h *hipchatReporter) Resolve(failure complainer.Failure, config ConfigProvider) error {
+	message, err := fillTemplate(failure, config, "", "", h.resolved)
+	if err != nil {
+		return err
+	}
+
+	return h.notify(config, message, hipchat.ColorGreen)
+}
+
+func (h *hipchatReporter) notify(config ConfigProvider, message string, color hipchat.Color) error {
 	baseURL := config("base_url")
 	if baseURL == "" {
 		baseURL = h.identity.baseURL
@@ -102,27 +137,28 @@ func (h *hipchatReporter) Report(failure complainer.Failure, config ConfigProvid
 		return err
 	}
 
-	message, err := fillTemplate(failure, config, stdoutURL, stderrURL, h.format)
-	if err != nil {
-		return err
-	}
-
 	resp, err := client.Room.Notification(room, &hipchat.NotificationRequest{
 		MessageFormat: "html",
-		Color:         "red",
+		Color:         color,
 		Notify:        true,
 		Message:       message,
 	})
 
-	if err != nil {
-		defer func() {
-			if resp != nil {
-				_ = resp.Body.Close()
-			}
-		}()
+	if resp != nil {
+		_ = resp.Body.Close()
 	}
 
-	return err
+	return retryAfterError(resp, err)
+}
+
+// Render returns the html message that is sent to the room
+func (h *hipchatReporter) Render(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillTemplate(failure, config, stdoutURL, stderrURL, h.format)
+}
+
+// ReportRendered sends the html message rendered earlier to the room
+func (h *hipchatReporter) ReportRendered(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string, payload string) error {
+	return h.notify(config, payload, hipchat.ColorRed)
 }
 
 type hipchatClientIdentity struct {
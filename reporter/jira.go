@@ -1,9 +1,14 @@
 package reporter
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"strings"
+	"sync"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira"
 	"github.com/cloudflare/complainer"
@@ -17,6 +22,31 @@ type jiraReporter struct {
 	metaIssuetype    *jira.MetaIssueType
 	fieldsConfig     map[string]string
 	closedStatusName string
+	resolvedComment  string
+	comment          string
+	reopenWindow     time.Duration
+	reopenTransition string
+	occurrencesField string
+
+	mu    sync.Mutex
+	locks map[string]*jiraLock
+}
+
+// jiraLock serializes reports of the same issue, users counts reports
+// holding or waiting for the lock
+type jiraLock struct {
+	sync.Mutex
+	users int
+}
+
+// jiraOptions configures how repeated failures update existing issues
+type jiraOptions struct {
+	closedStatus     string
+	resolvedComment  string
+	comment          string
+	reopenWindow     time.Duration
+	reopenTransition string
+	occurrencesField string
 }
 
 func init() {
@@ -26,6 +56,11 @@ func init() {
 		password            *string
 		fieldsConfiguration *string
 		closedStatus        *string
+		resolvedComment     *string
+		comment             *string
+		reopenWindow        *time.Duration
+		reopenTransition    *string
+		occurrencesField    *string
 	)
 
 	registerMaker("jira", Maker{
@@ -35,21 +70,37 @@ func init() {
 			password = flags.String("jira.password", "JIRA_PASSWORD", "", "JIRA password for the user to authenticate")
 			fieldsConfiguration = flags.String("jira.fields", "JIRA_FIELDS", "Project:COMPLAINER;Issue Type:Bug;Summary:Task {{ .failure.Name }} died with status {{ .failure.State }};Description:[stdout|{{ .stdoutURL }}], [stderr|{{ .stderrURL }}], ID={{ .failure.ID }}", "JIRA fields in 'key:value;...' format seperated by ';', this configuration MUST contain 'Project', 'Summary' and 'Issue Type'")
 			closedStatus = flags.String("jira.issue_closed_status", "JIRA_ISSUE_CLOSED_STATUS", "Closed", "The status of JIRA issue when it is considered closed")
+			resolvedComment = flags.String("jira.resolved_comment", "JIRA_RESOLVED_COMMENT", "Task {{ .failure.Name }} recovered after dying with status {{ .failure.State }}", "Comment to add to the open JIRA issue when the task recovers, empty disables comments")
+			comment = flags.String("jira.comment", "JIRA_COMMENT", "Task {{ .failure.ID }} died again with status {{ .failure.State }} on {{ .failure.Slave }}: [stdout|{{ .stdoutURL }}], [stderr|{{ .stderrURL }}]", "Comment to add to the existing JIRA issue when the task fails again, empty disables comments")
+			reopenWindow = flags.Duration("jira.reopen_window", "JIRA_REOPEN_WINDOW", 0, "Reopen JIRA issues closed within this time instead of creating new ones, zero disables reopening")
+			reopenTransition = flags.String("jira.reopen_transition", "JIRA_REOPEN_TRANSITION", "Reopen Issue", "Name of the JIRA transition that reopens closed issues")
+			occurrencesField = flags.String("jira.occurrences_field", "JIRA_OCCURRENCES_FIELD", "", "Name of the numeric JIRA field to count failures in, empty disables counting")
 		},
 
 		Make: func() (Reporter, error) {
-			return newJiraReporter(*jiraURL, *username, *password, *fieldsConfiguration, *closedStatus)
+			return newJiraReporter(*jiraURL, *username, *password, *fieldsConfiguration, jiraOptions{
+				closedStatus:     *closedStatus,
+				resolvedComment:  *resolvedComment,
+				comment:          *comment,
+				reopenWindow:     *reopenWindow,
+				reopenTransition: *reopenTransition,
+				occurrencesField: *occurrencesField,
+			})
 		},
 	})
 }
 
-func newJiraReporter(jiraURL, username, password, fieldsConfiguration, closedStatus string) (*jiraReporter, error) {
-	err := checkArgsNotNil(jiraURL, username, password, fieldsConfiguration, closedStatus)
+func newJiraReporter(jiraURL, username, password, fieldsConfiguration string, options jiraOptions) (*jiraReporter, error) {
+	err := checkArgsNotNil(jiraURL, username, password, fieldsConfiguration, options.closedStatus)
 	if err != nil {
 		return nil, err
 	}
 
-	reporter := new(jiraReporter)
+	if options.reopenWindow < 0 || options.reopenWindow > 0 && options.reopenWindow < time.Minute {
+		return nil, fmt.Errorf("reopen window %s is too short: zero or at least a minute expected", options.reopenWindow)
+	}
+
+	reporter := &jiraReporter{locks: map[string]*jiraLock{}}
 	client, err := createJiraClient(jiraURL, username, password)
 	if err != nil {
 		return nil, err
@@ -72,7 +123,11 @@ func newJiraReporter(jiraURL, username, password, fieldsConfiguration, closedSta
 		return nil, fmt.Errorf("issue type is required in field configuration")
 	}
 
-	reporter.closedStatusName = closedStatus
+	reporter.closedStatusName = options.closedStatus
+	reporter.resolvedComment = options.resolvedComment
+	reporter.comment = options.comment
+	reporter.reopenWindow = options.reopenWindow
+	reporter.reopenTransition = options.reopenTransition
 
 	// get create meta information
 	metaProject, err := createMetaProject(client, project)
@@ -95,31 +150,72 @@ func newJiraReporter(jiraURL, username, password, fieldsConfiguration, closedSta
 	}
 
 	reporter.metaIssuetype = metaIssuetype
+
+	if options.occurrencesField != "" {
+		all, err := metaIssuetype.GetAllFields()
+		if err != nil {
+			return nil, err
+		}
+
+		key, found := all[options.occurrencesField]
+		if !found {
+			return nil, fmt.Errorf("could not find occurrences field %s", options.occurrencesField)
+		}
+
+		reporter.occurrencesField = key
+	}
+
 	return reporter, nil
 }
 
 func (j *jiraReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error {
-	renderedFields := make(map[string]string)
-	// render all values as they can be tempaltes
-	for field, templatedValue := range j.fieldsConfig {
-		rendered, err := fillTemplate(failure, config, stdoutURL, stderrURL, templatedValue)
-		if err != nil {
-			return fmt.Errorf("rendering value of %s as tempalte failed: %s", field, err)
-		}
-		renderedFields[field] = rendered
+	renderedFields, err := j.renderFields(failure, config, stdoutURL, stderrURL)
+	if err != nil {
+		return err
 	}
 
-	// generate jql with exact match for summary, project and status
-	query := fmt.Sprintf(`summary ~ "\"%s\"" AND project = %s AND status != %s`, renderedFields["Summary"], renderedFields["Project"], j.closedStatusName)
-	results, resp, err := j.client.Issue.Search(query, nil)
+	return j.report(renderedFields, failure, config, stdoutURL, stderrURL)
+}
+
+// ReportRendered reports the issue with fields rendered earlier,
+// comments on existing issues are rendered again
+func (j *jiraReporter) ReportRendered(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL, payload string) error {
+	renderedFields := map[string]string{}
+	if err := json.Unmarshal([]byte(payload), &renderedFields); err != nil {
+		return fmt.Errorf("cannot decode rendered fields: %s", err)
+	}
+
+	return j.report(renderedFields, failure, config, stdoutURL, stderrURL)
+}
+
+// report creates the issue with the fields or updates the existing one
+func (j *jiraReporter) report(renderedFields map[string]string, failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error {
+	defer j.lock(renderedFields["Project"] + "/" + renderedFields["Summary"])()
+
+	results, err := j.openIssues(renderedFields)
 	if err != nil {
-		return fmt.Errorf(readJiraReponse(resp))
+		return err
 	}
 
 	if len(results) != 0 {
 		// there were issues not closed.
 		// Don't create a new one
-		return nil
+		return j.recur(results[0], failure, config, stdoutURL, stderrURL)
+	}
+
+	if j.reopenWindow > 0 {
+		closed, err := j.recentlyClosedIssues(renderedFields)
+		if err != nil {
+			return err
+		}
+
+		if len(closed) != 0 {
+			if err := j.reopen(closed[0]); err != nil {
+				return err
+			}
+
+			return j.recur(closed[0], failure, config, stdoutURL, stderrURL)
+		}
 	}
 
 	issue, err := jira.InitIssueWithMetaAndFields(j.metaProject, j.metaIssuetype, renderedFields)
@@ -127,14 +223,211 @@ func (j *jiraReporter) Report(failure complainer.Failure, config ConfigProvider,
 		return fmt.Errorf("could not initialize issue: %s", err)
 	}
 
-	_, resp, err = j.client.Issue.Create(issue)
+	if j.occurrencesField != "" {
+		issue.Fields.Unknowns[j.occurrencesField] = 1
+	}
+
+	_, resp, err := j.client.Issue.Create(issue)
 	if err != nil {
-		return fmt.Errorf(readJiraReponse(resp))
+		return jiraError(resp)
 	}
 
 	return nil
 }
 
+// lock waits for other reports of the issue with the key to finish,
+// the returned function releases the lock
+func (j *jiraReporter) lock(key string) func() {
+	j.mu.Lock()
+	l, ok := j.locks[key]
+	if !ok {
+		l = new(jiraLock)
+		j.locks[key] = l
+	}
+	l.users++
+	j.mu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		j.mu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(j.locks, key)
+		}
+		j.mu.Unlock()
+	}
+}
+
+// Resolve comments on the open issue of the recovered task
+func (j *jiraReporter) Resolve(failure complainer.Failure, config ConfigProvider) error {
+	if j.resolvedComment == "" {
+		return nil
+	}
+
+	renderedFields, err := j.renderFields(failure, config, "", "")
+	if err != nil {
+		return err
+	}
+
+	defer j.lock(renderedFields["Project"] + "/" + renderedFields["Summary"])()
+
+	results, err := j.openIssues(renderedFields)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		return nil
+	}
+
+	comment, err := fillTemplate(failure, config, "", "", j.resolvedComment)
+	if err != nil {
+		return fmt.Errorf("rendering resolved comment as template failed: %s", err)
+	}
+
+	_, resp, err := j.client.Issue.AddComment(results[0].Key, &jira.Comment{Body: comment})
+	if err != nil {
+		return jiraError(resp)
+	}
+
+	return nil
+}
+
+// recur comments on the existing issue about the repeated failure
+// and counts it in the occurrences field, the count is read again
+// as search results may lag behind updates
+func (j *jiraReporter) recur(issue jira.Issue, failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error {
+	if j.comment != "" {
+		comment, err := fillTemplate(failure, config, stdoutURL, stderrURL, j.comment)
+		if err != nil {
+			return fmt.Errorf("rendering comment as template failed: %s", err)
+		}
+
+		_, resp, err := j.client.Issue.AddComment(issue.Key, &jira.Comment{Body: comment})
+		if err != nil {
+			return jiraError(resp)
+		}
+	}
+
+	if j.occurrencesField == "" {
+		return nil
+	}
+
+	current, resp, err := j.client.Issue.Get(issue.Key)
+	if err != nil {
+		return jiraError(resp)
+	}
+
+	return j.updateFields(issue.Key, map[string]interface{}{
+		j.occurrencesField: occurrences(*current, j.occurrencesField) + 1,
+	})
+}
+
+// reopen transitions the closed issue back to open
+func (j *jiraReporter) reopen(issue jira.Issue) error {
+	transitions, resp, err := j.client.Issue.GetTransitions(issue.Key)
+	if err != nil {
+		return jiraError(resp)
+	}
+
+	for _, transition := range transitions {
+		if transition.Name != j.reopenTransition {
+			continue
+		}
+
+		if _, err := j.client.Issue.DoTransition(issue.Key, transition.ID); err != nil {
+			return fmt.Errorf("could not reopen issue %s: %s", issue.Key, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("could not find transition %s for issue %s", j.reopenTransition, issue.Key)
+}
+
+// updateFields sets fields of the issue by their keys
+func (j *jiraReporter) updateFields(key string, fields map[string]interface{}) error {
+	req, err := j.client.NewRequest("PUT", "rest/api/2/issue/"+key, map[string]interface{}{"fields": fields})
+	if err != nil {
+		return fmt.Errorf("could not create update request: %s", err)
+	}
+
+	resp, err := j.client.Do(req, nil)
+	if err != nil {
+		return jiraError(resp)
+	}
+
+	return nil
+}
+
+// occurrences returns the count kept in the field of the issue, issues
+// created before counting was enabled are counted as one failure
+func occurrences(issue jira.Issue, field string) int {
+	if issue.Fields == nil {
+		return 1
+	}
+
+	count, ok := issue.Fields.Unknowns[field].(float64)
+	if !ok || count < 1 {
+		return 1
+	}
+
+	return int(count)
+}
+
+// openIssues returns issues that are not closed with the summary
+func (j *jiraReporter) openIssues(renderedFields map[string]string) ([]jira.Issue, error) {
+	// generate jql with exact match for summary, project and status
+	query := fmt.Sprintf(`summary ~ "\"%s\"" AND project = %s AND status != %s`, renderedFields["Summary"], renderedFields["Project"], j.closedStatusName)
+	return j.search(query)
+}
+
+// recentlyClosedIssues returns issues with the summary that were closed
+// within the reopen window, most recently updated first
+func (j *jiraReporter) recentlyClosedIssues(renderedFields map[string]string) ([]jira.Issue, error) {
+	// jql takes whole minutes, partial ones are rounded up
+	minutes := int(math.Ceil(j.reopenWindow.Minutes()))
+	query := fmt.Sprintf(`summary ~ "\"%s\"" AND project = %s AND status = %s AND status CHANGED TO %s AFTER "-%dm" ORDER BY updated DESC`, renderedFields["Summary"], renderedFields["Project"], j.closedStatusName, j.closedStatusName, minutes)
+	return j.search(query)
+}
+
+func (j *jiraReporter) search(query string) ([]jira.Issue, error) {
+	results, resp, err := j.client.Issue.Search(query, nil)
+	if err != nil {
+		return nil, jiraError(resp)
+	}
+
+	return results, nil
+}
+
+// Render returns json with fields of the issue
+func (j *jiraReporter) Render(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) (string, error) {
+	renderedFields, err := j.renderFields(failure, config, stdoutURL, stderrURL)
+	if err != nil {
+		return "", err
+	}
+
+	rendered, err := json.Marshal(renderedFields)
+	return string(rendered), err
+}
+
+func (j *jiraReporter) renderFields(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) (map[string]string, error) {
+	renderedFields := make(map[string]string)
+	// render all values as they can be tempaltes
+	for field, templatedValue := range j.fieldsConfig {
+		rendered, err := fillTemplate(failure, config, stdoutURL, stderrURL, templatedValue)
+		if err != nil {
+			return nil, fmt.Errorf("rendering value of %s as tempalte failed: %s", field, err)
+		}
+		renderedFields[field] = rendered
+	}
+
+	return renderedFields, nil
+}
+
 // setFieldsConfig gets the fields string in format key:value;key2:value;...
 // Seperate them and create a map.
 func (j *jiraReporter) setFieldsConfig(fieldsConfiguration string) error {
@@ -168,6 +461,17 @@ func checkArgsNotNil(args ...string) error {
 	return nil
 }
 
+// jiraError returns the error with details from the response,
+// jira asks to retry later with status 429
+func jiraError(resp *jira.Response) error {
+	err := errors.New(readJiraReponse(resp))
+	if resp == nil {
+		return err
+	}
+
+	return retryAfterError(resp.Response, err)
+}
+
 func readJiraReponse(resp *jira.Response) string {
 	if resp == nil || resp.Body == nil {
 		return fmt.Sprintf("nil response or response body")
@@ -182,11 +486,11 @@ func readJiraReponse(resp *jira.Response) string {
 		return fmt.Sprintf("could not read response body. %s", err)
 	}
 
-	return fmt.Sprintf("could not create issue. Detailed information: %s", string(rawBody))
+	return fmt.Sprintf("jira request failed. Detailed information: %s", string(rawBody))
 }
 
 func createJiraClient(url, username, password string) (*jira.Client, error) {
-	jiraClient, err := jira.NewClient(nil, url)
+	jiraClient, err := jira.NewClient(httpClient(), url)
 	if err != nil {
 		return nil, fmt.Errorf("could not create client: %s", err)
 	}
@@ -0,0 +1,367 @@
+package reporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const jiraCreateMeta = `{"projects": [{
+	"id": "1",
+	"key": "C",
+	"name": "Complainer",
+	"issuetypes": [{
+		"id": "1",
+		"name": "Bug",
+		"fields": {
+			"project": {"required": true, "name": "Project", "schema": {"type": "project"}},
+			"issuetype": {"required": true, "name": "Issue Type", "schema": {"type": "issuetype"}},
+			"summary": {"required": true, "name": "Summary", "schema": {"type": "string"}},
+			"customfield_10000": {"required": false, "name": "Occurrences", "schema": {"type": "number"}}
+		}
+	}]
+}]}`
+
+// fakeJiraIssue is an issue of the fake jira, closed is how long ago
+// the issue was closed, zero for open issues
+type fakeJiraIssue struct {
+	key         string
+	closed      time.Duration
+	occurrences int
+	comments    int
+	reopened    bool
+}
+
+// fakeJira implements just enough of jira api for the reporter
+type fakeJira struct {
+	mu     sync.Mutex
+	issues []*fakeJiraIssue
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/rest/auth/1/session":
+		_, _ = w.Write([]byte(`{"session": {"name": "JSESSIONID", "value": "session"}}`))
+	case r.URL.Path == "/rest/api/2/issue/createmeta":
+		_, _ = w.Write([]byte(jiraCreateMeta))
+	case r.URL.Path == "/rest/api/2/search":
+		f.search(w, r.URL.Query().Get("jql"))
+	case r.URL.Path == "/rest/api/2/issue/" && r.Method == "POST":
+		f.create(w, r)
+	case strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/"), "/")
+		issue := f.issue(parts[0])
+		if issue == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		f.update(w, r, issue, parts[1:])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeJira) search(w http.ResponseWriter, jql string) {
+	found := []*fakeJiraIssue{}
+
+	for _, issue := range f.issues {
+		switch {
+		case strings.Contains(jql, "status != Closed"):
+			if issue.closed == 0 {
+				found = append(found, issue)
+			}
+		case strings.Contains(jql, "status = Closed"):
+			minutes := 0
+			if _, err := fmt.Sscanf(jql[strings.Index(jql, "AFTER")+1:], `FTER "-%dm"`, &minutes); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if issue.closed != 0 && issue.closed <= time.Duration(minutes)*time.Minute {
+				found = append(found, issue)
+			}
+		}
+	}
+
+	results := []map[string]interface{}{}
+	for _, issue := range found {
+		results = append(results, issue.json())
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"issues": results})
+}
+
+func (f *fakeJira) create(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Fields map[string]interface{} `json:"fields"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	count, _ := body.Fields["customfield_10000"].(float64)
+
+	issue := &fakeJiraIssue{key: fmt.Sprintf("C-%d", len(f.issues)+1), occurrences: int(count)}
+	f.issues = append(f.issues, issue)
+
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(fmt.Sprintf(`{"key": %q}`, issue.key)))
+}
+
+func (f *fakeJira) update(w http.ResponseWriter, r *http.Request, issue *fakeJiraIssue, path []string) {
+	switch {
+	case len(path) == 0 && r.Method == "GET":
+		_ = json.NewEncoder(w).Encode(issue.json())
+	case len(path) == 0 && r.Method == "PUT":
+		body := struct {
+			Fields map[string]int `json:"fields"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		issue.occurrences = body.Fields["customfield_10000"]
+		w.WriteHeader(http.StatusNoContent)
+	case path[0] == "comment":
+		issue.comments++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	case path[0] == "transitions" && r.Method == "GET":
+		_, _ = w.Write([]byte(`{"transitions": [{"id": "3", "name": "Reopen Issue"}]}`))
+	case path[0] == "transitions":
+		issue.closed = 0
+		issue.reopened = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeJira) issue(key string) *fakeJiraIssue {
+	for _, issue := range f.issues {
+		if issue.key == key {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+func (i *fakeJiraIssue) json() map[string]interface{} {
+	fields := map[string]interface{}{}
+	if i.occurrences != 0 {
+		fields["customfield_10000"] = i.occurrences
+	}
+
+	return map[string]interface{}{
+		"key":    i.key,
+		"fields": fields,
+	}
+}
+
+func newTestJiraReporter(t *testing.T, url string, reopenWindow time.Duration) *jiraReporter {
+	reporter, err := newJiraReporter(url, "complainer", "hunter2", "Project:C;Issue Type:Bug;Summary:Task {{ .failure.Name }} died", jiraOptions{
+		closedStatus:     "Closed",
+		resolvedComment:  "Task {{ .failure.Name }} recovered",
+		comment:          "Task {{ .failure.ID }} died again",
+		reopenWindow:     reopenWindow,
+		reopenTransition: "Reopen Issue",
+		occurrencesField: "Occurrences",
+	})
+	if err != nil {
+		t.Fatalf("Error creating reporter: %s", err)
+	}
+
+	return reporter
+}
+
+func TestJiraReport(t *testing.T) {
+	table := []struct {
+		name     string
+		window   time.Duration
+		issues   []fakeJiraIssue
+		expected []fakeJiraIssue
+	}{
+		{
+			name:     "new issue",
+			expected: []fakeJiraIssue{{key: "C-1", occurrences: 1}},
+		},
+		{
+			name:     "comment on open issue",
+			issues:   []fakeJiraIssue{{key: "C-1", occurrences: 2}},
+			expected: []fakeJiraIssue{{key: "C-1", occurrences: 3, comments: 1}},
+		},
+		{
+			name:     "count on issue created before counting",
+			issues:   []fakeJiraIssue{{key: "C-1"}},
+			expected: []fakeJiraIssue{{key: "C-1", occurrences: 2, comments: 1}},
+		},
+		{
+			name:     "reopen within window",
+			window:   time.Hour,
+			issues:   []fakeJiraIssue{{key: "C-1", closed: time.Minute * 30, occurrences: 1}},
+			expected: []fakeJiraIssue{{key: "C-1", occurrences: 2, comments: 1, reopened: true}},
+		},
+		{
+			name:     "reopen within partial minute",
+			window:   time.Second * 90,
+			issues:   []fakeJiraIssue{{key: "C-1", closed: time.Minute * 2, occurrences: 1}},
+			expected: []fakeJiraIssue{{key: "C-1", occurrences: 2, comments: 1, reopened: true}},
+		},
+		{
+			name:   "new issue outside window",
+			window: time.Hour,
+			issues: []fakeJiraIssue{{key: "C-1", closed: time.Hour * 2, occurrences: 1}},
+			expected: []fakeJiraIssue{
+				{key: "C-1", closed: time.Hour * 2, occurrences: 1},
+				{key: "C-2", occurrences: 1},
+			},
+		},
+		{
+			name:   "new issue without reopening",
+			issues: []fakeJiraIssue{{key: "C-1", closed: time.Minute, occurrences: 1}},
+			expected: []fakeJiraIssue{
+				{key: "C-1", closed: time.Minute, occurrences: 1},
+				{key: "C-2", occurrences: 1},
+			},
+		},
+	}
+
+	for _, tt := range table {
+		fake := &fakeJira{}
+		for i := range tt.issues {
+			fake.issues = append(fake.issues, &tt.issues[i])
+		}
+
+		server := httptest.NewServer(fake)
+
+		reporter := newTestJiraReporter(t, server.URL, tt.window)
+
+		err := reporter.Report(complainer.Failure{ID: "web.1", Name: "web"}, func(string) string { return "" }, "", "")
+		if err != nil {
+			t.Errorf("Error reporting for %s: %s", tt.name, err)
+		}
+
+		server.Close()
+
+		if len(fake.issues) != len(tt.expected) {
+			t.Errorf("Unexpected issues for %s: %d, expected %d", tt.name, len(fake.issues), len(tt.expected))
+			continue
+		}
+
+		for i, issue := range fake.issues {
+			if *issue != tt.expected[i] {
+				t.Errorf("Unexpected issue for %s: %#v, expected %#v", tt.name, *issue, tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestJiraReportConcurrent(t *testing.T) {
+	fake := &fakeJira{issues: []*fakeJiraIssue{{key: "C-1", occurrences: 1}}}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	reporter := newTestJiraReporter(t, server.URL, 0)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			err := reporter.Report(complainer.Failure{ID: fmt.Sprintf("web.%d", i), Name: "web"}, func(string) string { return "" }, "", "")
+			if err != nil {
+				t.Errorf("Error reporting: %s", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.issues[0].occurrences != 11 || fake.issues[0].comments != 10 {
+		t.Errorf("Unexpected issue: %#v, expected 11 occurrences and 10 comments", *fake.issues[0])
+	}
+
+	if len(reporter.locks) != 0 {
+		t.Errorf("Unexpected locks left: %d", len(reporter.locks))
+	}
+}
+
+func TestJiraResolveConcurrent(t *testing.T) {
+	fake := &fakeJira{}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	reporter := newTestJiraReporter(t, server.URL, 0)
+
+	failure := complainer.Failure{ID: "web.1", Name: "web"}
+
+	if err := reporter.Report(failure, func(string) string { return "" }, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reports and resolutions of the same issue are serialized
+	l := reporter.lock("C/Task web died")
+
+	done := make(chan error)
+	go func() {
+		done <- reporter.Resolve(failure, func(string) string { return "" })
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Resolve finished while the issue was locked: %v", err)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	l()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.issues[0].comments != 1 {
+		t.Errorf("Unexpected issue: %#v, expected 1 comment", *fake.issues[0])
+	}
+
+	if len(reporter.locks) != 0 {
+		t.Errorf("Unexpected locks left: %d", len(reporter.locks))
+	}
+}
+
+func TestJiraReopenWindow(t *testing.T) {
+	for _, window := range []time.Duration{-time.Minute, time.Second, time.Second * 59} {
+		_, err := newJiraReporter("http://jira.example.com", "complainer", "hunter2", "Project:C", jiraOptions{
+			closedStatus: "Closed",
+			reopenWindow: window,
+		})
+
+		if err == nil {
+			t.Errorf("Expected error for reopen window %s", window)
+		}
+	}
+}
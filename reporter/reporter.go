@@ -2,12 +2,18 @@ package reporter
 
 import (
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
 )
 
 var makers = map[string]Maker{}
 
+// requestTimeout limits every request of reporters, zero means no limit
+var requestTimeout = new(time.Duration)
+
 // Maker is responsible for making reporter and registering its flags
 type Maker struct {
 	RegisterFlags func()
@@ -16,6 +22,8 @@ type Maker struct {
 
 // RegisterFlags registers flags for all registered makers
 func RegisterFlags() {
+	requestTimeout = flags.Duration("reporter.timeout", "REPORTER_TIMEOUT", time.Minute, "timeout of every request to reporting services")
+
 	for _, rm := range makers {
 		rm.RegisterFlags()
 	}
@@ -34,7 +42,33 @@ func MakerByName(name string) (Maker, error) {
 	return Maker{}, fmt.Errorf("unknown reporter maker: %q", name)
 }
 
+// httpClient returns the client for requests of reporters, requests
+// that take longer than the timeout are cancelled
+func httpClient() *http.Client {
+	return &http.Client{Timeout: *requestTimeout}
+}
+
 // Reporter is responsible for reporting failures to external systems
 type Reporter interface {
 	Report(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error
 }
+
+// Renderer is implemented by reporters that can render what they send for
+// the failure, payloads are kept with notifications that were not delivered
+// and sent as they are once the notifications are replayed
+type Renderer interface {
+	Render(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) (string, error)
+	ReportRendered(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL, payload string) error
+}
+
+// Digester is implemented by reporters that can send digests of failures
+// that were not reported because of rate limits
+type Digester interface {
+	Digest(digest complainer.Digest, config ConfigProvider) error
+}
+
+// Resolver is implemented by reporters that can tell that the app of the
+// reported failure is healthy again, the failure is the last one reported
+type Resolver interface {
+	Resolve(failure complainer.Failure, config ConfigProvider) error
+}
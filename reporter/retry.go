@@ -0,0 +1,116 @@
+package reporter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter caps delays requested by the remote side, so that
+// one response cannot hold notifications back for long
+const maxRetryAfter = time.Minute * 5
+
+// RetryAfterError is returned by reporters when the remote side asks
+// to slow down, the call should be retried after the delay
+type RetryAfterError struct {
+	After time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err, e.After)
+}
+
+// RetryAfter returns the delay requested by the remote side if the error
+// is a RetryAfterError
+func RetryAfter(err error) (time.Duration, bool) {
+	retryErr, ok := err.(*RetryAfterError)
+	if !ok {
+		return 0, false
+	}
+
+	return retryErr.After, true
+}
+
+// retryAfterError returns RetryAfterError for responses with status 429,
+// err is returned for other responses
+func retryAfterError(resp *http.Response, err error) error {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return err
+	}
+
+	if err == nil {
+		err = fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return &RetryAfterError{
+		After: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Err:   err,
+	}
+}
+
+// parseRetryAfter parses Retry-After header in seconds or as a date,
+// zero is returned if the header is missing or invalid
+func parseRetryAfter(header string) time.Duration {
+	after := time.Duration(0)
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		after = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		after = date.Sub(time.Now())
+	}
+
+	if after < 0 {
+		return 0
+	}
+
+	if after > maxRetryAfter {
+		return maxRetryAfter
+	}
+
+	return after
+}
+
+// retryAfterTransport turns responses with status 429 into RetryAfterError
+// for clients that do not expose responses to reporters
+type retryAfterTransport struct {
+	next http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	return nil, checkResponse(resp)
+}
+
+// unwrapRetryAfter returns RetryAfterError wrapped by http client
+func unwrapRetryAfter(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		if retryErr, ok := urlErr.Err.(*RetryAfterError); ok {
+			return retryErr
+		}
+	}
+
+	return err
+}
+
+// checkResponse closes the response and returns error for unsuccessful ones
+func checkResponse(resp *http.Response) error {
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	return retryAfterError(resp, fmt.Errorf("unexpected response status: %s", resp.Status))
+}
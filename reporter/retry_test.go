@@ -0,0 +1,49 @@
+package reporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	table := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{header: "", expected: 0},
+		{header: "nope", expected: 0},
+		{header: "-5", expected: 0},
+		{header: "30", expected: time.Second * 30},
+		{header: "86400", expected: maxRetryAfter},
+		{header: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), expected: 0},
+		{header: time.Now().Add(time.Hour * 24).UTC().Format(http.TimeFormat), expected: maxRetryAfter},
+	}
+
+	for _, tt := range table {
+		if after := parseRetryAfter(tt.header); after != tt.expected {
+			t.Errorf("Unexpected delay for %q: %s, expected %s", tt.header, after, tt.expected)
+		}
+	}
+}
+
+func TestSentryRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://public:secret@", 1) + "/1"
+
+	err := newSentryReporter(dsn).Report(complainer.Failure{ID: "web.1", Name: "web"}, func(string) string { return "" }, "", "")
+
+	after, ok := RetryAfter(err)
+	if !ok || after != time.Second*30 {
+		t.Errorf("Unexpected error: %v, expected retry after 30s", err)
+	}
+}
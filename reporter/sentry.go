@@ -1,7 +1,11 @@
 package reporter
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/complainer"
@@ -28,6 +32,7 @@ func init() {
 type sentryReporter struct {
 	dsn     string
 	clients map[string]*raven.Client
+	mu      sync.Mutex
 }
 
 func newSentryReporter(dsn string) *sentryReporter {
@@ -38,6 +43,9 @@ func newSentryReporter(dsn string) *sentryReporter {
 }
 
 func (s *sentryReporter) client(dsn string) (*raven.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if client, ok := s.clients[dsn]; ok {
 		return client, nil
 	}
@@ -47,12 +55,28 @@ func (s *sentryReporter) client(dsn string) (*raven.Client, error) {
 		return client, err
 	}
 
+	client.Transport = sentryTransport(client.Transport)
+
 	s.clients[dsn] = client
 
 	return client, nil
 }
 
 func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	return s.capture(sentryPacket(failure, stdoutURL, stderrURL), config)
+}
+
+// ReportRendered sends the event rendered earlier to sentry
+func (s *sentryReporter) ReportRendered(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string, payload string) error {
+	packet := &raven.Packet{}
+	if err := json.Unmarshal([]byte(payload), packet); err != nil {
+		return fmt.Errorf("cannot decode rendered event: %s", err)
+	}
+
+	return s.capture(packet, config)
+}
+
+func (s *sentryReporter) capture(packet *raven.Packet, config ConfigProvider) error {
 	dsn := config("dsn")
 	if dsn == "" {
 		dsn = s.dsn
@@ -67,6 +91,37 @@ func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvide
 		return err
 	}
 
+	_, ch := client.Capture(packet, nil)
+
+	return unwrapRetryAfter(<-ch)
+}
+
+// sentryTransport keeps tls config of the raven transport with its root
+// certificates, sets the timeout and reports rate limits of sentry
+func sentryTransport(transport raven.Transport) raven.Transport {
+	httpTransport, ok := transport.(*raven.HTTPTransport)
+	if !ok {
+		return transport
+	}
+
+	next := http.DefaultTransport
+	if httpTransport.Client != nil && httpTransport.Client.Transport != nil {
+		next = httpTransport.Client.Transport
+	}
+
+	client := httpClient()
+	client.Transport = retryAfterTransport{next: next}
+
+	return &raven.HTTPTransport{Client: client}
+}
+
+// Render returns json of the event that is sent to sentry
+func (s *sentryReporter) Render(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	rendered, err := json.Marshal(sentryPacket(failure, stdoutURL, stderrURL))
+	return string(rendered), err
+}
+
+func sentryPacket(failure complainer.Failure, stdoutURL string, stderrURL string) *raven.Packet {
 	extra := map[string]interface{}{
 		"task.id":          failure.ID,
 		"timings.lifetime": failure.Finished.Sub(failure.Started).String(),
@@ -82,22 +137,106 @@ func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvide
 		extra[fmt.Sprintf("labels.%s", k)] = v
 	}
 
-	packet := &raven.Packet{
+	if failure.Message != "" {
+		extra["task.message"] = failure.Message
+	}
+
+	if failure.AgentIP != "" {
+		extra["agent.ip"] = failure.AgentIP
+	}
+
+	for k, v := range failure.Attributes {
+		extra[fmt.Sprintf("agent.attributes.%s", k)] = v
+	}
+
+	extra["task.resources.cpus"] = failure.Resources.CPUs
+	extra["task.resources.mem"] = failure.Resources.Mem
+	extra["task.resources.disk"] = failure.Resources.Disk
+
+	if failure.Resources.GPUs > 0 {
+		extra["task.resources.gpus"] = failure.Resources.GPUs
+	}
+
+	if failure.Resources.Ports != "" {
+		extra["task.resources.ports"] = failure.Resources.Ports
+	}
+
+	if failure.App.ID != "" {
+		extra["app.version"] = failure.App.Version
+		extra["app.instances"] = failure.App.Instances
+
+		if failure.App.Deployment != "" {
+			extra["app.deployment"] = failure.App.Deployment
+		}
+
+		for k, v := range failure.App.Labels {
+			extra[fmt.Sprintf("app.labels.%s", k)] = v
+		}
+	}
+
+	if failure.Job.ID != "" {
+		extra["job.run"] = failure.Job.Run
+		extra["job.attempt"] = failure.Job.Attempt
+
+		if failure.Job.Schedule != "" {
+			extra["job.schedule"] = failure.Job.Schedule
+		}
+
+		if failure.Job.Task != "" {
+			extra["job.task"] = failure.Job.Task
+		}
+	}
+
+	if len(failure.Statuses) > 0 {
+		extra["task.statuses"] = failure.Statuses
+	}
+
+	return &raven.Packet{
 		ServerName: failure.Slave,
 
 		Message: fmt.Sprintf("Task %s died with status %s", failure.Name, failure.State),
 
-		Tags: raven.Tags{
-			{
-				Key:   "task_state",
-				Value: failure.State,
-			},
-		},
+		Tags: sentryTags(failure),
 
 		Extra: extra,
 	}
+}
 
-	_, ch := client.Capture(packet, nil)
+func sentryTags(failure complainer.Failure) raven.Tags {
+	tags := raven.Tags{
+		{
+			Key:   "task_state",
+			Value: failure.State,
+		},
+	}
+
+	if failure.Cluster != "" {
+		tags = append(tags, raven.Tag{Key: "cluster", Value: failure.Cluster})
+	}
+
+	if failure.App.ID != "" {
+		tags = append(tags, raven.Tag{Key: "app_id", Value: failure.App.ID})
+	}
+
+	if failure.Job.ID != "" {
+		tags = append(tags, raven.Tag{Key: "job_id", Value: failure.Job.ID})
+	}
+
+	if failure.Reason != "" {
+		tags = append(tags, raven.Tag{Key: "task_reason", Value: failure.Reason})
+	}
+
+	if failure.Source != "" {
+		tags = append(tags, raven.Tag{Key: "task_source", Value: failure.Source})
+	}
+
+	if failure.ExitCode != nil {
+		tags = append(tags, raven.Tag{Key: "exit_code", Value: strconv.Itoa(*failure.ExitCode)})
+	}
+
+	if failure.Signal != "" {
+		tags = append(tags, raven.Tag{Key: "signal", Value: failure.Signal})
+	}
 
-	return <-ch
+	return tags
 }
@@ -0,0 +1,43 @@
+package reporter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestSentryReportRendered(t *testing.T) {
+	bodies := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://public:secret@", 1) + "/1"
+	reporter := newSentryReporter(dsn)
+	config := func(string) string { return "" }
+
+	payload, err := reporter.Render(complainer.Failure{ID: "web.1", Name: "web", State: "TASK_FAILED"}, config, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failure is ignored in favor of the payload
+	if err := reporter.ReportRendered(complainer.Failure{ID: "web.2", Name: "api"}, config, "", "", payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "Task web died with status TASK_FAILED") {
+		t.Errorf("unexpected events sent to sentry: %v", bodies)
+	}
+}
@@ -3,7 +3,6 @@ package reporter
 import (
 	"bytes"
 	"encoding/json"
-	"net/http"
 	"net/url"
 
 	"github.com/cloudflare/complainer"
@@ -18,6 +17,7 @@ func init() {
 		iconEmoji *string
 		iconURL   *string
 		format    *string
+		resolved  *string
 	)
 
 	registerMaker("slack", Maker{
@@ -28,10 +28,11 @@ func init() {
 			iconEmoji = flags.String("slack.icon_emoji", "SLACK_ICON_EMOJI", "", "default slack user icon emoji")
 			iconURL = flags.String("slack.icon_url", "SLACK_ICON_URL", "", "default slack user icon url")
 			format = flags.String("slack.format", "SLACK_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }} [<{{ .stdoutURL }}|stdout>, <{{ .stderrURL }}|stderr>]", "log format")
+			resolved = flags.String("slack.resolved_format", "SLACK_RESOLVED_FORMAT", "Task {{ .failure.Name }} recovered after dying with status {{ .failure.State }}", "format of messages about recovered tasks")
 		},
 
 		Make: func() (Reporter, error) {
-			return newSlackReporter(*hookURL, *username, *channel, *iconEmoji, *iconURL, *format)
+			return newSlackReporter(*hookURL, *username, *channel, *iconEmoji, *iconURL, *format, *resolved)
 		},
 	})
 }
@@ -43,6 +44,7 @@ type slackReporter struct {
 	iconEmoji string
 	iconURL   string
 	format    string
+	resolved  string
 }
 
 type slackMessage struct {
@@ -53,7 +55,7 @@ type slackMessage struct {
 	IconURL   string `json:"icon_url"`
 }
 
-func newSlackReporter(hookURL, username, channel, iconEmoji, iconURL, format string) (*slackReporter, error) {
+func newSlackReporter(hookURL, username, channel, iconEmoji, iconURL, format, resolved string) (*slackReporter, error) {
 	u, err := url.Parse(hookURL)
 	if err != nil {
 		return nil, err
@@ -66,6 +68,7 @@ func newSlackReporter(hookURL, username, channel, iconEmoji, iconURL, format str
 		iconEmoji: iconEmoji,
 		iconURL:   iconURL,
 		format:    format,
+		resolved:  resolved,
 	}, nil
 }
 
@@ -75,17 +78,58 @@ func (s *slackReporter) Report(failure complainer.Failure, config ConfigProvider
 		return err
 	}
 
-	m := &slackMessage{
-		Text: text,
+	return s.send(text, config)
+}
+
+// Render returns the json message that is posted to the hook
+func (s *slackReporter) Render(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	text, err := fillTemplate(failure, config, stdoutURL, stderrURL, s.format)
+	if err != nil {
+		return "", err
 	}
 
+	jsonMessage, err := s.message(text, config)
+	return string(jsonMessage), err
+}
+
+// ReportRendered posts the json message rendered earlier to the hook
+func (s *slackReporter) ReportRendered(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string, payload string) error {
+	return s.post([]byte(payload), config)
+}
+
+// Digest posts the digest to the hook
+func (s *slackReporter) Digest(digest complainer.Digest, config ConfigProvider) error {
+	return s.send(digest.String(), config)
+}
+
+// Resolve posts the follow-up message about the recovered task to the hook
+func (s *slackReporter) Resolve(failure complainer.Failure, config ConfigProvider) error {
+	text, err := fillTemplate(failure, config, "", "", s.resolved)
+	if err != nil {
+		return err
+	}
+
+	return s.send(text, config)
+}
+
+func (s *slackReporter) send(text string, config ConfigProvider) error {
+	jsonMessage, err := s.message(text, config)
+	if err != nil {
+		return err
+	}
+
+	return s.post(jsonMessage, config)
+}
+
+func (s *slackReporter) post(jsonMessage []byte, config ConfigProvider) error {
 	var hookURL *url.URL
 	if u := config("hook_url"); len(u) > 0 {
-		hookURL, err = url.Parse(u)
+		parsed, err := url.Parse(u)
 		if err != nil {
 			return err
 		}
 
+		hookURL = parsed
 	} else {
 		hookURL = s.hookURL
 	}
@@ -94,30 +138,29 @@ func (s *slackReporter) Report(failure complainer.Failure, config ConfigProvider
 	// All other properties are optional.
 	// But it's a legitimate scenario when some reporters are not fully configured.
 	// You don't always want to report all failures to all reporters.
-	// If some required parameter is missing, just silently return from Report().
+	// If some required parameter is missing, just silently return.
 	if hookURL == nil {
 		return nil
 	}
 
-	// Fill and overwrite configuration values
-	s.fillConfigValues(m, config)
-
-	jsonMessage, err := json.Marshal(m)
+	body := bytes.NewReader(jsonMessage)
+	resp, err := httpClient().Post(hookURL.String(), "application/json", body)
 	if err != nil {
 		return err
 	}
 
-	body := bytes.NewReader(jsonMessage)
-	resp, err := http.Post(hookURL.String(), "application/json", body)
-	if err != nil {
-		defer func() {
-			if resp != nil {
-				_ = resp.Body.Close()
-			}
-		}()
+	return checkResponse(resp)
+}
+
+func (s *slackReporter) message(text string, config ConfigProvider) ([]byte, error) {
+	m := &slackMessage{
+		Text: text,
 	}
 
-	return err
+	// Fill and overwrite configuration values
+	s.fillConfigValues(m, config)
+
+	return json.Marshal(m)
 }
 
 func (s *slackReporter) fillConfigValues(m *slackMessage, config ConfigProvider) {
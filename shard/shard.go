@@ -0,0 +1,302 @@
+package shard
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+const (
+	// KeyFramework shards failures by framework name
+	KeyFramework = "framework"
+	// KeyTask shards failures by task id
+	KeyTask = "task"
+	// replicas is the number of points every member has on the ring,
+	// more points spread the load more evenly
+	replicas = 64
+)
+
+var flagConfig = struct {
+	members *string
+	id      *string
+	key     *string
+	refresh *time.Duration
+}{}
+
+// RegisterFlags registers command line flags for sharding
+func RegisterFlags() {
+	hostname, _ := os.Hostname()
+
+	flagConfig.members = flags.String("shard.members", "SHARD_MEMBERS", "", "ids of instances to split failures between (example: one,two,three) or zookeeper url to discover them (example: zk://host:port,host:port/complainer-shards)")
+	flagConfig.id = flags.String("shard.id", "SHARD_ID", hostname, "id of this instance among shard members")
+	flagConfig.key = flags.String("shard.key", "SHARD_KEY", KeyFramework, "what to split failures by: framework or task")
+	flagConfig.refresh = flags.Duration("shard.refresh", "SHARD_REFRESH", time.Second*10, "how often to refresh members")
+}
+
+// FlagSharder returns the sharder configured by command line flags,
+// nil is returned if members are not configured
+func FlagSharder() (*Sharder, error) {
+	if *flagConfig.members == "" {
+		return nil, nil
+	}
+
+	var membership Membership
+	if strings.HasPrefix(*flagConfig.members, "zk://") {
+		zkMembership, err := newZookeeperMembership(*flagConfig.members, *flagConfig.id)
+		if err != nil {
+			return nil, err
+		}
+
+		membership = zkMembership
+	} else {
+		members := strings.Split(*flagConfig.members, ",")
+		if !contains(members, *flagConfig.id) {
+			return nil, fmt.Errorf("id %s is not one of shard members %s", *flagConfig.id, *flagConfig.members)
+		}
+
+		membership = StaticMembership(members)
+	}
+
+	return NewSharder(*flagConfig.id, *flagConfig.key, membership, *flagConfig.refresh)
+}
+
+func contains(members []string, id string) bool {
+	for _, member := range members {
+		if strings.TrimSpace(member) == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Membership returns the ids of instances that share the work
+type Membership interface {
+	Members() ([]string, error)
+}
+
+// StaticMembership is the fixed list of members
+type StaticMembership []string
+
+// Members returns the list of members
+func (s StaticMembership) Members() ([]string, error) {
+	return s, nil
+}
+
+// Sharder decides which failures belong to this instance
+type Sharder struct {
+	id         string
+	key        string
+	membership Membership
+	refresh    time.Duration
+	ring       *ring
+	err        error
+	mu         sync.Mutex
+}
+
+// NewSharder creates the sharder for the instance with the id,
+// failures are split by the key, which is either framework or task
+func NewSharder(id, key string, membership Membership, refresh time.Duration) (*Sharder, error) {
+	if key != KeyFramework && key != KeyTask {
+		return nil, fmt.Errorf("unknown shard key %q", key)
+	}
+
+	s := &Sharder{
+		id:         id,
+		key:        key,
+		membership: membership,
+		refresh:    refresh,
+	}
+
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Run refreshes members forever
+func (s *Sharder) Run() {
+	for {
+		time.Sleep(s.refresh)
+
+		if err := s.Refresh(); err != nil {
+			log.Printf("Error refreshing shard members: %s", err)
+		}
+	}
+}
+
+// Refresh rebuilds the ring from current members, the previous
+// ring is kept if members cannot be listed
+func (s *Sharder) Refresh() error {
+	members, err := s.membership.Members()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+	if err != nil {
+		return err
+	}
+
+	ring := newRing(members)
+
+	if s.ring != nil && !s.ring.equal(ring) {
+		log.Printf("Shard members changed from %v to %v", s.ring.members, ring.members)
+	}
+
+	s.ring = ring
+
+	return nil
+}
+
+// Owns reports whether the failure belongs to this instance, failures
+// are not owned by anyone until members are known
+func (s *Sharder) Owns(failure complainer.Failure) bool {
+	key := failure.Framework
+	if s.key == KeyTask {
+		key = failure.ID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ring != nil && s.ring.owner(key) == s.id
+}
+
+// Status describes shard ownership of this instance
+func (s *Sharder) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := fmt.Sprintf("%s by %s", s.id, s.key)
+	if s.ring != nil {
+		status += fmt.Sprintf(", %.0f%% of %d members: %s", s.ring.share(s.id)*100, len(s.ring.members), strings.Join(s.ring.members, ","))
+	}
+
+	if s.err != nil {
+		status += fmt.Sprintf(", cannot refresh members: %s", s.err)
+	}
+
+	return status
+}
+
+// ring is the consistent hash ring, removing a member only moves
+// the keys that belonged to it
+type ring struct {
+	members []string
+	points  []uint32
+	owners  map[uint32]string
+}
+
+func newRing(members []string) *ring {
+	r := &ring{owners: map[uint32]string{}}
+
+	for _, member := range members {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		r.members = append(r.members, member)
+
+		for i := 0; i < replicas; i++ {
+			point := crc32.ChecksumIEEE([]byte(member + "#" + strconv.Itoa(i)))
+
+			// Collisions are resolved in favor of the smaller id
+			if owner, ok := r.owners[point]; ok && owner < member {
+				continue
+			}
+
+			if _, ok := r.owners[point]; !ok {
+				r.points = append(r.points, point)
+			}
+
+			r.owners[point] = member
+		}
+	}
+
+	sort.Strings(r.members)
+	sort.Sort(byPoint(r.points))
+
+	return r
+}
+
+// byPoint sorts points on the ring
+type byPoint []uint32
+
+func (p byPoint) Len() int {
+	return len(p)
+}
+
+func (p byPoint) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (p byPoint) Less(i, j int) bool {
+	return p[i] < p[j]
+}
+
+// owner returns the member owning the key
+func (r *ring) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// share returns the share of the ring owned by the member
+func (r *ring) share(member string) float64 {
+	owned := uint64(0)
+
+	for i, point := range r.points {
+		if r.owners[point] != member {
+			continue
+		}
+
+		// Every point owns hashes since the previous point
+		previous := r.points[len(r.points)-1]
+		if i > 0 {
+			previous = r.points[i-1]
+		}
+
+		owned += uint64(point - previous)
+	}
+
+	if len(r.points) == 1 {
+		return 1
+	}
+
+	return float64(owned) / float64(1<<32)
+}
+
+func (r *ring) equal(other *ring) bool {
+	if len(r.members) != len(other.members) {
+		return false
+	}
+
+	for i := range r.members {
+		if r.members[i] != other.members[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+type testMembership struct {
+	members []string
+	err     error
+}
+
+func (m *testMembership) Members() ([]string, error) {
+	return m.members, m.err
+}
+
+func TestRing(t *testing.T) {
+	members := []string{"one", "two", "three"}
+	r := newRing(members)
+
+	owners := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("framework-%d", i)
+		owners[key] = r.owner(key)
+		counts[owners[key]]++
+	}
+
+	for _, member := range members {
+		if counts[member] < 500 {
+			t.Errorf("expected keys to be spread evenly, got %v", counts)
+		}
+	}
+
+	// Only keys of the member that left are moved
+	r = newRing([]string{"one", "three"})
+	for key, owner := range owners {
+		if owner != "two" && r.owner(key) != owner {
+			t.Errorf("expected %s to stay on %s, moved to %s", key, owner, r.owner(key))
+		}
+
+		if owner == "two" && r.owner(key) == "two" {
+			t.Errorf("expected %s to move from the member that left", key)
+		}
+	}
+
+	if owner := newRing(nil).owner("key"); owner != "" {
+		t.Errorf("expected no owner on empty ring, got %s", owner)
+	}
+}
+
+func TestSharder(t *testing.T) {
+	membership := &testMembership{members: []string{"one", "two"}}
+
+	if _, err := NewSharder("one", "unknown", membership, time.Second); err == nil {
+		t.Errorf("expected error for unknown key")
+	}
+
+	one, err := NewSharder("one", KeyFramework, membership, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	two, err := NewSharder("two", KeyTask, membership, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := complainer.Failure{ID: "task.1", Framework: "marathon"}
+
+	// Every failure has exactly one owner
+	owners := newRing(membership.members)
+	if one.Owns(failure) != (owners.owner("marathon") == "one") {
+		t.Errorf("unexpected ownership of framework %s", failure.Framework)
+	}
+
+	if two.Owns(failure) != (owners.owner("task.1") == "two") {
+		t.Errorf("unexpected ownership of task %s", failure.ID)
+	}
+
+	// Members that cannot be refreshed keep the previous ring
+	membership.err = errors.New("zookeeper is down")
+	if err := one.Refresh(); err == nil {
+		t.Errorf("expected refresh error")
+	}
+
+	status := one.Status()
+	if !strings.Contains(status, "of 2 members: one,two") || !strings.Contains(status, "zookeeper is down") {
+		t.Errorf("unexpected status: %s", status)
+	}
+
+	// The only member left owns everything
+	membership.members, membership.err = []string{"one"}, nil
+	if err := one.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !one.Owns(failure) || !strings.HasPrefix(one.Status(), "one by framework, 100% of 1 members") {
+		t.Errorf("expected the last member to own everything, got %s", one.Status())
+	}
+}
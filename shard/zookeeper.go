@@ -0,0 +1,76 @@
+package shard
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// zookeeperTimeout is the session timeout, members are
+// gone once their sessions expire
+const zookeeperTimeout = time.Second * 10
+
+// zookeeperMembership registers this instance as an ephemeral node
+// and lists the nodes of other instances
+type zookeeperMembership struct {
+	conn *zk.Conn
+	path string
+	id   string
+}
+
+// newZookeeperMembership creates membership from zk://host1:port,host2:port/path url
+func newZookeeperMembership(zkURL, id string) (*zookeeperMembership, error) {
+	hosts := strings.TrimPrefix(zkURL, "zk://")
+
+	i := strings.Index(hosts, "/")
+	if i == -1 || len(hosts) == i+1 {
+		return nil, fmt.Errorf("invalid zookeeper url %q: path expected", zkURL)
+	}
+
+	conn, _, err := zk.Connect(strings.Split(hosts[:i], ","), zookeeperTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zookeeperMembership{
+		conn: conn,
+		path: strings.TrimSuffix(hosts[i:], "/"),
+		id:   id,
+	}, nil
+}
+
+// Members registers this instance if its node is gone and returns
+// the ids of all registered instances
+func (m *zookeeperMembership) Members() ([]string, error) {
+	if err := m.register(); err != nil {
+		return nil, err
+	}
+
+	children, _, err := m.conn.Children(m.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list %s in zookeeper: %s", m.path, err)
+	}
+
+	return children, nil
+}
+
+func (m *zookeeperMembership) register() error {
+	path := ""
+	for _, part := range strings.Split(strings.TrimPrefix(m.path, "/"), "/") {
+		path += "/" + part
+
+		_, err := m.conn.Create(path, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return fmt.Errorf("cannot create %s in zookeeper: %s", path, err)
+		}
+	}
+
+	_, err := m.conn.Create(m.path+"/"+m.id, nil, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return fmt.Errorf("cannot register %s in zookeeper: %s", m.id, err)
+	}
+
+	return nil
+}
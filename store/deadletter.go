@@ -0,0 +1,290 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+// DeadLetter is the notification that could not be delivered
+// by the reporter instance after all retries
+type DeadLetter struct {
+	ID        string             `json:"id"`
+	Failure   complainer.Failure `json:"failure"`
+	Reporter  string             `json:"reporter"`
+	Instance  string             `json:"instance"`
+	Payload   string             `json:"payload"`
+	StdoutURL string             `json:"stdout_url"`
+	StderrURL string             `json:"stderr_url"`
+	Error     string             `json:"error"`
+	Created   time.Time          `json:"created"`
+}
+
+// DeadLetters keeps notifications that could not be delivered,
+// so that they can be replayed later
+type DeadLetters interface {
+	// Add records the notification and returns it with the assigned id,
+	// notifications that already have an id keep it
+	Add(letter DeadLetter) (DeadLetter, error)
+	// List returns all notifications from the oldest to the newest
+	List() ([]DeadLetter, error)
+	// Get returns the notification by id, false is returned if it is missing
+	Get(id string) (DeadLetter, bool, error)
+	// Take removes the notification and returns it, false is returned
+	// if it is missing, so that only one caller gets it
+	Take(id string) (DeadLetter, bool, error)
+	// Remove forgets the notification
+	Remove(id string) error
+	// Len returns the number of notifications
+	Len() int
+}
+
+// FileDeadLetters keeps notifications in a file with one json record per
+// line, changes are appended and the file is compacted once it grows well
+// above the number of live notifications. The oldest notifications are
+// dropped above the limit.
+type FileDeadLetters struct {
+	path     string
+	limit    int
+	file     *os.File
+	appended int
+	letters  map[string]DeadLetter
+	mu       sync.Mutex
+}
+
+// deadLetterRecord is a single line of the file, records
+// with removed set forget the notification with that id
+type deadLetterRecord struct {
+	Letter  *DeadLetter `json:"letter,omitempty"`
+	Removed string      `json:"removed,omitempty"`
+}
+
+// NewFileDeadLetters creates dead letters backed by the file,
+// at most limit notifications are kept
+func NewFileDeadLetters(path string, limit int) (*FileDeadLetters, error) {
+	d := &FileDeadLetters{
+		path:    path,
+		limit:   limit,
+		letters: map[string]DeadLetter{},
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot read dead letters: %s", err)
+	}
+
+	err = loadLines(content, func(line []byte) error {
+		record := deadLetterRecord{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+
+		d.apply(record)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode dead letters %s: %s", path, err)
+	}
+
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *FileDeadLetters) apply(record deadLetterRecord) {
+	if record.Letter != nil {
+		d.letters[record.Letter.ID] = *record.Letter
+		return
+	}
+
+	delete(d.letters, record.Removed)
+}
+
+// Add records the notification and returns it with the assigned id
+func (d *FileDeadLetters) Add(letter DeadLetter) (DeadLetter, error) {
+	if letter.ID == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return letter, fmt.Errorf("cannot generate id: %s", err)
+		}
+
+		letter.ID = hex.EncodeToString(id)
+	}
+
+	if letter.Created.IsZero() {
+		letter.Created = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.append(deadLetterRecord{Letter: &letter}); err != nil {
+		return letter, err
+	}
+
+	if d.limit > 0 {
+		for _, old := range d.sorted() {
+			if len(d.letters) <= d.limit {
+				break
+			}
+
+			if err := d.append(deadLetterRecord{Removed: old.ID}); err != nil {
+				return letter, err
+			}
+		}
+	}
+
+	return letter, nil
+}
+
+// List returns all notifications from the oldest to the newest
+func (d *FileDeadLetters) List() ([]DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.sorted(), nil
+}
+
+// Get returns the notification by id
+func (d *FileDeadLetters) Get(id string) (DeadLetter, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letter, ok := d.letters[id]
+
+	return letter, ok, nil
+}
+
+// Take removes the notification and returns it
+func (d *FileDeadLetters) Take(id string) (DeadLetter, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letter, ok := d.letters[id]
+	if !ok {
+		return letter, false, nil
+	}
+
+	return letter, true, d.append(deadLetterRecord{Removed: id})
+}
+
+// Remove forgets the notification
+func (d *FileDeadLetters) Remove(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.letters[id]; !ok {
+		return nil
+	}
+
+	return d.append(deadLetterRecord{Removed: id})
+}
+
+// Len returns the number of notifications
+func (d *FileDeadLetters) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.letters)
+}
+
+// Close closes the file of dead letters
+func (d *FileDeadLetters) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.file.Close()
+}
+
+// append applies the record and appends it to the file
+func (d *FileDeadLetters) append(record deadLetterRecord) error {
+	d.apply(record)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("cannot append to dead letters: %s", err)
+	}
+
+	if err := d.file.Sync(); err != nil {
+		return fmt.Errorf("cannot sync dead letters: %s", err)
+	}
+
+	d.appended++
+
+	if d.appended > minCompaction && d.appended > len(d.letters)*2 {
+		return d.compact()
+	}
+
+	return nil
+}
+
+// compact rewrites the file with live notifications
+// and reopens it for appending
+func (d *FileDeadLetters) compact() error {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+
+	for _, letter := range d.sorted() {
+		letter := letter
+		if err := encoder.Encode(deadLetterRecord{Letter: &letter}); err != nil {
+			return err
+		}
+	}
+
+	file, err := replaceFile(d.path, buf.Bytes(), d.file)
+	if err != nil {
+		return err
+	}
+
+	d.file = file
+	d.appended = 0
+
+	return nil
+}
+
+func (d *FileDeadLetters) sorted() []DeadLetter {
+	letters := make([]DeadLetter, 0, len(d.letters))
+	for _, letter := range d.letters {
+		letters = append(letters, letter)
+	}
+
+	sort.Sort(byCreated(letters))
+
+	return letters
+}
+
+// byCreated sorts dead letters by their creation time and id
+type byCreated []DeadLetter
+
+func (l byCreated) Len() int {
+	return len(l)
+}
+
+func (l byCreated) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l byCreated) Less(i, j int) bool {
+	if l[i].Created.Equal(l[j].Created) {
+		return l[i].ID < l[j].ID
+	}
+
+	return l[i].Created.Before(l[j].Created)
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestFileDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "dead-letters.json")
+
+	d, err := NewFileDeadLetters(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Round(0)
+	ids := []string{}
+
+	for i, id := range []string{"task.1", "task.2", "task.3"} {
+		letter, err := d.Add(DeadLetter{
+			Failure:  complainer.Failure{ID: id},
+			Reporter: "slack",
+			Instance: "default",
+			Error:    "slack is down",
+			Created:  now.Add(time.Duration(i) * time.Second),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, letter.ID)
+	}
+
+	// Everything is read back from the file after restart
+	d, err = NewFileDeadLetters(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The oldest letter is dropped above the limit
+	if len(letters) != 2 || letters[0].ID != ids[1] || letters[1].ID != ids[2] {
+		t.Fatalf("unexpected letters: %+v", letters)
+	}
+
+	if letters[0].Failure.ID != "task.2" || letters[0].Error != "slack is down" {
+		t.Errorf("unexpected letter: %+v", letters[0])
+	}
+
+	if err := d.Remove(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := d.Get(ids[1]); ok {
+		t.Errorf("expected removed letter to be missing")
+	}
+
+	if letter, ok, _ := d.Get(ids[2]); !ok || letter.Failure.ID != "task.3" {
+		t.Errorf("expected letter of task.3, got %+v", letter)
+	}
+
+	if d.Len() != 1 {
+		t.Errorf("expected 1 letter, got %d", d.Len())
+	}
+
+	// Taken letters are gone until they are put back with the same id
+	letter, ok, err := d.Take(ids[2])
+	if err != nil || !ok {
+		t.Fatalf("expected letter of task.3 to be taken, got %v and %v", ok, err)
+	}
+
+	if _, ok, _ := d.Take(ids[2]); ok {
+		t.Errorf("expected taken letter to be missing")
+	}
+
+	if readded, err := d.Add(letter); err != nil || readded.ID != ids[2] {
+		t.Errorf("expected letter to be put back as %s, got %s and %v", ids[2], readded.ID, err)
+	}
+
+	// Changes are appended to the compacted file
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(content), "\n"); lines != 5 {
+		t.Errorf("expected 5 lines in the file, got %d", lines)
+	}
+
+	// Letters cut short by a crash are dropped
+	if err := ioutil.WriteFile(path, append(content, `{"letter": {"id": "cut`...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = NewFileDeadLetters(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if letters, _ := d.List(); len(letters) != 1 || letters[0].ID != ids[2] {
+		t.Errorf("unexpected letters after restart: %+v", letters)
+	}
+}
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// minCompaction is the number of appended records that
+// never triggers compaction of the file on its own
+const minCompaction = 1000
+
+// FileStore keeps failures in a file with one json record per line,
+// changes are appended and the file is compacted once it grows well above
+// the number of live records. Failures are forgotten once they are older
+// than the retention. Replicas can share the file, only the leader appends
+// and the others reload the file once they become the leader.
+type FileStore struct {
+	path      string
+	retention time.Duration
+	file      *os.File
+	appended  int
+	failures  map[string]map[string]time.Time
+	processed map[string]time.Time
+	mu        sync.Mutex
+}
+
+// fileRecord is a single line of the file, records without
+// id set the last processed time of the source
+type fileRecord struct {
+	Source string    `json:"source"`
+	ID     string    `json:"id,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// NewFileStore creates the store backed by the file, failures that are
+// older than the retention are not kept
+func NewFileStore(path string, retention time.Duration) (*FileStore, error) {
+	s := &FileStore{
+		path:      path,
+		retention: retention,
+	}
+
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload reads the file again, so that records appended by other
+// replicas sharing the file are seen
+func (s *FileStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	return s.reopen()
+}
+
+// reopen opens the file again if it was replaced by compaction
+// of another replica sharing it, appends would be lost otherwise
+func (s *FileStore) reopen() error {
+	current, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat store: %s", err)
+	}
+
+	replaced, err := os.Stat(s.path)
+	if err == nil && os.SameFile(current, replaced) {
+		return nil
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open store: %s", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		log.Printf("Error closing replaced store file %s: %s", s.path, err)
+	}
+
+	s.file = file
+
+	return nil
+}
+
+// read replaces records in memory with the ones from the file
+func (s *FileStore) read() error {
+	s.failures = map[string]map[string]time.Time{}
+	s.processed = map[string]time.Time{}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot read store: %s", err)
+	}
+
+	if err := s.load(content); err != nil {
+		return fmt.Errorf("cannot decode store %s: %s", s.path, err)
+	}
+
+	return nil
+}
+
+// load applies records from the content
+func (s *FileStore) load(content []byte) error {
+	return loadLines(content, func(line []byte) error {
+		record := fileRecord{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+
+		s.apply(record)
+
+		return nil
+	})
+}
+
+// loadLines calls load for every line of the content, the last line is
+// dropped if it was cut short by a crash in the middle of the write
+func loadLines(content []byte, load func(line []byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	// Lines are as long as the longest record
+	scanner.Buffer(nil, len(content)+1)
+	valid := 0
+
+	for scanner.Scan() {
+		if err := load(scanner.Bytes()); err != nil {
+			if valid > 0 && !bytes.HasSuffix(content, []byte("\n")) && bytes.HasSuffix(content, scanner.Bytes()) {
+				return nil
+			}
+
+			return err
+		}
+
+		valid++
+	}
+
+	return scanner.Err()
+}
+
+func (s *FileStore) apply(record fileRecord) {
+	if record.ID == "" {
+		s.processed[record.Source] = record.Time
+		return
+	}
+
+	if s.failures[record.Source] == nil {
+		s.failures[record.Source] = map[string]time.Time{}
+	}
+
+	s.failures[record.Source][record.ID] = record.Time
+}
+
+// Seen reports whether the failure of the source was reported
+func (s *FileStore) Seen(source, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.failures[source][id]
+
+	return ok, nil
+}
+
+// Add records the reported failure of the source
+func (s *FileStore) Add(source, id string, finished time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(fileRecord{Source: source, ID: id, Time: finished})
+}
+
+// LastProcessed returns when the source was last processed
+func (s *FileStore) LastProcessed(source string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.processed[source], nil
+}
+
+// SetLastProcessed records when the source was last processed
+func (s *FileStore) SetLastProcessed(source string, processed time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(fileRecord{Source: source, Time: processed})
+}
+
+// Close closes the file of the store
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// append applies the record and appends it to the file
+func (s *FileStore) append(record fileRecord) error {
+	s.apply(record)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := s.reopen(); err != nil {
+		return err
+	}
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("cannot append to store: %s", err)
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("cannot sync store: %s", err)
+	}
+
+	s.appended++
+
+	if s.appended > minCompaction && s.appended > s.live()*2 {
+		return s.compact()
+	}
+
+	return nil
+}
+
+func (s *FileStore) live() int {
+	live := len(s.processed)
+	for _, failures := range s.failures {
+		live += len(failures)
+	}
+
+	return live
+}
+
+// compact drops expired failures, rewrites the file with live records
+// and reopens it for appending
+func (s *FileStore) compact() error {
+	// Failures are kept a bit longer than the retention for finish
+	// times that are behind the clock of complainer
+	expired := time.Now().Add(-s.retention * 2)
+
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+
+	for source, processed := range s.processed {
+		if err := encoder.Encode(fileRecord{Source: source, Time: processed}); err != nil {
+			return err
+		}
+	}
+
+	for source, failures := range s.failures {
+		for id, finished := range failures {
+			if finished.Before(expired) {
+				delete(failures, id)
+				continue
+			}
+
+			if err := encoder.Encode(fileRecord{Source: source, ID: id, Time: finished}); err != nil {
+				return err
+			}
+		}
+
+		if len(failures) == 0 {
+			delete(s.failures, source)
+		}
+	}
+
+	file, err := replaceFile(s.path, buf.Bytes(), s.file)
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.appended = 0
+
+	return nil
+}
+
+// replaceFile writes the content in place of the file and opens it for
+// appending, the old file is closed. The old file keeps taking appends
+// if it cannot be replaced.
+func replaceFile(path string, content []byte, old *os.File) (*os.File, error) {
+	if err := writeFile(path, content); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %s", path, err)
+	}
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			log.Printf("Error closing replaced file %s: %s", path, err)
+		}
+	}
+
+	return file, nil
+}
+
+// writeFile writes the content into a temporary file and moves it in place,
+// so that the file is never left half written
+func writeFile(path string, content []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %s", err)
+	}
+
+	defer func() {
+		_ = os.Remove(temp.Name())
+	}()
+
+	if _, err := temp.Write(content); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("cannot write file: %s", err)
+	}
+
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("cannot sync file: %s", err)
+	}
+
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("cannot write file: %s", err)
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("cannot replace file: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStoreCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "store.json")
+
+	s, err := NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	for i := 0; i < minCompaction*3; i++ {
+		if err := s.SetLastProcessed("mesos", now.Add(time.Duration(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Add("mesos", "task.1", now); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the records since the last compaction are kept
+	if lines := strings.Count(string(content), "\n"); lines > minCompaction+2 {
+		t.Errorf("expected the file to be compacted, got %d lines", lines)
+	}
+
+	s, err = NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed, _ := s.LastProcessed("mesos")
+	if !processed.Equal(now.Add(time.Duration(minCompaction*3 - 1)).Round(0)) {
+		t.Errorf("unexpected last processed time after compaction: %s", processed)
+	}
+
+	if seen, _ := s.Seen("mesos", "task.1"); !seen {
+		t.Errorf("expected task.1 to be kept after compaction")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "store.json")
+
+	s, err := NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Round(0)
+
+	if err := s.Add("mesos", "task.1", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Add("mesos", "task.old", now.Add(-time.Hour*3)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SetLastProcessed("mesos", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything is read back from the file after restart
+	s, err = NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		source string
+		id     string
+		seen   bool
+	}{
+		{source: "mesos", id: "task.1", seen: true},
+		{source: "mesos", id: "task.2", seen: false},
+		{source: "mesos", id: "task.old", seen: false},
+		{source: "kubernetes", id: "task.1", seen: false},
+	}
+
+	for _, tt := range table {
+		seen, err := s.Seen(tt.source, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if seen != tt.seen {
+			t.Errorf("expected seen %t for %s/%s, got %t", tt.seen, tt.source, tt.id, seen)
+		}
+	}
+
+	processed, err := s.LastProcessed("mesos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !processed.Equal(now) {
+		t.Errorf("expected last processed %s, got %s", now, processed)
+	}
+
+	processed, err = s.LastProcessed("kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !processed.IsZero() {
+		t.Errorf("expected zero last processed for unknown source, got %s", processed)
+	}
+
+	// Records cut short by a crash are dropped
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, append(content, []byte(`{"source":"mesos","id":"tas`)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("expected torn record to be dropped, got %s", err)
+	}
+
+	if seen, _ := s.Seen("mesos", "task.1"); !seen {
+		t.Errorf("expected task.1 to survive the torn record")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(path, time.Hour); err == nil {
+		t.Errorf("expected error reading corrupted store")
+	}
+}
+
+func TestFileStoreShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "store.json")
+
+	leader, err := NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The standby compacts the file on start, the leader keeps appending to it
+	standby, err := NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	if err := leader.Add("test", "first", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := leader.SetLastProcessed("test", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen, _ := standby.Seen("test", "first"); seen {
+		t.Errorf("expected failure not to be seen before reload")
+	}
+
+	if err := standby.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen, _ := standby.Seen("test", "first"); !seen {
+		t.Errorf("expected failure of the leader to be seen after reload")
+	}
+
+	if processed, _ := standby.LastProcessed("test"); !processed.Equal(now) {
+		t.Errorf("expected last processed time %s of the leader, got %s", now, processed)
+	}
+}
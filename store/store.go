@@ -0,0 +1,86 @@
+package store
+
+import (
+	"time"
+
+	"github.com/cloudflare/complainer/flags"
+)
+
+var flagConfig = struct {
+	file    *string
+	shared  *bool
+	catchUp *time.Duration
+	grace   *time.Duration
+
+	deadLetters     *string
+	deadLettersSize *int
+}{}
+
+// RegisterFlags registers command line flags for the store
+func RegisterFlags() {
+	flagConfig.file = flags.String("store.file", "STORE_FILE", "", "path to file to keep reported failures in across restarts")
+	flagConfig.shared = flags.Bool("store.shared", "STORE_SHARED", false, "whether the store file is shared by replicas, it is read again when this replica becomes the leader")
+	flagConfig.catchUp = flags.Duration("store.catch_up", "STORE_CATCH_UP", time.Minute*15, "how old failures missed while not running can be to get reported")
+	flagConfig.grace = flags.Duration("store.grace", "STORE_GRACE", time.Minute*5, "how long before the last processed time failures can finish and still get reported when they are listed late")
+	flagConfig.deadLetters = flags.String("store.dead_letters", "STORE_DEAD_LETTERS", "", "path to file to keep notifications that could not be delivered in")
+	flagConfig.deadLettersSize = flags.Int("store.dead_letters_size", "STORE_DEAD_LETTERS_SIZE", 1000, "maximum number of notifications to keep, the oldest ones are dropped")
+}
+
+// Windows decide which failures are checked against the store
+type Windows struct {
+	// CatchUp limits how old failures missed while not running can be
+	CatchUp time.Duration
+	// Grace is how long before the last processed time failures can
+	// finish and still get reported, agents can send updates late
+	Grace time.Duration
+}
+
+// FlagStore returns the store configured by command line flags and its
+// windows, nil is returned if the store file is not configured
+func FlagStore() (Store, Windows, error) {
+	if *flagConfig.file == "" {
+		return nil, Windows{}, nil
+	}
+
+	store, err := NewFileStore(*flagConfig.file, *flagConfig.catchUp)
+	if err != nil {
+		return nil, Windows{}, err
+	}
+
+	return store, Windows{CatchUp: *flagConfig.catchUp, Grace: *flagConfig.grace}, nil
+}
+
+// FlagShared reports whether the store file is shared by replicas
+func FlagShared() bool {
+	return *flagConfig.shared
+}
+
+// FlagDeadLetters returns dead letters configured by command line flags,
+// nil is returned if the dead letters file is not configured
+func FlagDeadLetters() (DeadLetters, error) {
+	if *flagConfig.deadLetters == "" {
+		return nil, nil
+	}
+
+	return NewFileDeadLetters(*flagConfig.deadLetters, *flagConfig.deadLettersSize)
+}
+
+// Store keeps track of reported failures and processed sources,
+// so that restarts neither lose nor repeat failures
+type Store interface {
+	// Seen reports whether the failure of the source was reported
+	Seen(source, id string) (bool, error)
+	// Add records the reported failure of the source
+	Add(source, id string, finished time.Time) error
+	// LastProcessed returns when the source was last processed,
+	// zero time is returned for unknown sources
+	LastProcessed(source string) (time.Time, error)
+	// SetLastProcessed records when the source was last processed
+	SetLastProcessed(source string, processed time.Time) error
+}
+
+// Reloader is implemented by stores that can be shared by replicas,
+// they are reloaded to see changes made by other replicas
+type Reloader interface {
+	Reload() error
+}
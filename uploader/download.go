@@ -6,8 +6,15 @@ import (
 	"net/http"
 )
 
-func download(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// download fetches logs with the client of the source,
+// the request is also limited by the uploader timeout
+func download(client *http.Client, url string) ([]byte, error) {
+	limited := *client
+	if limited.Timeout == 0 || (*requestTimeout > 0 && *requestTimeout < limited.Timeout) {
+		limited.Timeout = *requestTimeout
+	}
+
+	resp, err := limited.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,10 @@
 package uploader
 
-import "github.com/cloudflare/complainer"
+import (
+	"net/http"
+
+	"github.com/cloudflare/complainer"
+)
 
 func init() {
 	registerMaker("noop", Maker{
@@ -14,6 +18,6 @@ func init() {
 
 type noopUploader struct{}
 
-func (n noopUploader) Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+func (n noopUploader) Upload(failure complainer.Failure, client *http.Client, stdoutURL, stderrURL string) (string, string, error) {
 	return stdoutURL, stderrURL, nil
 }
@@ -3,6 +3,7 @@ package uploader
 import (
 	"bytes"
 	"errors"
+	"net/http"
 	"path"
 	"text/template"
 	"time"
@@ -62,6 +63,7 @@ func newS3AwsUploader(accessKey, secretKey, region, bucket, prefix string, timeo
 		s3: s3.New(session.New(&aws.Config{
 			Region:      aws.String(region),
 			Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
+			HTTPClient:  &http.Client{Timeout: *requestTimeout},
 		})),
 		bucket:  bucket,
 		timeout: timeout,
@@ -69,12 +71,12 @@ func newS3AwsUploader(accessKey, secretKey, region, bucket, prefix string, timeo
 	}, nil
 }
 
-func (u *s3AwsUploader) Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+func (u *s3AwsUploader) Upload(failure complainer.Failure, client *http.Client, stdoutURL, stderrURL string) (string, string, error) {
 	buf := bytes.NewBuffer([]byte{})
 	err := u.prefix.Execute(buf, map[string]interface{}{"failure": failure})
 	prefix := string(buf.Bytes())
 
-	stdout, err := download(stdoutURL)
+	stdout, err := download(client, stdoutURL)
 	if err != nil {
 		return "", "", err
 	}
@@ -84,7 +86,7 @@ func (u *s3AwsUploader) Upload(failure complainer.Failure, stdoutURL, stderrURL
 		return "", "", err
 	}
 
-	stderr, err := download(stderrURL)
+	stderr, err := download(client, stderrURL)
 	if err != nil {
 		return "", "", err
 	}
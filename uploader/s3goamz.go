@@ -3,6 +3,7 @@ package uploader
 import (
 	"bytes"
 	"errors"
+	"net/http"
 	"path"
 	"text/template"
 	"time"
@@ -64,19 +65,22 @@ func newS3Uploader(accessKey, secretKey, endpoint, bucket, prefix string, timeou
 		return nil, err
 	}
 
+	client := s3.New(auth, region)
+	client.RequestTimeout = *requestTimeout
+
 	return &s3Uploader{
-		bucket:  s3.New(auth, region).Bucket(bucket),
+		bucket:  client.Bucket(bucket),
 		timeout: timeout,
 		prefix:  tmpl,
 	}, nil
 }
 
-func (u *s3Uploader) Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+func (u *s3Uploader) Upload(failure complainer.Failure, client *http.Client, stdoutURL, stderrURL string) (string, string, error) {
 	buf := bytes.NewBuffer([]byte{})
 	err := u.prefix.Execute(buf, map[string]interface{}{"failure": failure})
 	prefix := string(buf.Bytes())
 
-	stdout, err := download(stdoutURL)
+	stdout, err := download(client, stdoutURL)
 	if err != nil {
 		return "", "", err
 	}
@@ -87,7 +91,7 @@ func (u *s3Uploader) Upload(failure complainer.Failure, stdoutURL, stderrURL str
 		return "", "", err
 	}
 
-	stderr, err := download(stderrURL)
+	stderr, err := download(client, stderrURL)
 	if err != nil {
 		return "", "", err
 	}
@@ -2,12 +2,18 @@ package uploader
 
 import (
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
 )
 
 var makers = map[string]Maker{}
 
+// requestTimeout limits every download and upload request, zero means no limit
+var requestTimeout = new(time.Duration)
+
 // Maker is responsible for making uploader and registering its flags
 type Maker struct {
 	RegisterFlags func()
@@ -16,6 +22,8 @@ type Maker struct {
 
 // RegisterFlags registers flags for all registered makers
 func RegisterFlags() {
+	requestTimeout = flags.Duration("uploader.timeout", "UPLOADER_TIMEOUT", time.Minute, "timeout of every download and upload request")
+
 	for _, um := range makers {
 		um.RegisterFlags()
 	}
@@ -34,7 +42,8 @@ func MakerByName(name string) (Maker, error) {
 	return Maker{}, fmt.Errorf("unknown uploader maker: %q", name)
 }
 
-// Uploader is responsible for uploading logs
+// Uploader is responsible for uploading logs, the client
+// is authorized to download logs from the provided urls
 type Uploader interface {
-	Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error)
+	Upload(failure complainer.Failure, client *http.Client, stdoutURL, stderrURL string) (string, string, error)
 }